@@ -1,25 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"gotrainingproject/internal/auth"
 	"gotrainingproject/internal/httpapi"
 	"gotrainingproject/internal/ws"
+	"user-service/pkg/authz"
 	"user-service/pkg/usersclient"
+	"user-service/pkg/validation"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 const (
-	defaultNATSURL = "nats://localhost:4222"
-	addr           = ":8080"
+	defaultNATSURL         = "nats://localhost:4222"
+	addr                   = ":8080"
+	defaultShutdownTimeout = 15 * time.Second
+	defaultPhoneRegion     = "US" // must match the user service's PHONE_DEFAULT_REGION
+	defaultJWTClockSkew    = 30 * time.Second
 )
 
 func main() {
@@ -30,37 +44,138 @@ func main() {
 	if natsURL == "" {
 		natsURL = defaultNATSURL
 	}
+	shutdownTimeout := defaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("invalid SHUTDOWN_TIMEOUT, using default", "value", value, "default", defaultShutdownTimeout.String())
+		} else {
+			shutdownTimeout = parsed
+		}
+	}
 
-	nc, err := nats.Connect(natsURL)
+	phoneRegion := os.Getenv("PHONE_DEFAULT_REGION")
+	if phoneRegion == "" {
+		phoneRegion = defaultPhoneRegion
+	}
+	if !validation.IsPhoneRegion(phoneRegion) {
+		slog.Error("unsupported phone region", "region", phoneRegion)
+		os.Exit(1)
+	}
+
+	authCfg := authConfig()
+	verifier, err := auth.NewVerifier(authCfg)
 	if err != nil {
-		slog.Error("failed to connect to nats", "url", natsURL, "error", err)
+		slog.Error("invalid auth configuration", "error", err)
 		os.Exit(1)
 	}
-	defer func() {
-		if err := nc.Drain(); err != nil {
-			slog.Error("failed to drain nats connection", "error", err)
+	// POST /auth/login signs access tokens with the HS256 secret, so it needs one
+	var signer *auth.Signer
+	if len(authCfg.HMACSecret) > 0 {
+		accessTokenTTL := auth.DefaultAccessTokenTTL
+		if value := os.Getenv("AUTH_ACCESS_TOKEN_TTL"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				slog.Warn("invalid AUTH_ACCESS_TOKEN_TTL, using default", "value", value, "default", auth.DefaultAccessTokenTTL.String())
+			} else {
+				accessTokenTTL = parsed
+			}
+		}
+		signer, err = auth.NewSigner(authCfg, accessTokenTTL)
+		if err != nil {
+			slog.Error("invalid auth configuration", "error", err)
+			os.Exit(1)
 		}
-	}() // ensure all pending messages are sent before closing the connection.
+	} else {
+		slog.Warn("JWT_HS256_SECRET is not set, password login is disabled")
+	}
+
+	// roles and their permissions, checked per route and again by the user service
+	policy := authz.DefaultPolicy()
+	if policyFile := os.Getenv("AUTHZ_POLICY_FILE"); policyFile != "" {
+		policy, err = authz.LoadPolicy(policyFile)
+		if err != nil {
+			slog.Error("failed to load authorization policy", "file", policyFile, "error", err)
+			os.Exit(1)
+		}
+	}
+	actorSigningKey := []byte(os.Getenv("ACTOR_SIGNING_KEY")) // shared with the user service
+	if len(actorSigningKey) < authz.MinSigningKeyLen {
+		slog.Error("ACTOR_SIGNING_KEY must be set to at least 32 bytes")
+		os.Exit(1)
+	}
+
+	// SIGINT/SIGTERM cancel ctx and start the graceful shutdown below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	natsClosed := make(chan struct{})
+	nc, err := nats.Connect(natsURL, nats.ClosedHandler(func(*nats.Conn) { close(natsClosed) }))
+	if err != nil {
+		slog.Error("failed to connect to nats", "url", natsURL, "error", err)
+		os.Exit(1)
+	}
 
 	usersNATSClient := usersclient.New(nc, 0)
+	usersNATSClient.SignActors(actorSigningKey)
+
+	// with EVENTS_JETSTREAM=true user events are read from the durable stream, so events
+	// published while the gateway was down or disconnected are not lost.
+	useJetStream := false
+	if value := os.Getenv("EVENTS_JETSTREAM"); value != "" {
+		useJetStream, err = strconv.ParseBool(value)
+		if err != nil {
+			slog.Error("EVENTS_JETSTREAM must be true or false", "value", value)
+			os.Exit(1)
+		}
+	}
+	var js jetstream.JetStream
+	if useJetStream {
+		js, err = jetstream.New(nc)
+		if err != nil {
+			slog.Error("failed to create jetstream context", "error", err)
+			os.Exit(1)
+		}
+		usersNATSClient.UseJetStream(js, cacheDurableName())
+	}
 
 	// subscribe to user events to keep the API gateway's user cache up to date.
 	if err := usersNATSClient.SubscribeUserEvents(); err != nil {
 		slog.Error("failed to subscribe users client cache events", "error", err)
 		os.Exit(1)
 	}
-	defer func() {
-		if err := usersNATSClient.UnsubscribeUserEvents(); err != nil {
-			slog.Error("failed to unsubscribe users client cache events", "error", err)
+
+	// X-API-Key lookups are cached; a revoked key keeps working until its entry expires
+	apiKeyCacheTTL := auth.DefaultAPIKeyCacheTTL
+	if value := os.Getenv("API_KEY_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("invalid API_KEY_CACHE_TTL, using default", "value", value, "default", auth.DefaultAPIKeyCacheTTL.String())
+		} else {
+			apiKeyCacheTTL = parsed
 		}
+	}
+	apiKeys := auth.NewAPIKeys(usersNATSClient, apiKeyCacheTTL)
+	usageRecorded := make(chan struct{})
+	go func() {
+		defer close(usageRecorded)
+		apiKeys.RecordUsage(ctx, 0)
 	}()
 
 	wsHub := ws.NewHub()
-	userHandler := httpapi.NewUserHandler(usersNATSClient)
-	wsHandler := ws.NewHandler(usersNATSClient, wsHub)
+	userHandler := httpapi.NewUserHandler(usersNATSClient, validation.WithPhoneRegion(phoneRegion))
+	wsHandler := ws.NewHandler(usersNATSClient, wsHub, validation.WithPhoneRegion(phoneRegion))
+	userHandler.UsePolicy(policy)
+	userHandler.UseCredentials(usersNATSClient)
+	wsHandler.UsePolicy(policy)
 
 	// subscribe to user events and broadcast them to connected WebSocket clients.
-	if err := ws.SubscribeUserEvents(nc, wsHub); err != nil {
+	if js != nil {
+		err = ws.SubscribeUserEventStream(context.Background(), js, wsHub)
+	} else {
+		err = ws.SubscribeUserEvents(nc, wsHub)
+	}
+	if err != nil {
 		slog.Error("failed to subscribe user events", "error", err)
 		os.Exit(1)
 	}
@@ -92,20 +207,139 @@ func main() {
 	router.Get("/doc/*", httpSwagger.Handler(
 		httpSwagger.URL("/doc/openapi.yaml"),
 	))
-	// user management endpoints
-	router.Post("/users", userHandler.CreateUser)
-	router.Get("/users", userHandler.ListUsers)
-	router.Get("/users/{id}", userHandler.GetUserByID)
-	router.Patch("/users/{id}", userHandler.UpdateUser)
-	router.Delete("/users/{id}", userHandler.DeleteUser)
-	router.Get("/ws", wsHandler.Handle)
+	// login takes no token; the refresh token in the body authenticates refresh and logout
+	if signer != nil {
+		authHandler := httpapi.NewAuthHandler(usersNATSClient, signer)
+		proxies, err := trustedProxies()
+		if err != nil {
+			slog.Error("invalid LOGIN_TRUSTED_PROXIES", "error", err)
+			os.Exit(1)
+		}
+		authHandler.TrustProxies(proxies)
+		router.Post("/auth/login", authHandler.Login)
+		router.Post("/auth/refresh", authHandler.Refresh)
+		router.Post("/auth/logout", authHandler.Logout)
+	}
+	// user management endpoints; health, docs and login above stay public
+	router.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(verifier, apiKeys))
+		r.Use(httpapi.ActorMiddleware)
 
-	slog.Info("API server listening", "addr", addr)
+		r.Post("/users", userHandler.CreateUser)
+		r.Post("/users:import", userHandler.ImportUsers)
+		r.Get("/users:export", userHandler.ExportUsers)
+		r.Get("/users", userHandler.ListUsers)
+		r.Get("/users/search", userHandler.SearchUsers)
+		r.Get("/users/{id}", userHandler.GetUserByID)
+		r.Patch("/users/{id}", userHandler.UpdateUser)
+		r.Delete("/users/{id}", userHandler.DeleteUser)
+		r.Post("/users/{id}/restore", userHandler.RestoreUser)
+		r.Put("/users/{id}/password", userHandler.SetPassword)
+		r.Post("/users/{id}/unlock", userHandler.UnlockUser)
+		r.Get("/users/{id}/history", userHandler.UserHistory)
+		r.Get("/ws", wsHandler.Handle)
+	})
 
-	if err := http.ListenAndServe(addr, router); err != nil {
+	server := &http.Server{Addr: addr, Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("API server listening", "addr", addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
 		slog.Error("server failed", "error", err)
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutdown started", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// stop accepting connections and wait for in-flight HTTP requests; hijacked
+	// WebSocket connections are not tracked by the server, so the hub closes those.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("http server shutdown failed", "error", err)
 	}
+	if err := wsHub.Shutdown(shutdownCtx); err != nil {
+		slog.Error("ws hub shutdown failed", "error", err)
+	}
+
+	<-usageRecorded // the last batch of api key uses is published before the connection drains
+	if err := usersNATSClient.UnsubscribeUserEvents(); err != nil {
+		slog.Error("failed to unsubscribe users client cache events", "error", err)
+	}
+	// drain flushes pending messages and finishes in-flight subscription callbacks before closing.
+	if err := nc.Drain(); err != nil {
+		slog.Error("failed to drain nats connection", "error", err)
+	}
+	select {
+	case <-natsClosed:
+	case <-shutdownCtx.Done():
+		slog.Error("nats drain did not finish before the shutdown deadline")
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// authConfig reads the JWT settings: JWT_HS256_SECRET and/or JWT_JWKS_FILE (RS256/ES256 public
+// keys), the required JWT_ISSUER and JWT_AUDIENCE, and JWT_CLOCK_SKEW.
+func authConfig() auth.Config {
+	cfg := auth.Config{
+		HMACSecret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		JWKSFile:   os.Getenv("JWT_JWKS_FILE"),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+		ClockSkew:  defaultJWTClockSkew,
+	}
+	if value := os.Getenv("JWT_CLOCK_SKEW"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("invalid JWT_CLOCK_SKEW, using default", "value", value, "default", defaultJWTClockSkew.String())
+		} else {
+			cfg.ClockSkew = parsed
+		}
+	}
+	return cfg
+}
+
+// trustedProxies parses LOGIN_TRUSTED_PROXIES, a comma separated list of the addresses or
+// CIDR ranges of the proxies in front of the gateway.
+func trustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("LOGIN_TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(value); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// cacheDurableName names the cache's JetStream consumer. It has to be stable across restarts
+// so the consumer resumes, and unique per instance so instances do not share events.
+func cacheDurableName() string {
+	if name := os.Getenv("CACHE_DURABLE_NAME"); name != "" {
+		return name
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "api-gateway-cache"
+	}
+	return "api-gateway-cache-" + strings.NewReplacer(".", "-", "*", "-", ">", "-").Replace(hostname)
 }
 
 // statusRecorder is a wrapper around http.ResponseWriter that captures the status code for logging purposes.
@@ -120,6 +354,11 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.NewResponseController reach the underlying writer, e.g. to flush a streamed export.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // requestLogMiddleware is an HTTP middleware that logs incoming requests and their response status and duration using slog.
 func requestLogMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
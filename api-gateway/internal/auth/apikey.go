@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"user-service/pkg/usersclient"
+)
+
+// APIKeyHeader carries the API key of machine clients.
+const APIKeyHeader = "X-API-Key"
+
+const (
+	DefaultAPIKeyCacheTTL  = 30 * time.Second
+	defaultNegativeTTL     = 5 * time.Second
+	defaultUsageFlushEvery = time.Minute
+	maxCachedAPIKeys       = 10000
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyResolver looks up API keys in the user service.
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (*usersclient.APIKey, error)
+	TouchAPIKeys(ctx context.Context, keyIDs []string, usedAt time.Time) error
+}
+
+type cachedKey struct {
+	keyID     string
+	principal *Principal // nil for an unknown, expired or revoked key
+	expires   time.Time
+}
+
+// APIKeys authenticates requests carrying an X-API-Key header. Lookups are cached for ttl
+// (unknown keys for a few seconds), so a revoked key may keep working until its entry expires.
+// Uses are collected and reported to the user service in batches.
+type APIKeys struct {
+	resolver APIKeyResolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedKey // keyed by the key's hash so values are not kept in memory
+	used  map[string]struct{}
+}
+
+// NewAPIKeys returns an authenticator that caches lookups for ttl; DefaultAPIKeyCacheTTL when 0.
+func NewAPIKeys(resolver APIKeyResolver, ttl time.Duration) *APIKeys {
+	if ttl <= 0 {
+		ttl = DefaultAPIKeyCacheTTL
+	}
+	return &APIKeys{
+		resolver: resolver,
+		ttl:      ttl,
+		now:      time.Now,
+		cache:    make(map[[sha256.Size]byte]cachedKey),
+		used:     make(map[string]struct{}),
+	}
+}
+
+// Authenticate returns the principal of an API key: its subject is "apikey:<id>" and its
+// scopes are the key's permissions. Unknown, expired and revoked keys yield ErrInvalidAPIKey.
+func (k *APIKeys) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(key))
+	now := k.now()
+
+	k.mu.Lock()
+	entry, ok := k.cache[hash]
+	k.mu.Unlock()
+	if !ok || !now.Before(entry.expires) {
+		var err error
+		entry, err = k.resolve(ctx, key, now)
+		if err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		if len(k.cache) >= maxCachedAPIKeys {
+			k.pruneLocked(now)
+		}
+		k.cache[hash] = entry
+		k.mu.Unlock()
+	}
+
+	if entry.principal == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	k.mu.Lock()
+	k.used[entry.keyID] = struct{}{}
+	k.mu.Unlock()
+	return entry.principal, nil
+}
+
+func (k *APIKeys) resolve(ctx context.Context, key string, now time.Time) (cachedKey, error) {
+	resolved, err := k.resolver.ResolveAPIKey(usersclient.WithActor(ctx, GatewayActor), key)
+	switch {
+	case errors.Is(err, usersclient.ErrNotFound):
+		return cachedKey{expires: now.Add(defaultNegativeTTL)}, nil
+	case err != nil:
+		return cachedKey{}, err
+	}
+
+	expires := now.Add(k.ttl)
+	if resolved.ExpiresAt != nil && resolved.ExpiresAt.Before(expires) {
+		expires = *resolved.ExpiresAt
+	}
+	principal := &Principal{Subject: "apikey:" + resolved.ID, Scopes: resolved.Scopes, APIKey: true}
+	return cachedKey{keyID: resolved.ID, principal: principal, expires: expires}, nil
+}
+
+// pruneLocked drops expired entries, or all of them if none has expired, to bound the cache.
+func (k *APIKeys) pruneLocked(now time.Time) {
+	for hash, entry := range k.cache {
+		if !now.Before(entry.expires) {
+			delete(k.cache, hash)
+		}
+	}
+	if len(k.cache) >= maxCachedAPIKeys {
+		clear(k.cache)
+	}
+}
+
+// RecordUsage reports the keys used since the last flush every interval until ctx is done,
+// then flushes once more; defaultUsageFlushEvery when interval is 0.
+func (k *APIKeys) RecordUsage(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultUsageFlushEvery
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			k.flushUsage(ctx)
+		case <-ctx.Done():
+			k.flushUsage(context.WithoutCancel(ctx))
+			return
+		}
+	}
+}
+
+func (k *APIKeys) flushUsage(ctx context.Context) {
+	k.mu.Lock()
+	if len(k.used) == 0 {
+		k.mu.Unlock()
+		return
+	}
+	ids := make([]string, 0, len(k.used))
+	for id := range k.used {
+		ids = append(ids, id)
+	}
+	clear(k.used)
+	k.mu.Unlock()
+
+	// last-used times are informational, so a lost batch is only logged
+	if err := k.resolver.TouchAPIKeys(usersclient.WithActor(ctx, GatewayActor), ids, k.now()); err != nil {
+		slog.Error("failed to record api key usage", "keys", len(ids), "error", err)
+	}
+}
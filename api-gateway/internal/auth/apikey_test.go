@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+type fakeResolver struct {
+	mu       sync.Mutex
+	keys     map[string]usersclient.APIKey
+	err      error
+	resolves int
+	actor    *contract.Actor
+	touched  []string
+}
+
+func (r *fakeResolver) ResolveAPIKey(ctx context.Context, key string) (*usersclient.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolves++
+	r.actor = usersclient.ActorFromContext(ctx)
+	if r.err != nil {
+		return nil, r.err
+	}
+	found, ok := r.keys[key]
+	if !ok {
+		return nil, usersclient.ErrNotFound
+	}
+	return &found, nil
+}
+
+func (r *fakeResolver) TouchAPIKeys(ctx context.Context, keyIDs []string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.touched = append(r.touched, keyIDs...)
+	return nil
+}
+
+func TestMiddlewareAcceptsAPIKeys(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+	resolver := &fakeResolver{keys: map[string]usersclient.APIKey{
+		"uk_good": {ID: "k-1", Scopes: []string{"users:read"}},
+	}}
+	keys := NewAPIKeys(resolver, time.Minute)
+
+	var got *Principal
+	handler := Middleware(v, keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+	serve := func(key string) *httptest.ResponseRecorder {
+		got = nil
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(APIKeyHeader, key)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	for range 3 {
+		if res := serve("uk_good"); res.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", res.Code)
+		}
+		if got == nil || got.Subject != "apikey:k-1" || !got.APIKey || len(got.Scopes) != 1 || got.Scopes[0] != "users:read" {
+			t.Fatalf("unexpected principal %+v", got)
+		}
+	}
+	if resolver.resolves != 1 {
+		t.Fatalf("expected one cached lookup, got %d", resolver.resolves)
+	}
+	if resolver.actor == nil || resolver.actor.Source != contract.SourceGateway {
+		t.Fatalf("expected lookups as the gateway, got %+v", resolver.actor)
+	}
+
+	res := serve("uk_unknown")
+	if res.Code != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") != `APIKey realm="api"` {
+		t.Fatalf("expected 401 with an APIKey challenge, got %d %q", res.Code, res.Header().Get("WWW-Authenticate"))
+	}
+
+	resolver.err = errors.New("nats: timeout")
+	if res := serve("uk_other"); res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the lookup fails, got %d", res.Code)
+	}
+}
+
+func TestAPIKeysCacheExpiresWithTheKey(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiresAt := now.Add(10 * time.Second)
+	resolver := &fakeResolver{keys: map[string]usersclient.APIKey{
+		"uk_good": {ID: "k-1", ExpiresAt: &expiresAt},
+	}}
+	keys := NewAPIKeys(resolver, time.Minute)
+	keys.now = func() time.Time { return now }
+
+	if _, err := keys.Authenticate(context.Background(), "uk_good"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	now = now.Add(11 * time.Second)
+	delete(resolver.keys, "uk_good") // the service no longer resolves expired keys
+	if _, err := keys.Authenticate(context.Background(), "uk_good"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expected ErrInvalidAPIKey after the key expired, got %v", err)
+	}
+}
+
+func TestAPIKeysRecordUsageFlushesOnShutdown(t *testing.T) {
+	resolver := &fakeResolver{keys: map[string]usersclient.APIKey{
+		"uk_a": {ID: "k-1"},
+		"uk_b": {ID: "k-2"},
+	}}
+	keys := NewAPIKeys(resolver, 0)
+	for _, key := range []string{"uk_a", "uk_b", "uk_a"} {
+		if _, err := keys.Authenticate(context.Background(), key); err != nil {
+			t.Fatalf("authenticate %s: %v", key, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		keys.RecordUsage(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	if len(resolver.touched) != 2 {
+		t.Fatalf("expected each used key reported once, got %v", resolver.touched)
+	}
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+	algES256 = "ES256"
+)
+
+// minHMACSecretLen is the HS256 key size RFC 7518 requires: at least the hash output size.
+const minHMACSecretLen = 32
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Config selects the keys tokens may be signed with and the claims they must carry.
+// At least one of HMACSecret and JWKSFile is required.
+type Config struct {
+	HMACSecret []byte // HS256 shared secret
+	JWKSFile   string // local JWKS file with the RS256/ES256 public keys
+	Issuer     string // required iss, when set
+	Audience   string // required entry of aud, when set
+	ClockSkew  time.Duration
+}
+
+// Verifier checks the signature and claims of bearer JWTs.
+type Verifier struct {
+	hmacSecret []byte
+	keys       []publicKey
+	issuer     string
+	audience   string
+	skew       time.Duration
+	now        func() time.Time
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if len(cfg.HMACSecret) == 0 && cfg.JWKSFile == "" {
+		return nil, errors.New("auth: an HMAC secret or a JWKS file is required")
+	}
+	if len(cfg.HMACSecret) > 0 && len(cfg.HMACSecret) < minHMACSecretLen {
+		return nil, fmt.Errorf("auth: the HMAC secret must be at least %d bytes", minHMACSecretLen)
+	}
+	if cfg.ClockSkew < 0 {
+		return nil, errors.New("auth: clock skew must not be negative")
+	}
+
+	v := &Verifier{
+		hmacSecret: cfg.HMACSecret,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		skew:       cfg.ClockSkew,
+		now:        time.Now,
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		v.keys = keys
+	}
+	return v, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Claims are the registered claims the gateway checks plus the ones it maps to a Principal.
+type Claims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	Roles     []string    `json:"roles,omitempty"`
+	Scope     string      `json:"scope,omitempty"`
+}
+
+// Audience is the aud claim, which may be a single string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// NumericDate is a JWT time: seconds since the Unix epoch; 0 means absent.
+type NumericDate int64
+
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return errors.New("dates must be numbers of seconds")
+	}
+	*d = NumericDate(seconds)
+	return nil
+}
+
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// Verify checks token and returns its principal. Every failure wraps ErrInvalidToken.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return &Principal{Subject: claims.Subject, Roles: claims.Roles, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+func (v *Verifier) verifySignature(h header, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch h.Alg {
+	case algHS256:
+		// HS256 only ever uses the shared secret, never JWKS material, so a public key
+		// cannot be passed off as an HMAC secret.
+		if len(v.hmacSecret) == 0 {
+			return fmt.Errorf("%w: HS256 tokens are not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+
+	case algRS256, algES256:
+		candidates := 0
+		for _, key := range v.keys {
+			if key.alg != h.Alg || (h.Kid != "" && key.kid != h.Kid) {
+				continue
+			}
+			candidates++
+			if verifyWithKey(key, digest[:], signature) {
+				return nil
+			}
+		}
+		if candidates == 0 {
+			return fmt.Errorf("%w: no %s key with kid %q", ErrInvalidToken, h.Alg, h.Kid)
+		}
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, h.Alg)
+	}
+}
+
+func verifyWithKey(key publicKey, digest, signature []byte) bool {
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 { // JWS ES256 signatures are R || S, 32 bytes each
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func (v *Verifier) checkClaims(claims Claims) error {
+	now := v.now()
+	switch {
+	case claims.Subject == "":
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	case claims.ExpiresAt == 0:
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	case now.After(claims.ExpiresAt.Time().Add(v.skew)):
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case claims.NotBefore != 0 && now.Add(v.skew).Before(claims.NotBefore.Time()):
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case v.audience != "" && !slices.Contains(claims.Audience, v.audience):
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, dst any) error {
+	payload, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, dst)
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testNow    = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// sign builds a compact JWS; key is the HMAC secret, *rsa.PrivateKey or *ecdsa.PrivateKey.
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("rsa sign: %v", err)
+		}
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("ecdsa sign: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   "https://id.example.com",
+		"aud":   []string{"users-api", "other"},
+		"sub":   "user-1",
+		"exp":   testNow.Add(time.Minute).Unix(),
+		"roles": []string{"support"},
+		"scope": "users:read users:write",
+	}
+}
+
+func newTestVerifier(t *testing.T, cfg Config) *Verifier {
+	t.Helper()
+	cfg.Issuer, cfg.Audience, cfg.ClockSkew = "https://id.example.com", "users-api", 30*time.Second
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"keys": keys})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	return path
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func TestVerifyHS256(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+
+	principal, err := v.Verify(sign(t, "HS256", "", testSecret, validClaims()))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if principal.Subject != "user-1" || len(principal.Roles) != 1 || strings.Join(principal.Scopes, ",") != "users:read,users:write" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+}
+
+func TestVerifyRejectsBadClaims(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+
+	for name, change := range map[string]func(c map[string]any){
+		"expired":           func(c map[string]any) { c["exp"] = testNow.Add(-time.Minute).Unix() },
+		"missing exp":       func(c map[string]any) { delete(c, "exp") },
+		"not yet valid":     func(c map[string]any) { c["nbf"] = testNow.Add(time.Minute).Unix() },
+		"wrong issuer":      func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"wrong audience":    func(c map[string]any) { c["aud"] = "billing-api" },
+		"missing subject":   func(c map[string]any) { delete(c, "sub") },
+		"malformed expires": func(c map[string]any) { c["exp"] = "tomorrow" },
+	} {
+		claims := validClaims()
+		change(claims)
+		if _, err := v.Verify(sign(t, "HS256", "", testSecret, claims)); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyAllowsClockSkew(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+
+	claims := validClaims()
+	claims["exp"] = testNow.Add(-20 * time.Second).Unix()
+	claims["nbf"] = testNow.Add(20 * time.Second).Unix()
+	claims["aud"] = "users-api" // a single string is allowed too
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, claims)); err != nil {
+		t.Fatalf("expected a token within the skew to pass, got %v", err)
+	}
+}
+
+func TestVerifyRejectsBadSignatures(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+	token := sign(t, "HS256", "", testSecret, validClaims())
+
+	for name, bad := range map[string]string{
+		"other secret": sign(t, "HS256", "", []byte("fedcba9876543210fedcba9876543210"), validClaims()),
+		"alg none":     strings.Join(strings.Split(sign(t, "none", "", testSecret, validClaims()), ".")[:2], ".") + ".",
+		"tampered":     token[:strings.LastIndex(token, ".")-2] + "xx" + token[strings.LastIndex(token, "."):],
+		"not a jwt":    "abc",
+	} {
+		if _, err := v.Verify(bad); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyJWKSKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	ecPub, _ := ecKey.PublicKey.ECDH()
+	point := ecPub.Bytes()
+	path := writeJWKS(t,
+		map[string]string{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+		map[string]string{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(point[1:33]), "y": b64(point[33:])},
+	)
+	v := newTestVerifier(t, Config{JWKSFile: path})
+
+	if _, err := v.Verify(sign(t, "RS256", "rsa-1", rsaKey, validClaims())); err != nil {
+		t.Fatalf("RS256: %v", err)
+	}
+	if _, err := v.Verify(sign(t, "ES256", "ec-1", ecKey, validClaims())); err != nil {
+		t.Fatalf("ES256: %v", err)
+	}
+	if _, err := v.Verify(sign(t, "ES256", "", ecKey, validClaims())); err != nil {
+		t.Fatalf("ES256 without kid: %v", err)
+	}
+	if _, err := v.Verify(sign(t, "RS256", "ec-1", rsaKey, validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected a kid of another alg to fail, got %v", err)
+	}
+	// without a shared secret, HS256 must not fall back to the public keys
+	if _, err := v.Verify(sign(t, "HS256", "rsa-1", []byte(b64(rsaKey.N.Bytes())), validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected HS256 to be refused, got %v", err)
+	}
+}
+
+func TestNewVerifierRejectsBadConfig(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no keys":      {},
+		"short secret": {HMACSecret: []byte("secret")},
+		"missing jwks": {JWKSFile: filepath.Join(t.TempDir(), "missing.json")},
+		"unknown kty":  {JWKSFile: writeJWKS(t, map[string]string{"kty": "OKP", "crv": "Ed25519", "x": "AA"})},
+	} {
+		if _, err := NewVerifier(cfg); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSignerTokensPassTheVerifier(t *testing.T) {
+	cfg := Config{HMACSecret: testSecret, Issuer: "https://id.example.com", Audience: "users-api"}
+	v := newTestVerifier(t, cfg)
+	signer, err := NewSigner(cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	signer.now = func() time.Time { return testNow }
+
+	token, expiresAt, err := signer.Sign("user-1", []string{"user"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	principal, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if principal.Subject != "user-1" || len(principal.Roles) != 1 || principal.Roles[0] != "user" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+	if !expiresAt.Equal(testNow.Add(time.Minute)) {
+		t.Fatalf("expected the token to expire after a minute, got %s", expiresAt)
+	}
+
+	if _, err := NewSigner(Config{JWKSFile: "keys.json"}, 0); err == nil {
+		t.Fatal("expected an error without an HMAC secret")
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// QueryTokenParam carries the token on WebSocket upgrades, since browsers cannot set headers
+// on them (RFC 6750, section 2.3). Other requests must use the Authorization header so tokens
+// stay out of URLs.
+const QueryTokenParam = "access_token"
+
+// Middleware rejects requests without a valid bearer token or API key with 401 and puts the
+// principal of the others into the request context. API keys are only accepted when keys is set.
+func Middleware(v *Verifier, keys *APIKeys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(APIKeyHeader); key != "" && keys != nil {
+				principal, err := keys.Authenticate(r.Context(), key)
+				switch {
+				case errors.Is(err, ErrInvalidAPIKey):
+					slog.Info("auth invalid api key", "method", r.Method, "path", r.URL.Path)
+					writeUnauthorized(w, err, `APIKey realm="api"`)
+					return
+				case err != nil:
+					slog.Error("auth api key lookup failed", "method", r.Method, "path", r.URL.Path, "error", err)
+					writeProblem(w, http.StatusServiceUnavailable, "api key lookup failed")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+				return
+			}
+
+			token, err := bearerToken(r)
+			if err != nil {
+				slog.Info("auth missing token", "method", r.Method, "path", r.URL.Path)
+				writeUnauthorized(w, err, `Bearer realm="api"`)
+				return
+			}
+
+			principal, err := v.Verify(token)
+			if err != nil {
+				slog.Info("auth invalid token", "method", r.Method, "path", r.URL.Path, "error", err)
+				writeUnauthorized(w, err, `Bearer realm="api", error="invalid_token"`)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// bearerToken reads the token from the Authorization header or, on WebSocket upgrades,
+// from the access_token query parameter.
+func bearerToken(r *http.Request) (string, error) {
+	if value := r.Header.Get("Authorization"); value != "" {
+		scheme, token, ok := strings.Cut(value, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", errors.New("authorization header must be Bearer <token>")
+		}
+		return strings.TrimSpace(token), nil
+	}
+	if isWebSocketUpgrade(r) {
+		if token := r.URL.Query().Get(QueryTokenParam); token != "" {
+			return token, nil
+		}
+	}
+	return "", ErrMissingToken
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// writeUnauthorized writes a 401 problem body; detail names the failed check but never
+// echoes the token.
+func writeUnauthorized(w http.ResponseWriter, err error, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeProblem(w, http.StatusUnauthorized, err.Error())
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	body := map[string]any{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("failed to encode problem response", "status_code", status, "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	v := newTestVerifier(t, Config{HMACSecret: testSecret})
+	token := sign(t, "HS256", "", testSecret, validClaims())
+
+	var got *Principal
+	handler := Middleware(v, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	for _, tc := range []struct {
+		name    string
+		request func() *http.Request
+		status  int
+	}{
+		{name: "header", status: http.StatusOK, request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			return req
+		}},
+		{name: "missing", status: http.StatusUnauthorized, request: func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/users", nil)
+		}},
+		{name: "wrong scheme", status: http.StatusUnauthorized, request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Authorization", "Basic "+token)
+			return req
+		}},
+		{name: "query token on plain request", status: http.StatusUnauthorized, request: func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/users?access_token="+token, nil)
+		}},
+		{name: "query token on websocket upgrade", status: http.StatusOK, request: func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/ws?access_token="+token, nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			return req
+		}},
+	} {
+		got = nil
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, tc.request())
+
+		if res.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.status, res.Code)
+		}
+		if tc.status == http.StatusOK && (got == nil || got.Subject != "user-1") {
+			t.Fatalf("%s: expected the principal in the context, got %+v", tc.name, got)
+		}
+		if tc.status == http.StatusUnauthorized && !strings.HasPrefix(res.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Fatalf("%s: expected a Bearer challenge, got %q", tc.name, res.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
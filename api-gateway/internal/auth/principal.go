@@ -0,0 +1,33 @@
+// Package auth authenticates gateway callers with bearer JWTs or API keys.
+package auth
+
+import (
+	"context"
+
+	"user-service/pkg/contract"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string   // the token's sub claim, e.g. a user id, or apikey:<id>
+	Roles   []string // the token's roles claim
+	Scopes  []string // the token's space-separated scope claim, or the API key's scopes
+	APIKey  bool     // an API key, whose scopes grant permissions rather than narrow the roles'
+}
+
+// GatewayActor is who the gateway sends commands as before the caller is authenticated,
+// e.g. to look up an API key or check a password.
+var GatewayActor = contract.Actor{ID: "api-gateway", Source: contract.SourceGateway}
+
+type principalCtx struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalCtx{}, p)
+}
+
+// PrincipalFromContext returns the principal set by the middleware, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalCtx{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,39 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"gotrainingproject/internal/auth"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+// ActorHeader names who is making the request when it is not authenticated; it is recorded
+// in the audit history of the users the request changes.
+const ActorHeader = "X-Actor"
+
+const maxActorLen = 255
+
+// ActorMiddleware attributes the request's user operations, with source rest, to the
+// authenticated principal and its roles, or to the ActorHeader on unauthenticated routes.
+func ActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := RequestActor(r, contract.SourceREST)
+		if len(actor.ID) > maxActorLen {
+			writeError(w, http.StatusBadRequest, ActorHeader+" must be at most 255 characters")
+			return
+		}
+		ctx := usersclient.WithActor(r.Context(), actor)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestActor is who the request acts as: the principal's subject, roles and scopes once
+// authenticated, which callers cannot override, otherwise the ActorHeader with no roles.
+func RequestActor(r *http.Request, source string) contract.Actor {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return contract.Actor{ID: principal.Subject, Source: source, Roles: principal.Roles, Scopes: principal.Scopes, APIKey: principal.APIKey}
+	}
+	return contract.Actor{ID: r.Header.Get(ActorHeader), Source: source}
+}
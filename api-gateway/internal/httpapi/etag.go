@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"user-service/pkg/usersclient"
+)
+
+var (
+	errInvalidIfMatch = errors.New(`If-Match must be "*" or a list of ETags such as "3"`)
+	// errIfMatchFailed means the header is well formed but no ETag in it matches.
+	errIfMatchFailed = errors.New("If-Match matches no version of the user")
+)
+
+// formatETag renders a user version as a strong ETag.
+func formatETag(version int32) string {
+	return `"` + strconv.FormatInt(int64(version), 10) + `"`
+}
+
+// parseIfMatch turns an If-Match header into the user versions it accepts.
+// An empty header or "*" means "any version" and yields nil. The header may list several
+// ETags (RFC 9110, section 13.1.1); weak ones and ones that are no version we issue can never
+// match under the strong comparison If-Match uses, and errIfMatchFailed is returned when
+// nothing else is left.
+func parseIfMatch(header string) ([]int32, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	tags, err := splitETags(header)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int32
+	for _, tag := range tags {
+		if tag.weak {
+			continue
+		}
+		version, err := strconv.ParseInt(tag.value, 10, 32)
+		if err != nil || version <= 0 || slices.Contains(versions, int32(version)) {
+			continue
+		}
+		versions = append(versions, int32(version))
+	}
+	if len(versions) == 0 {
+		return nil, errIfMatchFailed
+	}
+	return versions, nil
+}
+
+// expectedVersion resolves the If-Match header of r into the version the service must find,
+// nil for any. The service checks a single version; for a list naming several, the user's
+// current version is looked up and expected when it is one of them, so the condition holds
+// if any ETag matches. The service still rejects a change made in between.
+func (h *UserHandler) expectedVersion(r *http.Request, userID string) (*int32, error) {
+	versions, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil || versions == nil {
+		return nil, err
+	}
+	if len(versions) == 1 {
+		return &versions[0], nil
+	}
+	current, err := h.client.Get(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(versions, current.Version) {
+		return nil, errIfMatchFailed
+	}
+	return &current.Version, nil
+}
+
+// writeIfMatchError answers an error of expectedVersion: 412 when the header matches no
+// version, 400 when it is malformed, and the status of the failed lookup otherwise.
+func writeIfMatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errIfMatchFailed):
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, errInvalidIfMatch):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, usersclient.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, usersclient.ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+type entityTag struct {
+	value string
+	weak  bool
+}
+
+// splitETags parses a comma separated list of entity tags, such as `"3", W/"2"`.
+func splitETags(header string) ([]entityTag, error) {
+	var tags []entityTag
+	rest := header
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+		var tag entityTag
+		if strings.HasPrefix(rest, "W/") {
+			tag.weak = true
+			rest = rest[2:]
+		}
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, errInvalidIfMatch
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, errInvalidIfMatch
+		}
+		tag.value = rest[1 : end+1]
+		tags = append(tags, tag)
+
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, errInvalidIfMatch
+		}
+	}
+	if len(tags) == 0 {
+		return nil, errInvalidIfMatch
+	}
+	return tags, nil
+}
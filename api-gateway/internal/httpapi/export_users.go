@@ -0,0 +1,214 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"user-service/pkg/usersclient"
+)
+
+// export formats accepted by GET /users:export.
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+	exportFormatJSON   = "json"
+)
+
+// exportColumn is one user field an export can include; value returns nil when the field is unset.
+type exportColumn struct {
+	name  string
+	value func(user usersclient.User) any
+}
+
+// exportColumns lists every exportable field in default order.
+var exportColumns = []exportColumn{
+	{name: "userId", value: func(user usersclient.User) any { return user.UserID }},
+	{name: "firstName", value: func(user usersclient.User) any { return user.FirstName }},
+	{name: "lastName", value: func(user usersclient.User) any { return user.LastName }},
+	{name: "email", value: func(user usersclient.User) any { return user.Email }},
+	{name: "phone", value: func(user usersclient.User) any {
+		if user.Phone == nil {
+			return nil
+		}
+		return *user.Phone
+	}},
+	{name: "phoneRaw", value: func(user usersclient.User) any {
+		if user.PhoneRaw == nil {
+			return nil
+		}
+		return *user.PhoneRaw
+	}},
+	{name: "age", value: func(user usersclient.User) any {
+		if user.Age == nil {
+			return nil
+		}
+		return *user.Age
+	}},
+	{name: "status", value: func(user usersclient.User) any { return user.Status }},
+	{name: "createdAt", value: func(user usersclient.User) any { return user.CreatedAt }},
+	{name: "updatedAt", value: func(user usersclient.User) any { return user.UpdatedAt }},
+	{name: "deletedAt", value: func(user usersclient.User) any {
+		if user.DeletedAt == nil {
+			return nil
+		}
+		return *user.DeletedAt
+	}},
+	{name: "version", value: func(user usersclient.User) any { return user.Version }},
+}
+
+// parseExportColumns resolves a comma-separated column list; empty means every column.
+func parseExportColumns(raw string) ([]exportColumn, error) {
+	if strings.TrimSpace(raw) == "" {
+		return exportColumns, nil
+	}
+
+	var columns []exportColumn
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			return nil, fmt.Errorf("column %q is listed twice", name)
+		}
+		seen[name] = true
+
+		found := false
+		for _, column := range exportColumns {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// userRowWriter writes an export one user at a time; begin and end frame the whole document.
+type userRowWriter interface {
+	begin() error
+	write(user usersclient.User) error
+	end() error
+}
+
+func newUserRowWriter(w io.Writer, format string, columns []exportColumn) userRowWriter {
+	switch format {
+	case exportFormatNDJSON:
+		return &jsonRowWriter{w: w, columns: columns}
+	case exportFormatJSON:
+		return &jsonRowWriter{w: w, columns: columns, array: true}
+	default:
+		return &csvRowWriter{w: csv.NewWriter(w), columns: columns}
+	}
+}
+
+type csvRowWriter struct {
+	w       *csv.Writer
+	columns []exportColumn
+	record  []string
+}
+
+func (c *csvRowWriter) begin() error {
+	header := make([]string, 0, len(c.columns))
+	for _, column := range c.columns {
+		header = append(header, column.name)
+	}
+	return c.w.Write(header)
+}
+
+func (c *csvRowWriter) write(user usersclient.User) error {
+	c.record = c.record[:0]
+	for _, column := range c.columns {
+		c.record = append(c.record, csvValue(column.value(user)))
+	}
+	if err := c.w.Write(c.record); err != nil {
+		return err
+	}
+	c.w.Flush() // hand each row to the response so nothing piles up in the csv buffer
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonRowWriter writes one object per user with the selected columns in order, either one
+// per line (NDJSON) or as the elements of a single JSON array. Unset fields are left out,
+// as in the rest of the API.
+type jsonRowWriter struct {
+	w       io.Writer
+	columns []exportColumn
+	array   bool
+	rows    int
+	buf     bytes.Buffer
+}
+
+func (j *jsonRowWriter) begin() error {
+	if !j.array {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonRowWriter) write(user usersclient.User) error {
+	j.buf.Reset()
+	if j.array && j.rows > 0 {
+		j.buf.WriteByte(',')
+	}
+	j.buf.WriteByte('{')
+	first := true
+	for _, column := range j.columns {
+		value := column.value(user)
+		if value == nil {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if !first {
+			j.buf.WriteByte(',')
+		}
+		first = false
+		fmt.Fprintf(&j.buf, "%q:", column.name)
+		j.buf.Write(encoded)
+	}
+	j.buf.WriteString("}\n")
+	j.rows++
+
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonRowWriter) end() error {
+	if !j.array {
+		return nil
+	}
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
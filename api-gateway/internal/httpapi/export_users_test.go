@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/pkg/usersclient"
+)
+
+func exportPages() map[string]*usersclient.UserPage {
+	phone := "+15550100"
+	age := int32(42)
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	return map[string]*usersclient.UserPage{
+		"": {
+			Users:      []usersclient.User{{UserID: "u-1", FirstName: "John", LastName: "Doe, Jr", Email: "john@example.com", Phone: &phone, Age: &age, Status: "Active", CreatedAt: created, Version: 1}},
+			NextCursor: "page-2",
+		},
+		"page-2": {
+			Users: []usersclient.User{{UserID: "u-2", FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Status: "Inactive", CreatedAt: created, Version: 3}},
+		},
+	}
+}
+
+func TestExportUsersHandlerCSV(t *testing.T) {
+	client := &testClient{listPages: exportPages()}
+	handler := NewUserHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/users:export?status=Active&limit=5&cursor=abc&columns=email,lastName,age,createdAt", nil)
+	res := httptest.NewRecorder()
+
+	handler.ExportUsers(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	want := "email,lastName,age,createdAt\n" +
+		"john@example.com,\"Doe, Jr\",42,2025-03-01T12:00:00Z\n" +
+		"jane@example.com,Doe,,2025-03-01T12:00:00Z\n"
+	if res.Body.String() != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, res.Body.String())
+	}
+	if client.listInput.Filter.Status != "Active" || client.listInput.Limit != 200 {
+		t.Fatalf("expected filters kept and limit replaced, got %+v", client.listInput)
+	}
+}
+
+func TestExportUsersHandlerJSONFormats(t *testing.T) {
+	for _, format := range []string{exportFormatJSON, exportFormatNDJSON} {
+		handler := NewUserHandler(&testClient{listPages: exportPages()})
+
+		req := httptest.NewRequest(http.MethodGet, "/users:export?format="+format+"&columns=userId,phone,version", nil)
+		res := httptest.NewRecorder()
+
+		handler.ExportUsers(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", format, res.Code)
+		}
+		var rows []map[string]any
+		if format == exportFormatJSON {
+			if err := json.Unmarshal(res.Body.Bytes(), &rows); err != nil {
+				t.Fatalf("json: invalid array: %v\n%s", err, res.Body.String())
+			}
+		} else {
+			for _, line := range strings.Split(strings.TrimSpace(res.Body.String()), "\n") {
+				var row map[string]any
+				if err := json.Unmarshal([]byte(line), &row); err != nil {
+					t.Fatalf("ndjson: invalid line %q: %v", line, err)
+				}
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) != 2 || rows[0]["phone"] != "+15550100" || rows[1]["version"] != float64(3) {
+			t.Fatalf("%s: unexpected rows %v", format, rows)
+		}
+		if _, ok := rows[1]["phone"]; ok || len(rows[1]) != 2 {
+			t.Fatalf("%s: expected unset phone to be left out, got %v", format, rows[1])
+		}
+	}
+}
+
+func TestExportUsersHandlerRejectsBadQuery(t *testing.T) {
+	for _, query := range []string{"format=xml", "columns=email,password", "columns=email,email", "sort=age"} {
+		handler := NewUserHandler(&testClient{listPages: exportPages()})
+
+		req := httptest.NewRequest(http.MethodGet, "/users:export?"+query, nil)
+		res := httptest.NewRecorder()
+
+		handler.ExportUsers(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestExportUsersHandlerFirstPageError(t *testing.T) {
+	handler := NewUserHandler(&testClient{listErr: errors.New("nats timeout")})
+
+	req := httptest.NewRequest(http.MethodGet, "/users:export", nil)
+	res := httptest.NewRecorder()
+
+	handler.ExportUsers(res, req)
+
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", res.Code)
+	}
+}
+
+func TestExportUsersHandlerAbortsMidStream(t *testing.T) {
+	pages := exportPages()
+	delete(pages, "page-2") // the second List call fails
+	handler := NewUserHandler(&testClient{listPages: pages})
+
+	req := httptest.NewRequest(http.MethodGet, "/users:export", nil)
+	res := httptest.NewRecorder()
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Fatalf("expected http.ErrAbortHandler panic, got %v", recovered)
+		}
+	}()
+	handler.ExportUsers(res, req)
+}
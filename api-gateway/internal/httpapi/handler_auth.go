@@ -0,0 +1,199 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotrainingproject/internal/auth"
+
+	"user-service/pkg/usersclient"
+)
+
+const maxAuthBodyBytes = 4 << 10
+
+// AuthHandler logs users in with their email and password. The user service checks the
+// password and keeps the refresh tokens; the gateway signs the short-lived access tokens.
+type AuthHandler struct {
+	client  usersclient.CredentialClient
+	signer  *auth.Signer
+	proxies []netip.Prefix
+}
+
+func NewAuthHandler(client usersclient.CredentialClient, signer *auth.Signer) *AuthHandler {
+	return &AuthHandler{client: client, signer: signer}
+}
+
+// TrustProxies makes Login take the client address from X-Forwarded-For when the request
+// comes through one of these proxies. The user service throttles failed logins per address,
+// so without it every client behind a load balancer shares one.
+func (h *AuthHandler) TrustProxies(proxies []netip.Prefix) {
+	h.proxies = proxies
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// tokenResponse follows the OAuth 2.0 token response (RFC 6749, section 5.1), in camel case
+// like the rest of the API.
+type tokenResponse struct {
+	AccessToken      string    `json:"accessToken"`
+	TokenType        string    `json:"tokenType"`
+	ExpiresIn        int64     `json:"expiresIn"` // seconds
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var input loginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAuthBodyBytes)).Decode(&input); err != nil {
+		slog.Info("rest login invalid body", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if input.Email == "" || input.Password == "" {
+		writeError(w, http.StatusBadRequest, "email and password are required")
+		return
+	}
+
+	// nobody is authenticated yet, so the gateway asks on its own behalf
+	ctx := usersclient.WithActor(r.Context(), auth.GatewayActor)
+	session, err := h.client.Authenticate(ctx, usersclient.AuthenticateRequest{
+		Email:    input.Email,
+		Password: input.Password,
+		SourceIP: h.clientIP(r),
+	})
+	if err != nil {
+		h.writeSessionError(w, r, "rest login failed", err)
+		return
+	}
+
+	slog.Info("rest login succeeded", "method", r.Method, "path", r.URL.Path, "user_id", session.UserID, "duration_ms", time.Since(start).Milliseconds())
+	h.writeTokens(w, r, session)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token; the old
+// one stops working.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var input refreshRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAuthBodyBytes)).Decode(&input); err != nil || input.RefreshToken == "" {
+		slog.Info("rest refresh invalid body", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, "refreshToken is required")
+		return
+	}
+
+	ctx := usersclient.WithActor(r.Context(), auth.GatewayActor)
+	session, err := h.client.RefreshSession(ctx, input.RefreshToken)
+	if err != nil {
+		h.writeSessionError(w, r, "rest refresh failed", err)
+		return
+	}
+
+	slog.Info("rest refresh succeeded", "method", r.Method, "path", r.URL.Path, "user_id", session.UserID, "duration_ms", time.Since(start).Milliseconds())
+	h.writeTokens(w, r, session)
+}
+
+// Logout ends the session of a refresh token. Access tokens already issued stay valid until
+// they expire. Unknown tokens are not an error: the session is over either way.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var input refreshRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAuthBodyBytes)).Decode(&input); err != nil || input.RefreshToken == "" {
+		slog.Info("rest logout invalid body", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, "refreshToken is required")
+		return
+	}
+
+	ctx := usersclient.WithActor(r.Context(), auth.GatewayActor)
+	if err := h.client.RevokeSession(ctx, input.RefreshToken); err != nil && !errors.Is(err, usersclient.ErrUnauthenticated) {
+		slog.Error("rest logout failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	slog.Info("rest logout succeeded", "method", r.Method, "path", r.URL.Path, "duration_ms", time.Since(start).Milliseconds())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) writeTokens(w http.ResponseWriter, r *http.Request, session *usersclient.Session) {
+	accessToken, _, err := h.signer.Sign(session.UserID, session.Roles)
+	if err != nil {
+		slog.Error("rest sign access token failed", "method", r.Method, "path", r.URL.Path, "user_id", session.UserID, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	// tokens must not end up in shared caches (RFC 6749, section 5.1)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(h.signer.TTL() / time.Second),
+		RefreshToken:     session.RefreshToken,
+		RefreshExpiresAt: session.RefreshExpiresAt,
+	})
+}
+
+// clientIP returns the address the request came from: the peer, or when that is a trusted
+// proxy, the last X-Forwarded-For hop not added by one. Earlier hops are the client's own word.
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && h.trusted(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop
+	}
+	return addr.Unmap().String()
+}
+
+func (h *AuthHandler) trusted(addr netip.Addr) bool {
+	for _, proxy := range h.proxies {
+		if proxy.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *AuthHandler) writeSessionError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, usersclient.ErrLocked):
+		slog.Warn(msg, "method", r.Method, "path", r.URL.Path, "error", err)
+		if retryAfter := usersclient.RetryAfter(err); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+		}
+		writeError(w, http.StatusTooManyRequests, "too many failed logins, try again later")
+	case errors.Is(err, usersclient.ErrUnauthenticated):
+		slog.Info(msg, "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, usersclient.ErrBadRequest):
+		slog.Info(msg, "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		slog.Error(msg, "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,264 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"gotrainingproject/internal/auth"
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+type testCredentialClient struct {
+	sessions      map[string]*usersclient.Session // by email or refresh token
+	actor         *contract.Actor
+	revoked       []string
+	passwordInput usersclient.SetPasswordInput
+	passwordErr   error
+	sourceIP      string
+	loginErr      error
+	unlocked      []string
+}
+
+func (c *testCredentialClient) SetPassword(ctx context.Context, userID string, input usersclient.SetPasswordInput) (*usersclient.Credential, error) {
+	c.passwordInput = input
+	if c.passwordErr != nil {
+		return nil, c.passwordErr
+	}
+	return &usersclient.Credential{UserID: userID, Roles: []string{"user"}}, nil
+}
+
+func (c *testCredentialClient) Authenticate(ctx context.Context, req usersclient.AuthenticateRequest) (*usersclient.Session, error) {
+	c.actor = usersclient.ActorFromContext(ctx)
+	c.sourceIP = req.SourceIP
+	if c.loginErr != nil {
+		return nil, c.loginErr
+	}
+	session, ok := c.sessions[req.Email]
+	if !ok || req.Password != "correct horse battery" {
+		return nil, fmt.Errorf("%w: invalid email or password", usersclient.ErrUnauthenticated)
+	}
+	return session, nil
+}
+
+func (c *testCredentialClient) RefreshSession(ctx context.Context, refreshToken string) (*usersclient.Session, error) {
+	session, ok := c.sessions[refreshToken]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid refresh token", usersclient.ErrUnauthenticated)
+	}
+	delete(c.sessions, refreshToken)
+	return session, nil
+}
+
+func (c *testCredentialClient) RevokeSession(ctx context.Context, refreshToken string) error {
+	if _, ok := c.sessions[refreshToken]; !ok {
+		return fmt.Errorf("%w: invalid refresh token", usersclient.ErrUnauthenticated)
+	}
+	c.revoked = append(c.revoked, refreshToken)
+	return nil
+}
+
+func (c *testCredentialClient) UnlockUser(ctx context.Context, userID string) (*usersclient.UnlockResult, error) {
+	c.unlocked = append(c.unlocked, userID)
+	return &usersclient.UnlockResult{UserID: userID, WasLocked: true}, nil
+}
+
+func TestAuthHandlerLoginIssuesVerifiableTokens(t *testing.T) {
+	cfg := auth.Config{HMACSecret: []byte("0123456789abcdef0123456789abcdef"), Issuer: "api-gateway"}
+	signer, err := auth.NewSigner(cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	verifier, err := auth.NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	client := &testCredentialClient{sessions: map[string]*usersclient.Session{
+		"alice@example.com": {UserID: testUserID, Roles: []string{"user"}, RefreshToken: "rt_1"},
+		"rt_1":              {UserID: testUserID, Roles: []string{"support"}, RefreshToken: "rt_2"},
+	}}
+	handler := NewAuthHandler(client, signer)
+
+	post := func(route http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		route(res, httptest.NewRequest(http.MethodPost, "/auth", bytes.NewBufferString(body)))
+		return res
+	}
+
+	res := post(handler.Login, `{"email":"alice@example.com","password":"correct horse battery"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("expected Cache-Control no-store, got %q", got)
+	}
+	var tokens tokenResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if tokens.TokenType != "Bearer" || tokens.ExpiresIn != 60 || tokens.RefreshToken != "rt_1" {
+		t.Fatalf("unexpected token response %+v", tokens)
+	}
+	principal, err := verifier.Verify(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("verify access token: %v", err)
+	}
+	if principal.Subject != testUserID || len(principal.Roles) != 1 || principal.Roles[0] != "user" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+	if client.actor == nil || client.actor.Source != contract.SourceGateway {
+		t.Fatalf("expected the login to be asked as the gateway, got %+v", client.actor)
+	}
+	if client.sourceIP != "192.0.2.1" { // httptest's remote address
+		t.Fatalf("expected the client address passed on, got %q", client.sourceIP)
+	}
+
+	if res := post(handler.Login, `{"email":"alice@example.com","password":"wrong"}`); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", res.Code)
+	}
+
+	// a refresh token works once
+	if res := post(handler.Refresh, `{"refreshToken":"rt_1"}`); res.Code != http.StatusOK {
+		t.Fatalf("expected 200 on refresh, got %d", res.Code)
+	}
+	if res := post(handler.Refresh, `{"refreshToken":"rt_1"}`); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a used refresh token, got %d", res.Code)
+	}
+}
+
+func TestAuthHandlerLoginReportsLockouts(t *testing.T) {
+	client := &testCredentialClient{loginErr: usersclient.NewCommandError(contract.CommandError{
+		Code:       "LOCKED",
+		Reason:     contract.LockedReasonAccount,
+		Message:    "too many failed logins",
+		RetryAfter: 90,
+	})}
+	handler := NewAuthHandler(client, nil)
+
+	res := httptest.NewRecorder()
+	handler.Login(res, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"email":"alice@example.com","password":"guess"}`)))
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d: %s", res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Retry-After"); got != "90" {
+		t.Fatalf("expected Retry-After 90, got %q", got)
+	}
+}
+
+func TestAuthHandlerClientIP(t *testing.T) {
+	handler := NewAuthHandler(&testCredentialClient{}, nil)
+	handler.TrustProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	for _, tc := range []struct {
+		remoteAddr, forwardedFor, want string
+	}{
+		{"203.0.113.7:51234", "", "203.0.113.7"},
+		// only trusted proxies may name the client
+		{"203.0.113.7:51234", "198.51.100.1", "203.0.113.7"},
+		{"10.0.0.2:51234", "198.51.100.1", "198.51.100.1"},
+		// the client may prepend anything; the hop the proxy added counts
+		{"10.0.0.2:51234", "192.0.2.1, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"[::ffff:10.0.0.2]:51234", "198.51.100.1", "198.51.100.1"},
+		{"[2001:db8::1]:51234", "", "2001:db8::1"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		if got := handler.clientIP(req); got != tc.want {
+			t.Fatalf("%s via %q: expected %s, got %s", tc.remoteAddr, tc.forwardedFor, tc.want, got)
+		}
+	}
+}
+
+func TestAuthHandlerLogoutIgnoresUnknownTokens(t *testing.T) {
+	client := &testCredentialClient{sessions: map[string]*usersclient.Session{"rt_1": {}}}
+	handler := NewAuthHandler(client, nil)
+
+	for _, token := range []string{"rt_1", "rt_unknown"} {
+		res := httptest.NewRecorder()
+		handler.Logout(res, httptest.NewRequest(http.MethodPost, "/auth/logout", bytes.NewBufferString(`{"refreshToken":"`+token+`"}`)))
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("expected 204 logging out %s, got %d", token, res.Code)
+		}
+	}
+	if len(client.revoked) != 1 || client.revoked[0] != "rt_1" {
+		t.Fatalf("expected rt_1 revoked, got %v", client.revoked)
+	}
+}
+
+func TestSetPasswordHandler(t *testing.T) {
+	client := &testCredentialClient{}
+	userHandler := NewUserHandler(&testClient{})
+	userHandler.UsePolicy(authz.DefaultPolicy())
+	userHandler.UseCredentials(client)
+
+	serve := func(body string, principal *auth.Principal) int {
+		req := withUserID(httptest.NewRequest(http.MethodPut, "/users/"+testUserID+"/password", bytes.NewBufferString(body)))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		res := httptest.NewRecorder()
+		ActorMiddleware(http.HandlerFunc(userHandler.SetPassword)).ServeHTTP(res, req)
+		return res.Code
+	}
+	owner := &auth.Principal{Subject: testUserID, Roles: []string{"user"}}
+	admin := &auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}
+
+	if code := serve(`{"password":"a new long password","currentPassword":"the old one"}`, owner); code != http.StatusOK {
+		t.Fatalf("expected users to change their own password, got %d", code)
+	}
+	if client.passwordInput.CurrentPassword != "the old one" {
+		t.Fatalf("expected the current password passed on, got %+v", client.passwordInput)
+	}
+	if code := serve(`{"password":"a new long password","roles":["admin"]}`, owner); code != http.StatusForbidden {
+		t.Fatalf("expected users not to set their own roles, got %d", code)
+	}
+	if code := serve(`{"password":"a new long password","roles":["support"]}`, admin); code != http.StatusOK {
+		t.Fatalf("expected admins to set roles, got %d", code)
+	}
+	if code := serve(`{}`, admin); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a password, got %d", code)
+	}
+
+	client.passwordErr = fmt.Errorf("%w: current password is wrong", usersclient.ErrUnauthenticated)
+	if code := serve(`{"password":"a new long password","currentPassword":"guess"}`, owner); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong current password, got %d", code)
+	}
+}
+
+func TestUnlockUserHandler(t *testing.T) {
+	client := &testCredentialClient{}
+	userHandler := NewUserHandler(&testClient{})
+	userHandler.UsePolicy(authz.DefaultPolicy())
+	userHandler.UseCredentials(client)
+
+	serve := func(principal *auth.Principal) int {
+		req := withUserID(httptest.NewRequest(http.MethodPost, "/users/"+testUserID+"/unlock", nil))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		res := httptest.NewRecorder()
+		ActorMiddleware(http.HandlerFunc(userHandler.UnlockUser)).ServeHTTP(res, req)
+		return res.Code
+	}
+
+	// locked out users cannot unlock themselves, even with a token still valid
+	if code := serve(&auth.Principal{Subject: testUserID, Roles: []string{"user"}}); code != http.StatusForbidden {
+		t.Fatalf("expected users to be forbidden to unlock their account, got %d", code)
+	}
+	if code := serve(&auth.Principal{Subject: "agent-7", Roles: []string{"support"}}); code != http.StatusForbidden {
+		t.Fatalf("expected support to be forbidden to unlock accounts, got %d", code)
+	}
+	if code := serve(&auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}); code != http.StatusOK {
+		t.Fatalf("expected admins to unlock accounts, got %d", code)
+	}
+	if len(client.unlocked) != 1 || client.unlocked[0] != testUserID {
+		t.Fatalf("expected %s unlocked once, got %v", testUserID, client.unlocked)
+	}
+}
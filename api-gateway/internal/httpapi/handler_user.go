@@ -3,10 +3,16 @@ package httpapi
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
 	"user-service/pkg/usersclient"
 	"user-service/pkg/validation"
 
@@ -17,20 +23,30 @@ import (
 type UserHandler struct {
 	client   usersclient.Client  // interface that defines the methods for interacting with the user service.
 	validate *validator.Validate // validator instance for validating request payloads.
+	policy   *authz.Policy       // roles allowed on each route; nil allows everything
+	// credentials sets passwords; nil until UseCredentials, when the password route is not served.
+	credentials usersclient.CredentialClient
 }
 
-func NewUserHandler(client usersclient.Client) *UserHandler {
-	v := validator.New()
-	_ = validation.RegisterPhone(v)
-
+// NewUserHandler returns the REST handlers; opts configure request validation,
+// e.g. the region national phone numbers are read in.
+func NewUserHandler(client usersclient.Client, opts ...validation.Option) *UserHandler {
 	return &UserHandler{
 		client:   client,
-		validate: v,
+		validate: validation.New(opts...),
 	}
 }
 
+// UseCredentials enables SetPassword.
+func (h *UserHandler) UseCredentials(client usersclient.CredentialClient) {
+	h.credentials = client
+}
+
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	if !h.authorize(w, r, authz.PermUsersWrite, "") {
+		return
+	}
 	var input usersclient.CreateUserInput // empty struct defines the expected fields for creating a user.
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		slog.Info("rest create user invalid body", "method", r.Method, "path", r.URL.Path, "error", err)
@@ -39,16 +55,29 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.validate.Struct(input); err != nil { // validate the input struct fields based on the validation tags defined in the struct
 		slog.Info("rest create user validation failed", "method", r.Method, "path", r.URL.Path, "error", err)
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		writeInvalid(w, "invalid request body", validation.Violations(err))
 		return
 	}
 
-	createdUser, err := h.client.Create(r.Context(), input)
+	ctx, err := idempotencyContext(r)
+	if err != nil {
+		slog.Info("rest create user invalid idempotency key", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	createdUser, err := h.client.Create(ctx, input)
 	if err != nil {
 		slog.Error("rest create user failed", "method", r.Method, "path", r.URL.Path, "error", err)
 		switch {
+		case errors.Is(err, usersclient.ErrConflict):
+			writeConflict(w, err)
 		case errors.Is(err, usersclient.ErrBadRequest):
-			writeError(w, http.StatusBadRequest, err.Error())
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrInProgress):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "internal server error")
 		}
@@ -59,25 +88,313 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, createdUser)
 }
 
+// ImportUsers bulk-creates users from a text/csv or application/x-ndjson body. The mode query
+// parameter picks atomic (default, all or nothing) or partial (create the valid rows).
+func (h *UserHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if !h.authorize(w, r, authz.PermUsersWrite, "") {
+		return
+	}
+	input := usersclient.BulkCreateUsersInput{Mode: r.URL.Query().Get("mode")}
+	if err := h.validate.Struct(input); err != nil {
+		slog.Info("rest import users invalid mode", "method", r.Method, "path", r.URL.Path, "mode", input.Mode)
+		writeInvalid(w, "mode must be atomic or partial", validation.Violations(err))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := http.MaxBytesReader(w, r.Body, maxImportBodyBytes)
+	var err error
+	switch mediaType {
+	case "text/csv":
+		input.Users, err = parseCSVUsers(body)
+	case "application/x-ndjson":
+		input.Users, err = parseNDJSONUsers(body)
+	default:
+		slog.Info("rest import users unsupported media type", "method", r.Method, "path", r.URL.Path, "content_type", r.Header.Get("Content-Type"))
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		slog.Info("rest import users invalid body", "method", r.Method, "path", r.URL.Path, "error", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "import body is too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case len(input.Users) == 0:
+		slog.Info("rest import users empty", "method", r.Method, "path", r.URL.Path)
+		writeError(w, http.StatusBadRequest, "no users to import")
+		return
+	case len(input.Users) > usersclient.MaxBulkCreateRows:
+		slog.Info("rest import users too many rows", "method", r.Method, "path", r.URL.Path, "rows", len(input.Users))
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d users per import", usersclient.MaxBulkCreateRows))
+		return
+	}
+
+	ctx, err := idempotencyContext(r)
+	if err != nil {
+		slog.Info("rest import users invalid idempotency key", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.client.BulkCreate(ctx, input)
+	if err != nil {
+		slog.Error("rest import users failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrConflict):
+			writeConflict(w, err)
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrInProgress):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// 201 when every row was created, 422 when none was, 200 for a partial import
+	status := http.StatusOK
+	switch {
+	case report.Failed == 0:
+		status = http.StatusCreated
+	case report.Created == 0:
+		status = http.StatusUnprocessableEntity
+	}
+	slog.Info("rest import users succeeded", "method", r.Method, "path", r.URL.Path, "mode", report.Mode, "created", report.Created, "failed", report.Failed, "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, status, report)
+}
+
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	users, err := h.client.List(r.Context())
+	// users may look up their own email; findUserByEmail checks the user it finds
+	if email := r.URL.Query().Get("email"); email != "" {
+		h.findUserByEmail(w, r, email, start)
+		return
+	}
+	if !h.authorize(w, r, authz.PermUsersRead, "") {
+		return
+	}
+
+	input, err := parseListUsersQuery(r.URL.Query())
+	if err != nil {
+		slog.Info("rest list users invalid query", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.validate.Struct(input); err != nil { // enforce the allow-lists for status, sort field and order
+		slog.Info("rest list users validation failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeInvalid(w, "invalid filter or sort parameters", validation.Violations(err))
+		return
+	}
+	if input.Filter.IncludeDeleted && !h.authorize(w, r, authz.PermUsersDelete, "") {
+		return
+	}
+
+	page, err := h.client.List(r.Context(), input)
 	if err != nil {
 		slog.Error("rest list users failed", "method", r.Method, "path", r.URL.Path, "error", err)
-		writeError(w, http.StatusInternalServerError, "internal server error")
+		switch {
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest list users succeeded", "method", r.Method, "path", r.URL.Path, "count", len(page.Users), "has_more", page.NextCursor != "", "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, page)
+}
+
+// findUserByEmail serves GET /users?email=: a page holding the user with that email, compared
+// case-insensitively, or an empty page. The other list parameters are ignored.
+func (h *UserHandler) findUserByEmail(w http.ResponseWriter, r *http.Request, email string, start time.Time) {
+	if err := h.validate.Var(email, "email"); err != nil {
+		slog.Info("rest find user by email invalid email", "method", r.Method, "path", r.URL.Path)
+		writeInvalid(w, "email must be a valid email address", []contract.FieldViolation{{Field: "email", Rule: "email"}})
+		return
+	}
+
+	// a user the actor may not read is left out like a missing one, so the
+	// lookup does not tell which emails exist
+	page := &usersclient.UserPage{Users: []usersclient.User{}}
+	found, err := h.client.GetByEmail(r.Context(), email)
+	switch {
+	case err == nil && h.allows(r, authz.PermUsersRead, found.UserID):
+		page.Users = append(page.Users, *found)
+	case err == nil, errors.Is(err, usersclient.ErrNotFound):
+	default:
+		slog.Error("rest find user by email failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest find user by email succeeded", "method", r.Method, "path", r.URL.Path, "count", len(page.Users), "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, page)
+}
+
+// ExportUsers streams every user matching the list filters and sort as csv (default), ndjson
+// or a json array, one page at a time, so the table is never held in memory. The columns
+// query parameter picks and orders the fields. limit and cursor are ignored.
+func (h *UserHandler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if !h.authorize(w, r, authz.PermUsersRead, "") {
+		return
+	}
+	query := r.URL.Query()
+	input, err := parseListUsersQuery(query)
+	if err != nil {
+		slog.Info("rest export users invalid query", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.validate.Struct(input); err != nil {
+		slog.Info("rest export users validation failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeInvalid(w, "invalid filter or sort parameters", validation.Violations(err))
+		return
+	}
+	if input.Filter.IncludeDeleted && !h.authorize(w, r, authz.PermUsersDelete, "") {
+		return
+	}
+	input.Limit, input.Cursor = 0, "" // an export always covers every matching user
+
+	format := query.Get("format")
+	var contentType string
+	switch format {
+	case "", exportFormatCSV:
+		format, contentType = exportFormatCSV, "text/csv; charset=utf-8"
+	case exportFormatNDJSON:
+		contentType = "application/x-ndjson"
+	case exportFormatJSON:
+		contentType = "application/json"
+	default:
+		slog.Info("rest export users invalid format", "method", r.Method, "path", r.URL.Path, "format", format)
+		writeError(w, http.StatusBadRequest, "format must be csv, ndjson or json")
+		return
+	}
+	columns, err := parseExportColumns(query.Get("columns"))
+	if err != nil {
+		slog.Info("rest export users invalid columns", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// headers go out with the first page, so an error before it still gets a proper status
+	var out userRowWriter
+	rows := 0
+	controller := http.NewResponseController(w)
+	err = usersclient.EachPage(r.Context(), h.client, input, func(page *usersclient.UserPage) error {
+		if out == nil {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"users.%s\"", format))
+			w.WriteHeader(http.StatusOK)
+			out = newUserRowWriter(w, format, columns)
+			if err := out.begin(); err != nil {
+				return err
+			}
+		}
+		for _, user := range page.Users {
+			if err := out.write(user); err != nil {
+				return err
+			}
+			rows++
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		err = out.end()
+	}
+	if err != nil {
+		if out == nil {
+			slog.Error("rest export users failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			switch {
+			case errors.Is(err, usersclient.ErrBadRequest):
+				writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+			case errors.Is(err, usersclient.ErrForbidden):
+				writeError(w, http.StatusForbidden, err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, "internal server error")
+			}
+			return
+		}
+		// the 200 is already sent; abort the connection so the client sees a broken
+		// download rather than a complete-looking, truncated file
+		slog.Error("rest export users aborted", "method", r.Method, "path", r.URL.Path, "rows", rows, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	slog.Info("rest export users succeeded", "method", r.Method, "path", r.URL.Path, "format", format, "rows", rows, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if !h.authorize(w, r, authz.PermUsersRead, "") {
+		return
+	}
+	input := usersclient.SearchUsersInput{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		limit, err := strconv.ParseInt(rawLimit, 10, 32)
+		if err != nil || limit <= 0 {
+			slog.Info("rest search users invalid limit", "method", r.Method, "path", r.URL.Path, "limit", rawLimit, "error", err)
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		input.Limit = int32(limit)
+	}
+	if err := h.validate.Struct(input); err != nil {
+		slog.Info("rest search users validation failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeInvalid(w, "q must be between 2 and 100 characters", validation.Violations(err))
+		return
+	}
+
+	results, err := h.client.Search(r.Context(), input)
+	if err != nil {
+		slog.Error("rest search users failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
 		return
 	}
 
-	slog.Info("rest list users succeeded", "method", r.Method, "path", r.URL.Path, "count", len(users), "duration_ms", time.Since(start).Milliseconds())
-	writeJSON(w, http.StatusOK, users)
+	slog.Info("rest search users succeeded", "method", r.Method, "path", r.URL.Path, "count", len(results), "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, usersclient.SearchResults{Results: results})
 }
 
 func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersRead, userID) {
+		return
+	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
 		slog.Info("rest get user validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
-		writeError(w, http.StatusBadRequest, "id must be valid uuid")
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
 		return
 	}
 
@@ -88,7 +405,9 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, usersclient.ErrNotFound):
 			writeError(w, http.StatusNotFound, err.Error())
 		case errors.Is(err, usersclient.ErrBadRequest):
-			writeError(w, http.StatusBadRequest, err.Error())
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "internal server error")
 		}
@@ -96,12 +415,16 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("rest get user succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "duration_ms", time.Since(start).Milliseconds())
+	w.Header().Set("ETag", formatETag(foundUser.Version))
 	writeJSON(w, http.StatusOK, foundUser)
 }
 
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersWrite, userID) {
+		return
+	}
 
 	var input usersclient.UpdateUserInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -115,25 +438,53 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "at least one field is required")
 		return
 	}
+	// status decides who may log in, so users cannot reactivate themselves
+	if input.Status != nil && !h.authorize(w, r, authz.PermUsersWrite, "") {
+		return
+	}
 	if err := h.validate.Struct(input); err != nil {
 		slog.Info("rest update user validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		writeInvalid(w, "invalid request body", validation.Violations(err))
 		return
 	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
 		slog.Info("rest update user id validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
-		writeError(w, http.StatusBadRequest, "id must be valid uuid")
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+	expectedVersion, err := h.expectedVersion(r, userID)
+	if err != nil {
+		slog.Info("rest update user if-match failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeIfMatchError(w, err)
+		return
+	}
+	if expectedVersion != nil {
+		input.ExpectedVersion = expectedVersion // the header takes precedence over a version in the body
+	}
+
+	ctx, err := idempotencyContext(r)
+	if err != nil {
+		slog.Info("rest update user invalid idempotency key", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	updatedUser, err := h.client.Update(r.Context(), userID, input)
+	updatedUser, err := h.client.Update(ctx, userID, input)
 	if err != nil {
 		slog.Error("rest update user failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
 		switch {
+		case errors.Is(err, usersclient.ErrConflict):
+			writeConflict(w, err)
 		case errors.Is(err, usersclient.ErrBadRequest):
-			writeError(w, http.StatusBadRequest, err.Error())
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
 		case errors.Is(err, usersclient.ErrNotFound):
 			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, usersclient.ErrVersionConflict):
+			writeError(w, http.StatusPreconditionFailed, err.Error())
+		case errors.Is(err, usersclient.ErrInProgress):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "internal server error")
 		}
@@ -141,26 +492,49 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Info("rest update user succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "duration_ms", time.Since(start).Milliseconds())
+	w.Header().Set("ETag", formatETag(updatedUser.Version))
 	writeJSON(w, http.StatusOK, updatedUser)
 }
 
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersDelete, userID) {
+		return
+	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
 		slog.Info("rest delete user validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
-		writeError(w, http.StatusBadRequest, "id must be valid uuid")
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+	expectedVersion, err := h.expectedVersion(r, userID)
+	if err != nil {
+		slog.Info("rest delete user if-match failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeIfMatchError(w, err)
 		return
 	}
 
-	err := h.client.Delete(r.Context(), userID)
+	ctx, err := idempotencyContext(r)
+	if err != nil {
+		slog.Info("rest delete user invalid idempotency key", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.client.Delete(ctx, userID, expectedVersion)
 	if err != nil {
 		slog.Error("rest delete user failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
 		switch {
 		case errors.Is(err, usersclient.ErrNotFound):
 			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, usersclient.ErrVersionConflict):
+			writeError(w, http.StatusPreconditionFailed, err.Error())
+		case errors.Is(err, usersclient.ErrInProgress):
+			writeError(w, http.StatusConflict, err.Error())
 		case errors.Is(err, usersclient.ErrBadRequest):
-			writeError(w, http.StatusBadRequest, err.Error())
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "internal server error")
 		}
@@ -170,3 +544,160 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	slog.Info("rest delete user succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "duration_ms", time.Since(start).Milliseconds())
 	writeJSON(w, http.StatusOK, map[string]string{"message": "user deleted"})
 }
+
+// SetPassword sets the user's password. Users changing their own must send their current
+// password; replacing the roles the user logs in with takes users:roles, and the user service
+// refuses roles that grant more than the caller holds.
+func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersWrite, userID) {
+		return
+	}
+	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
+		slog.Info("rest set password validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+
+	var input usersclient.SetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		slog.Info("rest set password invalid body", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if input.Password == "" {
+		slog.Info("rest set password missing password", "method", r.Method, "path", r.URL.Path, "user_id", userID)
+		writeError(w, http.StatusBadRequest, "password is required")
+		return
+	}
+	if input.Roles != nil && !h.authorize(w, r, authz.PermUsersRoles, "") {
+		return
+	}
+
+	credential, err := h.credentials.SetPassword(r.Context(), userID, input)
+	if err != nil {
+		slog.Error("rest set password failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrUnauthenticated):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, usersclient.ErrNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest set password succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, credential)
+}
+
+// UnlockUser lifts a login lockout of the user before it runs out. Only admins may, so the
+// permission is checked for all users rather than the user's own.
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersWrite, "") {
+		return
+	}
+	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
+		slog.Info("rest unlock user validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+
+	result, err := h.credentials.UnlockUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("rest unlock user failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest unlock user succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "was_locked", result.WasLocked, "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersDelete, userID) {
+		return
+	}
+	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
+		slog.Info("rest restore user validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+
+	restoredUser, err := h.client.Restore(r.Context(), userID)
+	if err != nil {
+		slog.Error("rest restore user failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, usersclient.ErrConflict):
+			writeConflict(w, err)
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest restore user succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, restoredUser)
+}
+
+// UserHistory returns a page of the user's audit history, newest first. Deleted users keep their history.
+func (h *UserHandler) UserHistory(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	userID := chi.URLParam(r, "id") // extract the user ID from the URL path parameter.
+	if !h.authorize(w, r, authz.PermUsersRead, userID) {
+		return
+	}
+	if err := h.validate.Struct(usersclient.IDRequest{ID: userID}); err != nil {
+		slog.Info("rest user history validation failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeInvalid(w, "id must be valid uuid", validation.Violations(err))
+		return
+	}
+	input, err := parseHistoryQuery(r.URL.Query())
+	if err != nil {
+		slog.Info("rest user history invalid query", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.client.History(r.Context(), userID, input)
+	if err != nil {
+		slog.Error("rest user history failed", "method", r.Method, "path", r.URL.Path, "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, usersclient.ErrBadRequest):
+			writeInvalid(w, err.Error(), usersclient.FieldViolations(err))
+		case errors.Is(err, usersclient.ErrForbidden):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	slog.Info("rest user history succeeded", "method", r.Method, "path", r.URL.Path, "user_id", userID, "count", len(page.Entries), "duration_ms", time.Since(start).Milliseconds())
+	writeJSON(w, http.StatusOK, page)
+}
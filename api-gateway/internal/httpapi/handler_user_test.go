@@ -4,27 +4,53 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"gotrainingproject/internal/auth"
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
 	"user-service/pkg/usersclient"
+	"user-service/pkg/validation"
 )
 
 const testUserID = "550e8400-e29b-41d4-a716-446655440000"
 
 type testClient struct {
-	createResult *usersclient.User
-	createErr    error
-	listResult   []usersclient.User
-	listErr      error
-	getResult    *usersclient.User
-	getErr       error
+	createResult  *usersclient.User
+	createErr     error
+	createKey     string
+	bulkInput     usersclient.BulkCreateUsersInput
+	bulkResult    *usersclient.BulkCreateReport
+	listResult    *usersclient.UserPage
+	listErr       error
+	listInput     usersclient.ListUsersInput
+	listPages     map[string]*usersclient.UserPage // by cursor; overrides listResult when set
+	getResult     *usersclient.User
+	getErr        error
+	emailLookup   string
+	searchResult  []usersclient.SearchResult
+	searchInput   usersclient.SearchUsersInput
+	restoreResult *usersclient.User
+	restoreErr    error
+	updateInput   usersclient.UpdateUserInput
+	updateErr     error
+	deleteVersion *int32
+	deleteErr     error
+	historyInput  usersclient.HistoryInput
+	historyResult *usersclient.HistoryPage
+	createActor   *contract.Actor
 }
 
 func (c *testClient) Create(ctx context.Context, input usersclient.CreateUserInput) (*usersclient.User, error) {
+	c.createKey = usersclient.IdempotencyKeyFromContext(ctx)
+	c.createActor = usersclient.ActorFromContext(ctx)
 	if c.createErr != nil {
 		return nil, c.createErr
 	}
@@ -34,20 +60,64 @@ func (c *testClient) Create(ctx context.Context, input usersclient.CreateUserInp
 	return &usersclient.User{UserID: testUserID, FirstName: input.FirstName, LastName: input.LastName, Email: input.Email}, nil
 }
 
-func (c *testClient) List(ctx context.Context) ([]usersclient.User, error) {
+func (c *testClient) BulkCreate(ctx context.Context, input usersclient.BulkCreateUsersInput) (*usersclient.BulkCreateReport, error) {
+	c.bulkInput = input
+	if c.bulkResult != nil {
+		return c.bulkResult, nil
+	}
+	report := &usersclient.BulkCreateReport{Mode: input.Mode, Created: len(input.Users)}
+	for i := range input.Users {
+		report.Rows = append(report.Rows, usersclient.BulkCreateRow{Row: i + 1, User: &usersclient.User{Email: input.Users[i].Email}})
+	}
+	return report, nil
+}
+
+func (c *testClient) List(ctx context.Context, input usersclient.ListUsersInput) (*usersclient.UserPage, error) {
+	c.listInput = input
+	if c.listPages != nil {
+		page, ok := c.listPages[input.Cursor]
+		if !ok {
+			return nil, errors.New("unexpected cursor")
+		}
+		return page, nil
+	}
 	return c.listResult, c.listErr
 }
 
+func (c *testClient) Search(ctx context.Context, input usersclient.SearchUsersInput) ([]usersclient.SearchResult, error) {
+	c.searchInput = input
+	return c.searchResult, nil
+}
+
 func (c *testClient) Get(ctx context.Context, userID string) (*usersclient.User, error) {
 	return c.getResult, c.getErr
 }
 
+func (c *testClient) GetByEmail(ctx context.Context, email string) (*usersclient.User, error) {
+	c.emailLookup = email
+	return c.getResult, c.getErr
+}
+
 func (c *testClient) Update(ctx context.Context, userID string, input usersclient.UpdateUserInput) (*usersclient.User, error) {
-	return nil, nil
+	c.updateInput = input
+	if c.updateErr != nil {
+		return nil, c.updateErr
+	}
+	return &usersclient.User{UserID: userID, Version: 2}, nil
 }
 
-func (c *testClient) Delete(ctx context.Context, userID string) error {
-	return nil
+func (c *testClient) Delete(ctx context.Context, userID string, expectedVersion *int32) error {
+	c.deleteVersion = expectedVersion
+	return c.deleteErr
+}
+
+func (c *testClient) Restore(ctx context.Context, userID string) (*usersclient.User, error) {
+	return c.restoreResult, c.restoreErr
+}
+
+func (c *testClient) History(ctx context.Context, userID string, input usersclient.HistoryInput) (*usersclient.HistoryPage, error) {
+	c.historyInput = input
+	return c.historyResult, nil
 }
 
 func TestCreateUserHandlerInvalidJSON(t *testing.T) {
@@ -97,8 +167,31 @@ func TestCreateUserHandlerValidationError(t *testing.T) {
 	}
 }
 
+func TestCreateUserHandlerReadsPhoneInRegion(t *testing.T) {
+	body := `{"firstName":"John","lastName":"Doe","email":"john@example.com","phone":"020 7946 0958"}`
+	for _, tc := range []struct {
+		name   string
+		opts   []validation.Option
+		status int
+	}{
+		{name: "GB region", opts: []validation.Option{validation.WithPhoneRegion("GB")}, status: http.StatusCreated},
+		{name: "US region", opts: []validation.Option{validation.WithPhoneRegion("US")}, status: http.StatusBadRequest},
+		{name: "no region", status: http.StatusBadRequest},
+	} {
+		res := httptest.NewRecorder()
+		NewUserHandler(&testClient{}, tc.opts...).CreateUser(res, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+
+		if res.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d %s", tc.name, tc.status, res.Code, res.Body.String())
+		}
+		if tc.status == http.StatusBadRequest && !strings.Contains(res.Body.String(), `"rule":"phone_e164"`) {
+			t.Fatalf("%s: expected a phone_e164 violation, got %s", tc.name, res.Body.String())
+		}
+	}
+}
+
 func TestListUsersHandlerSuccess(t *testing.T) {
-	handler := NewUserHandler(&testClient{listResult: []usersclient.User{{UserID: testUserID, FirstName: "John"}}})
+	handler := NewUserHandler(&testClient{listResult: &usersclient.UserPage{Users: []usersclient.User{{UserID: testUserID, FirstName: "John"}}}})
 
 	req := httptest.NewRequest(http.MethodGet, "/users", nil)
 	res := httptest.NewRecorder()
@@ -110,6 +203,149 @@ func TestListUsersHandlerSuccess(t *testing.T) {
 	}
 }
 
+func TestListUsersHandlerLooksUpEmail(t *testing.T) {
+	client := &testClient{getResult: &usersclient.User{UserID: testUserID, Email: "Bob@example.com"}}
+	handler := NewUserHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?email=BOB%40Example.com&limit=5", nil)
+	res := httptest.NewRecorder()
+	handler.ListUsers(res, req)
+
+	if res.Code != http.StatusOK || client.emailLookup != "BOB@Example.com" {
+		t.Fatalf("expected 200 after looking up the email, got %d for %q", res.Code, client.emailLookup)
+	}
+	var page usersclient.UserPage
+	if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil || len(page.Users) != 1 || page.Users[0].UserID != testUserID {
+		t.Fatalf("expected a page with the user, got %s", res.Body.String())
+	}
+}
+
+func TestListUsersHandlerEmailLookupMisses(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		err   error
+		code  int
+		body  string
+	}{
+		{query: "email=nobody%40example.com", err: usersclient.ErrNotFound, code: http.StatusOK, body: `"users":[]`},
+		{query: "email=not-an-email", code: http.StatusBadRequest, body: `"field":"email"`},
+	} {
+		res := httptest.NewRecorder()
+		NewUserHandler(&testClient{getErr: tc.err}).ListUsers(res, httptest.NewRequest(http.MethodGet, "/users?"+tc.query, nil))
+
+		if res.Code != tc.code || !strings.Contains(res.Body.String(), tc.body) {
+			t.Fatalf("%s: expected %d with %s, got %d %s", tc.query, tc.code, tc.body, res.Code, res.Body.String())
+		}
+	}
+}
+
+func TestListUsersHandlerPassesPagination(t *testing.T) {
+	client := &testClient{listResult: &usersclient.UserPage{Users: []usersclient.User{}, NextCursor: "next"}}
+	handler := NewUserHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?limit=10&cursor=abc", nil)
+	res := httptest.NewRecorder()
+
+	handler.ListUsers(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if client.listInput.Limit != 10 || client.listInput.Cursor != "abc" {
+		t.Fatalf("expected limit 10 and cursor abc, got %#v", client.listInput)
+	}
+
+	var page usersclient.UserPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if page.NextCursor != "next" {
+		t.Fatalf("expected nextCursor next, got %q", page.NextCursor)
+	}
+}
+
+func TestListUsersHandlerPassesFilterAndSort(t *testing.T) {
+	client := &testClient{listResult: &usersclient.UserPage{Users: []usersclient.User{}}}
+	handler := NewUserHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?status=Inactive&emailDomain=example.com&createdFrom=2025-01-01T00:00:00Z&minAge=18&maxAge=30&sort=lastName&order=asc", nil)
+	res := httptest.NewRecorder()
+
+	handler.ListUsers(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	got := client.listInput
+	if got.Filter.Status != "Inactive" || got.Filter.EmailDomain != "example.com" || got.Filter.CreatedFrom == nil ||
+		got.Filter.MinAge == nil || *got.Filter.MinAge != 18 || got.Filter.MaxAge == nil || *got.Filter.MaxAge != 30 {
+		t.Fatalf("unexpected filter %#v", got.Filter)
+	}
+	if got.Sort.Field != "lastName" || got.Sort.Order != "asc" {
+		t.Fatalf("unexpected sort %#v", got.Sort)
+	}
+}
+
+func TestListUsersHandlerRejectsUnknownSortField(t *testing.T) {
+	handler := NewUserHandler(&testClient{})
+
+	for _, query := range []string{"sort=email", "order=sideways", "status=Deleted", "createdFrom=yesterday"} {
+		req := httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+		res := httptest.NewRecorder()
+
+		handler.ListUsers(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("query %q: expected 400, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestListUsersHandlerInvalidLimit(t *testing.T) {
+	handler := NewUserHandler(&testClient{})
+
+	for _, limit := range []string{"abc", "0", "-5"} {
+		req := httptest.NewRequest(http.MethodGet, "/users?limit="+limit, nil)
+		res := httptest.NewRecorder()
+
+		handler.ListUsers(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("limit %q: expected 400, got %d", limit, res.Code)
+		}
+	}
+}
+
+func TestSearchUsersHandlerSuccess(t *testing.T) {
+	client := &testClient{searchResult: []usersclient.SearchResult{{User: usersclient.User{UserID: testUserID}, Score: 0.8}}}
+	handler := NewUserHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/search?q=jon&limit=5", nil)
+	res := httptest.NewRecorder()
+
+	handler.SearchUsers(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if client.searchInput.Query != "jon" || client.searchInput.Limit != 5 {
+		t.Fatalf("unexpected search input %#v", client.searchInput)
+	}
+}
+
+func TestSearchUsersHandlerRequiresQuery(t *testing.T) {
+	handler := NewUserHandler(&testClient{})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/search?q=+", nil)
+	res := httptest.NewRecorder()
+
+	handler.SearchUsers(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.Code)
+	}
+}
+
 func TestGetUserByIDHandlerNotFound(t *testing.T) {
 	handler := NewUserHandler(&testClient{getErr: fmt.Errorf("%w: missing", usersclient.ErrNotFound)})
 
@@ -125,3 +361,323 @@ func TestGetUserByIDHandlerNotFound(t *testing.T) {
 		t.Fatalf("expected 404, got %d", res.Code)
 	}
 }
+
+func TestRestoreUserHandlerNotFound(t *testing.T) {
+	handler := NewUserHandler(&testClient{restoreErr: fmt.Errorf("%w: user not found", usersclient.ErrNotFound)})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/"+testUserID+"/restore", nil)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", testUserID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+	res := httptest.NewRecorder()
+
+	handler.RestoreUser(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func withUserID(req *http.Request) *http.Request {
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("id", testUserID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+}
+
+func TestGetUserByIDHandlerSetsETag(t *testing.T) {
+	handler := NewUserHandler(&testClient{getResult: &usersclient.User{UserID: testUserID, Version: 7}})
+
+	req := withUserID(httptest.NewRequest(http.MethodGet, "/users/"+testUserID, nil))
+	res := httptest.NewRecorder()
+
+	handler.GetUserByID(res, req)
+
+	if got := res.Header().Get("ETag"); got != `"7"` {
+		t.Fatalf("expected ETag \"7\", got %q", got)
+	}
+}
+
+func TestUpdateUserHandlerIfMatch(t *testing.T) {
+	client := &testClient{}
+	handler := NewUserHandler(client)
+
+	req := withUserID(httptest.NewRequest(http.MethodPatch, "/users/"+testUserID, bytes.NewBufferString(`{"firstName":"Jane"}`)))
+	req.Header.Set("If-Match", `"3"`)
+	res := httptest.NewRecorder()
+
+	handler.UpdateUser(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if client.updateInput.ExpectedVersion == nil || *client.updateInput.ExpectedVersion != 3 {
+		t.Fatalf("expected expected version 3, got %v", client.updateInput.ExpectedVersion)
+	}
+	if got := res.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("expected ETag of the updated user, got %q", got)
+	}
+}
+
+func TestUpdateUserHandlerStaleVersion(t *testing.T) {
+	handler := NewUserHandler(&testClient{updateErr: fmt.Errorf("%w: stale", usersclient.ErrVersionConflict)})
+
+	req := withUserID(httptest.NewRequest(http.MethodPatch, "/users/"+testUserID, bytes.NewBufferString(`{"firstName":"Jane"}`)))
+	req.Header.Set("If-Match", `"3"`)
+	res := httptest.NewRecorder()
+
+	handler.UpdateUser(res, req)
+
+	if res.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d", res.Code)
+	}
+}
+
+func TestDeleteUserHandlerIfMatch(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		status int
+	}{
+		{header: `"4"`, status: http.StatusOK},
+		{header: `W/"3", "4"`, status: http.StatusOK},
+		{header: `"4", "4"`, status: http.StatusOK},
+		// If-Match compares strongly: a weak or foreign ETag is well formed but never matches
+		{header: `W/"4"`, status: http.StatusPreconditionFailed},
+		{header: `"abc"`, status: http.StatusPreconditionFailed},
+		// a list naming several versions holds when the current one is among them
+		{header: `"3", "4"`, status: http.StatusOK},
+		{header: `"2", "3"`, status: http.StatusPreconditionFailed},
+		{header: `4`, status: http.StatusBadRequest},
+		{header: `"4" "5"`, status: http.StatusBadRequest},
+		{header: `"4`, status: http.StatusBadRequest},
+	} {
+		client := &testClient{getResult: &usersclient.User{UserID: testUserID, Version: 4}}
+		handler := NewUserHandler(client)
+
+		req := withUserID(httptest.NewRequest(http.MethodDelete, "/users/"+testUserID, nil))
+		req.Header.Set("If-Match", tc.header)
+		res := httptest.NewRecorder()
+
+		handler.DeleteUser(res, req)
+
+		if res.Code != tc.status {
+			t.Fatalf("If-Match %s: expected %d, got %d", tc.header, tc.status, res.Code)
+		}
+		if tc.status == http.StatusOK && (client.deleteVersion == nil || *client.deleteVersion != 4) {
+			t.Fatalf("expected expected version 4, got %v", client.deleteVersion)
+		}
+	}
+}
+
+func TestCreateUserHandlerIdempotencyKey(t *testing.T) {
+	for _, tc := range []struct {
+		key    string
+		status int
+	}{
+		{key: "", status: http.StatusCreated},
+		{key: "retry-7f3a", status: http.StatusCreated},
+		{key: "has space", status: http.StatusBadRequest},
+		{key: strings.Repeat("k", 256), status: http.StatusBadRequest},
+	} {
+		client := &testClient{}
+		handler := NewUserHandler(client)
+
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+		if tc.key != "" {
+			req.Header.Set("Idempotency-Key", tc.key)
+		}
+		res := httptest.NewRecorder()
+
+		handler.CreateUser(res, req)
+
+		if res.Code != tc.status {
+			t.Fatalf("key %q: expected %d, got %d", tc.key, tc.status, res.Code)
+		}
+		if tc.status == http.StatusCreated && client.createKey != tc.key {
+			t.Fatalf("expected key %q forwarded, got %q", tc.key, client.createKey)
+		}
+	}
+}
+
+func TestCreateUserHandlerIdempotencyInProgress(t *testing.T) {
+	handler := NewUserHandler(&testClient{createErr: fmt.Errorf("%w: still running", usersclient.ErrInProgress)})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+	req.Header.Set("Idempotency-Key", "retry-7f3a")
+	res := httptest.NewRecorder()
+
+	handler.CreateUser(res, req)
+
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", res.Code)
+	}
+}
+
+func TestUserHistoryHandler(t *testing.T) {
+	client := &testClient{historyResult: &usersclient.HistoryPage{
+		Entries: []usersclient.AuditEntry{{
+			ID:      3,
+			UserID:  testUserID,
+			Action:  "updated",
+			Actor:   contract.Actor{ID: "alice", Source: contract.SourceREST},
+			Changes: map[string]contract.FieldChange{"lastName": {Old: "Doe", New: "Roe"}},
+		}},
+		NextCursor: "3",
+	}}
+	handler := NewUserHandler(client)
+
+	req := withUserID(httptest.NewRequest(http.MethodGet, "/users/"+testUserID+"/history?limit=1&cursor=9", nil))
+	res := httptest.NewRecorder()
+
+	handler.UserHistory(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if client.historyInput != (usersclient.HistoryInput{Limit: 1, Cursor: "9"}) {
+		t.Fatalf("unexpected history input %+v", client.historyInput)
+	}
+	if !strings.Contains(res.Body.String(), `"changes":{"lastName":{"old":"Doe","new":"Roe"}}`) || !strings.Contains(res.Body.String(), `"nextCursor":"3"`) {
+		t.Fatalf("unexpected body %s", res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	handler.UserHistory(res, withUserID(httptest.NewRequest(http.MethodGet, "/users/"+testUserID+"/history?limit=0", nil)))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for limit=0, got %d", res.Code)
+	}
+}
+
+func TestActorMiddlewarePrefersPrincipal(t *testing.T) {
+	client := &testClient{}
+	handler := ActorMiddleware(http.HandlerFunc(NewUserHandler(client).CreateUser))
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+	req.Header.Set(ActorHeader, "mallory")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: "user-1", Roles: []string{"admin"}}))
+	res := httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	if want := (contract.Actor{ID: "user-1", Source: contract.SourceREST, Roles: []string{"admin"}}); client.createActor == nil || !reflect.DeepEqual(*client.createActor, want) {
+		t.Fatalf("expected the principal as actor, got %+v", client.createActor)
+	}
+}
+
+func TestActorMiddlewareForwardsActor(t *testing.T) {
+	client := &testClient{}
+	handler := ActorMiddleware(http.HandlerFunc(NewUserHandler(client).CreateUser))
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+	req.Header.Set(ActorHeader, "alice")
+	res := httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", res.Code)
+	}
+	if want := (contract.Actor{ID: "alice", Source: contract.SourceREST}); client.createActor == nil || !reflect.DeepEqual(*client.createActor, want) {
+		t.Fatalf("expected actor %+v, got %+v", want, client.createActor)
+	}
+}
+
+func TestUserHandlerEnforcesPolicy(t *testing.T) {
+	client := &testClient{getResult: &usersclient.User{UserID: testUserID, Version: 1}}
+	userHandler := NewUserHandler(client)
+	userHandler.UsePolicy(authz.DefaultPolicy())
+
+	serve := func(route http.HandlerFunc, method, body string, principal *auth.Principal) int {
+		req := withUserID(httptest.NewRequest(method, "/users/"+testUserID, bytes.NewBufferString(body)))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		res := httptest.NewRecorder()
+		ActorMiddleware(route).ServeHTTP(res, req)
+		return res.Code
+	}
+	support := &auth.Principal{Subject: "agent-7", Roles: []string{"support"}}
+	owner := &auth.Principal{Subject: testUserID, Roles: []string{"user"}}
+	other := &auth.Principal{Subject: "someone-else", Roles: []string{"user"}}
+
+	for _, tc := range []struct {
+		name      string
+		route     http.HandlerFunc
+		method    string
+		body      string
+		principal *auth.Principal
+		want      int
+	}{
+		{"support reads", userHandler.GetUserByID, http.MethodGet, "", support, http.StatusOK},
+		{"support cannot delete", userHandler.DeleteUser, http.MethodDelete, "", support, http.StatusForbidden},
+		{"support cannot edit", userHandler.UpdateUser, http.MethodPatch, `{"lastName":"Roe"}`, support, http.StatusForbidden},
+		{"user edits own record", userHandler.UpdateUser, http.MethodPatch, `{"lastName":"Roe"}`, owner, http.StatusOK},
+		{"user cannot reactivate self", userHandler.UpdateUser, http.MethodPatch, `{"status":"Active"}`, owner, http.StatusForbidden},
+		{"user cannot edit others", userHandler.UpdateUser, http.MethodPatch, `{"lastName":"Roe"}`, other, http.StatusForbidden},
+		{"user cannot list", userHandler.ListUsers, http.MethodGet, "", owner, http.StatusForbidden},
+	} {
+		if got := serve(tc.route, tc.method, tc.body, tc.principal); got != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestListUsersHandlerEmailLookupHidesUsersTheActorMayNotRead(t *testing.T) {
+	userHandler := NewUserHandler(&testClient{getResult: &usersclient.User{UserID: testUserID, Email: "bob@example.com"}})
+	userHandler.UsePolicy(authz.DefaultPolicy())
+
+	lookup := func(principal *auth.Principal) string {
+		req := httptest.NewRequest(http.MethodGet, "/users?email=bob%40example.com", nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		res := httptest.NewRecorder()
+		ActorMiddleware(http.HandlerFunc(userHandler.ListUsers)).ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", principal.Subject, res.Code)
+		}
+		return res.Body.String()
+	}
+
+	if body := lookup(&auth.Principal{Subject: testUserID, Roles: []string{"user"}}); !strings.Contains(body, testUserID) {
+		t.Fatalf("expected users to find their own email, got %s", body)
+	}
+	// answered like an unknown email, not with a 403 that confirms the email exists
+	if body := lookup(&auth.Principal{Subject: "someone-else", Roles: []string{"user"}}); !strings.Contains(body, `"users":[]`) {
+		t.Fatalf("expected another user's email to find nobody, got %s", body)
+	}
+}
+
+func TestListUsersHandlerIncludeDeletedNeedsDeletePermission(t *testing.T) {
+	userHandler := NewUserHandler(&testClient{listResult: &usersclient.UserPage{Users: []usersclient.User{}}})
+	userHandler.UsePolicy(authz.DefaultPolicy())
+
+	serve := func(route http.HandlerFunc, target string, principal *auth.Principal) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		res := httptest.NewRecorder()
+		ActorMiddleware(route).ServeHTTP(res, req)
+		return res.Code
+	}
+	support := &auth.Principal{Subject: "agent-7", Roles: []string{"support"}}
+	admin := &auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}
+
+	if code := serve(userHandler.ListUsers, "/users", support); code != http.StatusOK {
+		t.Fatalf("expected support to list users, got %d", code)
+	}
+	if code := serve(userHandler.ListUsers, "/users?includeDeleted=true", support); code != http.StatusForbidden {
+		t.Fatalf("expected support to be forbidden to list deleted users, got %d", code)
+	}
+	if code := serve(userHandler.ExportUsers, "/users:export?includeDeleted=true", support); code != http.StatusForbidden {
+		t.Fatalf("expected support to be forbidden to export deleted users, got %d", code)
+	}
+	if code := serve(userHandler.ListUsers, "/users?includeDeleted=true", admin); code != http.StatusOK {
+		t.Fatalf("expected admins to list deleted users, got %d", code)
+	}
+}
+
+func TestDeleteUserHandlerServiceForbidden(t *testing.T) {
+	handler := NewUserHandler(&testClient{deleteErr: usersclient.NewCommandError(contract.CommandError{Code: "FORBIDDEN", Message: "bad actor signature"})})
+
+	res := httptest.NewRecorder()
+	handler.DeleteUser(res, withUserID(httptest.NewRequest(http.MethodDelete, "/users/"+testUserID, nil)))
+
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", res.Code)
+	}
+}
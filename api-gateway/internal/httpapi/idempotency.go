@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"user-service/pkg/usersclient"
+)
+
+const maxIdempotencyKeyLen = 255
+
+var errInvalidIdempotencyKey = errors.New("Idempotency-Key must be 1-255 printable ASCII characters")
+
+// idempotencyContext carries the request's Idempotency-Key header, if any, to the users client.
+func idempotencyContext(r *http.Request) (context.Context, error) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		return r.Context(), nil
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return nil, errInvalidIdempotencyKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return nil, errInvalidIdempotencyKey
+		}
+	}
+	return usersclient.WithIdempotencyKey(r.Context(), key), nil
+}
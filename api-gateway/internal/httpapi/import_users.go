@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"user-service/pkg/usersclient"
+)
+
+// maxImportBodyBytes keeps an import, once re-encoded as a command, under the default NATS payload limit.
+const maxImportBodyBytes = 1 << 20
+
+// csvImportColumns are the header names an import CSV may use, one per CreateUserInput field.
+var csvImportColumns = []string{"firstName", "lastName", "email", "phone", "age", "status"}
+
+// parseCSVUsers reads users from CSV with a header row naming the columns, in any order.
+// firstName, lastName and email are required columns; empty cells are left unset.
+func parseCSVUsers(body io.Reader) ([]usersclient.CreateUserInput, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv header row is missing")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // spreadsheets like to add a BOM
+		if !slices.Contains(csvImportColumns, name) {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate csv column %q", name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+	for _, required := range []string{"firstName", "lastName", "email"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("csv column %q is required", required)
+		}
+	}
+
+	var users []usersclient.CreateUserInput
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return users, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		var input usersclient.CreateUserInput
+		for i, value := range record {
+			if err := setCSVField(&input, header[i], strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		users = append(users, input)
+	}
+}
+
+func setCSVField(input *usersclient.CreateUserInput, column, value string) error {
+	switch column {
+	case "firstName":
+		input.FirstName = value
+	case "lastName":
+		input.LastName = value
+	case "email":
+		input.Email = value
+	case "phone":
+		input.Phone = value
+	case "status":
+		input.Status = value
+	case "age":
+		if value == "" {
+			return nil
+		}
+		age, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return errors.New("age must be an integer")
+		}
+		age32 := int32(age)
+		input.Age = &age32
+	}
+	return nil
+}
+
+// parseNDJSONUsers reads one JSON user object per line; blank lines are skipped.
+func parseNDJSONUsers(body io.Reader) ([]usersclient.CreateUserInput, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportBodyBytes)
+
+	var users []usersclient.CreateUserInput
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var input usersclient.CreateUserInput
+		if err := json.Unmarshal(raw, &input); err != nil {
+			return nil, fmt.Errorf("line %d: invalid json object", line)
+		}
+		users = append(users, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid ndjson: %w", err)
+	}
+	return users, nil
+}
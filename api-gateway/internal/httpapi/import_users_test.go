@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"user-service/pkg/usersclient"
+)
+
+func TestImportUsersHandlerCSV(t *testing.T) {
+	client := &testClient{}
+	handler := NewUserHandler(client)
+
+	body := "email,firstName,lastName,age\n" +
+		"john@example.com, John,Doe,42\n" +
+		"\"jane@example.com\",Jane,\"Doe, Jr\",\n"
+	req := httptest.NewRequest(http.MethodPost, "/users:import?mode=partial", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	res := httptest.NewRecorder()
+
+	handler.ImportUsers(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	got := client.bulkInput
+	if got.Mode != usersclient.BulkModePartial || len(got.Users) != 2 {
+		t.Fatalf("unexpected bulk input %+v", got)
+	}
+	if got.Users[0].FirstName != "John" || got.Users[0].Age == nil || *got.Users[0].Age != 42 {
+		t.Fatalf("unexpected first row %+v", got.Users[0])
+	}
+	if got.Users[1].LastName != "Doe, Jr" || got.Users[1].Age != nil {
+		t.Fatalf("unexpected second row %+v", got.Users[1])
+	}
+}
+
+func TestImportUsersHandlerNDJSON(t *testing.T) {
+	client := &testClient{}
+	handler := NewUserHandler(client)
+
+	body := `{"firstName":"John","lastName":"Doe","email":"john@example.com"}` + "\n\n" +
+		`{"firstName":"Jane","lastName":"Doe","email":"jane@example.com","status":"Inactive"}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/users:import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res := httptest.NewRecorder()
+
+	handler.ImportUsers(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	if len(client.bulkInput.Users) != 2 || client.bulkInput.Users[1].Status != "Inactive" {
+		t.Fatalf("unexpected bulk input %+v", client.bulkInput)
+	}
+}
+
+func TestImportUsersHandlerRejectsBadInput(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "unknown mode", url: "/users:import?mode=some", contentType: "text/csv", body: "firstName,lastName,email\n", status: http.StatusBadRequest},
+		{name: "json body", url: "/users:import", contentType: "application/json", body: "[]", status: http.StatusUnsupportedMediaType},
+		{name: "unknown column", url: "/users:import", contentType: "text/csv", body: "firstName,lastName,email,nickname\n", status: http.StatusBadRequest},
+		{name: "missing column", url: "/users:import", contentType: "text/csv", body: "firstName,email\nJohn,john@example.com\n", status: http.StatusBadRequest},
+		{name: "bad age", url: "/users:import", contentType: "text/csv", body: "firstName,lastName,email,age\nJohn,Doe,john@example.com,old\n", status: http.StatusBadRequest},
+		{name: "short record", url: "/users:import", contentType: "text/csv", body: "firstName,lastName,email\nJohn,Doe\n", status: http.StatusBadRequest},
+		{name: "no rows", url: "/users:import", contentType: "text/csv", body: "firstName,lastName,email\n", status: http.StatusBadRequest},
+		{name: "bad json line", url: "/users:import", contentType: "application/x-ndjson", body: "{\"firstName\":\n", status: http.StatusBadRequest},
+		{name: "too many rows", url: "/users:import", contentType: "application/x-ndjson", body: strings.Repeat("{}\n", usersclient.MaxBulkCreateRows+1), status: http.StatusRequestEntityTooLarge},
+	} {
+		client := &testClient{}
+		handler := NewUserHandler(client)
+
+		req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		res := httptest.NewRecorder()
+
+		handler.ImportUsers(res, req)
+
+		if res.Code != tc.status {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.status, res.Code, res.Body.String())
+		}
+		if client.bulkInput.Users != nil {
+			t.Fatalf("%s: expected no bulk create call", tc.name)
+		}
+	}
+}
+
+func TestImportUsersHandlerReportStatus(t *testing.T) {
+	for _, tc := range []struct {
+		created, failed int
+		status          int
+	}{
+		{created: 2, failed: 0, status: http.StatusCreated},
+		{created: 1, failed: 1, status: http.StatusOK},
+		{created: 0, failed: 2, status: http.StatusUnprocessableEntity},
+	} {
+		handler := NewUserHandler(&testClient{bulkResult: &usersclient.BulkCreateReport{Created: tc.created, Failed: tc.failed}})
+
+		req := httptest.NewRequest(http.MethodPost, "/users:import", strings.NewReader("firstName,lastName,email\nJohn,Doe,john@example.com\nJane,Doe,jane@example.com\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		res := httptest.NewRecorder()
+
+		handler.ImportUsers(res, req)
+
+		if res.Code != tc.status {
+			t.Fatalf("created %d failed %d: expected %d, got %d", tc.created, tc.failed, tc.status, res.Code)
+		}
+	}
+}
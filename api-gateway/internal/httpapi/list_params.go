@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"user-service/pkg/usersclient"
+)
+
+// parseListUsersQuery reads the GET /users query string into a ListUsersInput.
+// It only checks that values are well formed; the allow-lists live on the input's validate tags.
+func parseListUsersQuery(values url.Values) (usersclient.ListUsersInput, error) {
+	input := usersclient.ListUsersInput{
+		Cursor: values.Get("cursor"),
+		Filter: usersclient.ListUsersFilter{
+			Status:      values.Get("status"),
+			EmailDomain: values.Get("emailDomain"),
+		},
+		Sort: usersclient.ListUsersSort{
+			Field: values.Get("sort"),
+			Order: values.Get("order"),
+		},
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || limit <= 0 {
+			return input, errors.New("limit must be a positive integer")
+		}
+		input.Limit = int32(limit)
+	}
+
+	if raw := values.Get("includeDeleted"); raw != "" {
+		includeDeleted, err := strconv.ParseBool(raw)
+		if err != nil {
+			return input, errors.New("includeDeleted must be true or false")
+		}
+		input.Filter.IncludeDeleted = includeDeleted
+	}
+
+	var err error
+	if input.Filter.CreatedFrom, err = parseTimeParam(values, "createdFrom"); err != nil {
+		return input, err
+	}
+	if input.Filter.CreatedTo, err = parseTimeParam(values, "createdTo"); err != nil {
+		return input, err
+	}
+	if input.Filter.MinAge, err = parseAgeParam(values, "minAge"); err != nil {
+		return input, err
+	}
+	if input.Filter.MaxAge, err = parseAgeParam(values, "maxAge"); err != nil {
+		return input, err
+	}
+
+	return input, nil
+}
+
+// parseHistoryQuery reads the GET /users/{id}/history query string into a HistoryInput.
+func parseHistoryQuery(values url.Values) (usersclient.HistoryInput, error) {
+	input := usersclient.HistoryInput{Cursor: values.Get("cursor")}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || limit <= 0 {
+			return input, errors.New("limit must be a positive integer")
+		}
+		input.Limit = int32(limit)
+	}
+	return input, nil
+}
+
+func parseTimeParam(values url.Values, name string) (*time.Time, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, errors.New(name + " must be an RFC 3339 timestamp")
+	}
+	return &parsed, nil
+}
+
+func parseAgeParam(values url.Values, name string) (*int32, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	age, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil || age <= 0 {
+		return nil, errors.New(name + " must be a positive integer")
+	}
+	out := int32(age)
+	return &out, nil
+}
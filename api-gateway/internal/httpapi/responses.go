@@ -2,12 +2,32 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem types; about:blank means the status code says it all (RFC 7807, section 4.2).
+const (
+	problemTypeBlank      = "about:blank"
+	problemTypeValidation = "/problems/validation"
+	problemTypeConflict   = "/problems/conflict"
 )
 
-type errorResponse struct {
-	Message string `json:"message"`
+// problem is an RFC 7807 error body. Reason and Violations are extension members: a
+// machine-readable cause for conflicts, and the fields that failed validation.
+type problem struct {
+	Type       string                    `json:"type"`
+	Title      string                    `json:"title"`
+	Status     int                       `json:"status"`
+	Detail     string                    `json:"detail,omitempty"`
+	Reason     string                    `json:"reason,omitempty"`
+	Violations []contract.FieldViolation `json:"violations,omitempty"`
 }
 
 // helper functions to write the HTTP JSON payload with status code
@@ -24,5 +44,40 @@ func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
 
 // write an error response with the given status code and message
 func writeError(w http.ResponseWriter, statusCode int, message string) {
-	writeJSON(w, statusCode, errorResponse{Message: message})
+	writeProblem(w, problem{Type: problemTypeBlank, Title: http.StatusText(statusCode), Status: statusCode, Detail: message})
+}
+
+// writeInvalid writes a 400; when violations are known it uses the validation problem type
+// so clients can point at the offending fields.
+func writeInvalid(w http.ResponseWriter, message string, violations []contract.FieldViolation) {
+	if len(violations) == 0 {
+		writeError(w, http.StatusBadRequest, message)
+		return
+	}
+	writeProblem(w, problem{
+		Type:       problemTypeValidation,
+		Title:      "Request validation failed",
+		Status:     http.StatusBadRequest,
+		Detail:     message,
+		Violations: violations,
+	})
+}
+
+// writeConflict writes a 409 carrying the service's conflict reason, e.g. email_taken.
+func writeConflict(w http.ResponseWriter, err error) {
+	body := problem{Type: problemTypeConflict, Title: http.StatusText(http.StatusConflict), Status: http.StatusConflict, Detail: err.Error()}
+	var commandErr *usersclient.CommandError
+	if errors.As(err, &commandErr) {
+		body.Reason = commandErr.Reason
+	}
+	writeProblem(w, body)
+}
+
+func writeProblem(w http.ResponseWriter, body problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(body.Status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("failed to encode problem response", "status_code", body.Status, "error", err)
+	}
 }
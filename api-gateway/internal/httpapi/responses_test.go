@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+func decodeProblem(t *testing.T, res *httptest.ResponseRecorder) problem {
+	t.Helper()
+	if got := res.Header().Get("Content-Type"); got != problemContentType {
+		t.Fatalf("expected %s, got %q", problemContentType, got)
+	}
+	var body problem
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return body
+}
+
+func TestCreateUserHandlerReportsViolations(t *testing.T) {
+	handler := NewUserHandler(&testClient{})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"J","lastName":"Doe","email":"bad-email","age":-3}`))
+	res := httptest.NewRecorder()
+
+	handler.CreateUser(res, req)
+
+	body := decodeProblem(t, res)
+	want := []contract.FieldViolation{
+		{Field: "firstName", Rule: "min", Param: "2"},
+		{Field: "email", Rule: "email"},
+		{Field: "age", Rule: "gt", Param: "0"},
+	}
+	if body.Status != http.StatusBadRequest || body.Type != problemTypeValidation || !reflect.DeepEqual(body.Violations, want) {
+		t.Fatalf("unexpected problem %+v", body)
+	}
+}
+
+func TestCreateUserHandlerForwardsServiceViolations(t *testing.T) {
+	serviceErr := usersclient.NewCommandError(contract.CommandError{Code: "BAD_REQUEST", Message: "invalid create payload", Violations: []contract.FieldViolation{{Field: "phone", Rule: "phone_e164"}}})
+	handler := NewUserHandler(&testClient{createErr: serviceErr})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+	res := httptest.NewRecorder()
+
+	handler.CreateUser(res, req)
+
+	body := decodeProblem(t, res)
+	if res.Code != http.StatusBadRequest || len(body.Violations) != 1 || body.Violations[0].Field != "phone" {
+		t.Fatalf("expected the phone violation, got %d %+v", res.Code, body)
+	}
+}
+
+func TestGetUserByIDHandlerNotFoundProblem(t *testing.T) {
+	handler := NewUserHandler(&testClient{getErr: usersclient.ErrNotFound})
+
+	req := withUserID(httptest.NewRequest(http.MethodGet, "/users/"+testUserID, nil))
+	res := httptest.NewRecorder()
+
+	handler.GetUserByID(res, req)
+
+	body := decodeProblem(t, res)
+	if body.Type != problemTypeBlank || body.Title != "Not Found" || body.Status != http.StatusNotFound || body.Violations != nil {
+		t.Fatalf("unexpected problem %+v", body)
+	}
+}
+
+func TestCreateUserHandlerEmailTaken(t *testing.T) {
+	serviceErr := usersclient.NewCommandError(contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonEmailTaken, Message: "email already exists"})
+	handler := NewUserHandler(&testClient{createErr: serviceErr})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`))
+	res := httptest.NewRecorder()
+
+	handler.CreateUser(res, req)
+
+	body := decodeProblem(t, res)
+	if res.Code != http.StatusConflict || body.Type != problemTypeConflict || body.Reason != contract.ConflictReasonEmailTaken {
+		t.Fatalf("expected a 409 email_taken problem, got %d %+v", res.Code, body)
+	}
+}
+
+func TestUpdateUserHandlerVersionMismatchStays412(t *testing.T) {
+	serviceErr := usersclient.NewCommandError(contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonVersionMismatch, Message: "stale"})
+	handler := NewUserHandler(&testClient{updateErr: serviceErr})
+
+	req := withUserID(httptest.NewRequest(http.MethodPatch, "/users/"+testUserID, bytes.NewBufferString(`{"firstName":"Johnny"}`)))
+	res := httptest.NewRecorder()
+
+	handler.UpdateUser(res, req)
+
+	if res.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d", res.Code)
+	}
+}
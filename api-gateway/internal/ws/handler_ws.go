@@ -6,7 +6,11 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 
+	"gotrainingproject/internal/httpapi"
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
 	"user-service/pkg/usersclient"
 	"user-service/pkg/validation"
 
@@ -19,27 +23,43 @@ type Handler struct {
 	hub      *Hub
 	upgrader websocket.Upgrader
 	validate *validator.Validate
+	policy   *authz.Policy // roles allowed each action; nil allows everything
 }
 
-func NewHandler(client usersclient.Client, hub *Hub) *Handler {
-	v := validator.New()
-	_ = validation.RegisterPhone(v)
-
+// NewHandler returns the WebSocket handler; opts configure payload validation.
+func NewHandler(client usersclient.Client, hub *Hub, opts ...validation.Option) *Handler {
 	return &Handler{
 		client:   client,
 		hub:      hub,
 		upgrader: websocket.Upgrader{},
-		validate: v,
+		validate: validation.New(opts...),
 	}
 }
 
+// UsePolicy makes every action, and every event sent, check the connection's actor against
+// policy. Without a policy all actions are allowed.
+func (h *Handler) UsePolicy(policy *authz.Policy) {
+	h.policy = policy
+}
+
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("ws upgrade failed", "path", r.URL.Path, "error", err)
 		return
 	}
-	client := h.hub.register(conn)
+
+	// actions over the socket are attributed to, and authorized for, whoever authenticated the upgrade
+	actor := httpapi.RequestActor(r, contract.SourceWS)
+	ctx := usersclient.WithActor(r.Context(), actor)
+
+	var readable func(userID string) bool
+	if h.policy != nil {
+		readable = func(userID string) bool {
+			return h.policy.Allows(actor, authz.PermUsersRead, userID)
+		}
+	}
+	client := h.hub.register(conn, readable)
 	slog.Info("ws client connected", "remote_addr", conn.RemoteAddr().String())
 	defer h.hub.unregister(client)
 
@@ -61,7 +81,12 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 		slog.Info("ws action received", "remote_addr", conn.RemoteAddr().String(), "action", req.Action, "request_id", req.RequestID)
 
-		resp := h.process(r.Context(), req)
+		var resp ResponseMessage
+		if req.Action == "user.watch" { // the only action that changes the connection rather than a user
+			resp = watch(client, req)
+		} else {
+			resp = h.process(ctx, req)
+		}
 		if shouldWriteDirectResponse(req.Action, resp) {
 			if err := client.writeJSON(resp); err != nil {
 				slog.Error("ws write direct response failed", "remote_addr", conn.RemoteAddr().String(), "action", req.Action, "request_id", req.RequestID, "error", err)
@@ -71,12 +96,29 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// actionPermissions is the permission each user action needs.
+var actionPermissions = map[string]authz.Permission{
+	"user.create": authz.PermUsersWrite,
+	"user.list":   authz.PermUsersRead,
+	"user.search": authz.PermUsersRead,
+	"user.get":    authz.PermUsersRead,
+	"user.update": authz.PermUsersWrite,
+	"user.delete": authz.PermUsersDelete,
+}
+
 func (h *Handler) process(ctx context.Context, req RequestMessage) ResponseMessage {
+	if permission, known := actionPermissions[req.Action]; known && !h.allowed(ctx, req, permission) {
+		slog.Info("ws action forbidden", "action", req.Action, "request_id", req.RequestID, "permission", permission)
+		return fail(req.RequestID, "forbidden", "missing permission "+string(permission))
+	}
+
 	switch req.Action {
 	case "user.create":
 		return h.create(ctx, req)
 	case "user.list":
 		return h.list(ctx, req)
+	case "user.search":
+		return h.search(ctx, req)
 	case "user.get":
 		return h.get(ctx, req)
 	case "user.update":
@@ -88,13 +130,28 @@ func (h *Handler) process(ctx context.Context, req RequestMessage) ResponseMessa
 	}
 }
 
+// allowed reports whether the connection's actor holds permission for req; the user an
+// action targets is the id in its payload, so users may act on their own record.
+func (h *Handler) allowed(ctx context.Context, req RequestMessage, permission authz.Permission) bool {
+	if h.policy == nil {
+		return true
+	}
+	actor := usersclient.ActorFromContext(ctx)
+	if actor == nil {
+		return false
+	}
+	var target IDPayload
+	_ = json.Unmarshal(req.Payload, &target) // an invalid payload is reported by the action
+	return h.policy.Allows(*actor, permission, target.ID)
+}
+
 func (h *Handler) create(ctx context.Context, req RequestMessage) ResponseMessage {
 	var input usersclient.CreateUserInput // empty struct defines the expected fields for creating a user.
 	if err := json.Unmarshal(req.Payload, &input); err != nil {
 		return fail(req.RequestID, "bad_request", "invalid payload")
 	}
 	if err := h.validate.Struct(input); err != nil { // It checks input struct fields against validate tags in model
-		return fail(req.RequestID, "bad_request", "invalid payload")
+		return failInvalid(req.RequestID, "invalid payload", validation.Violations(err))
 	}
 
 	data, err := h.client.Create(ctx, input)
@@ -106,7 +163,24 @@ func (h *Handler) create(ctx context.Context, req RequestMessage) ResponseMessag
 }
 
 func (h *Handler) list(ctx context.Context, req RequestMessage) ResponseMessage {
-	data, err := h.client.List(ctx)
+	var payload ListPayload
+	if len(req.Payload) > 0 { // the payload is optional for list; omit it to get the first page
+		if err := json.Unmarshal(req.Payload, &payload); err != nil {
+			return fail(req.RequestID, "bad_request", "invalid payload")
+		}
+	}
+
+	input := usersclient.ListUsersInput{Limit: payload.Limit, Cursor: payload.Cursor, Filter: payload.Filter, Sort: payload.Sort}
+	if err := h.validate.Struct(input); err != nil {
+		return failInvalid(req.RequestID, "invalid list payload", validation.Violations(err))
+	}
+	// soft-deleted users are for those who may restore them
+	if input.Filter.IncludeDeleted && !h.allowed(ctx, req, authz.PermUsersDelete) {
+		slog.Info("ws action forbidden", "action", req.Action, "request_id", req.RequestID, "permission", authz.PermUsersDelete)
+		return fail(req.RequestID, "forbidden", "missing permission "+string(authz.PermUsersDelete))
+	}
+
+	data, err := h.client.List(ctx, input)
 	if err != nil {
 		return failFromError(req.RequestID, err)
 	}
@@ -114,13 +188,32 @@ func (h *Handler) list(ctx context.Context, req RequestMessage) ResponseMessage
 	return ok(req.RequestID, data)
 }
 
+func (h *Handler) search(ctx context.Context, req RequestMessage) ResponseMessage {
+	var payload SearchPayload
+	if err := json.Unmarshal(req.Payload, &payload); err != nil {
+		return fail(req.RequestID, "bad_request", "invalid payload")
+	}
+
+	input := usersclient.SearchUsersInput{Query: strings.TrimSpace(payload.Query), Limit: payload.Limit}
+	if err := h.validate.Struct(input); err != nil {
+		return failInvalid(req.RequestID, "query must be between 2 and 100 characters", validation.Violations(err))
+	}
+
+	results, err := h.client.Search(ctx, input)
+	if err != nil {
+		return failFromError(req.RequestID, err)
+	}
+
+	return ok(req.RequestID, usersclient.SearchResults{Results: results})
+}
+
 func (h *Handler) get(ctx context.Context, req RequestMessage) ResponseMessage {
 	var payload IDPayload
 	if err := json.Unmarshal(req.Payload, &payload); err != nil {
 		return fail(req.RequestID, "bad_request", "invalid payload")
 	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: payload.ID}); err != nil {
-		return fail(req.RequestID, "bad_request", "id must be valid uuid")
+		return failInvalid(req.RequestID, "id must be valid uuid", validation.Violations(err))
 	}
 
 	data, err := h.client.Get(ctx, payload.ID)
@@ -144,16 +237,23 @@ func (h *Handler) update(ctx context.Context, req RequestMessage) ResponseMessag
 		Phone:     payload.Phone,
 		Age:       payload.Age,
 		Status:    payload.Status,
+
+		ExpectedVersion: payload.ExpectedVersion,
 	}
 	if input.FirstName == nil && input.LastName == nil && input.Email == nil &&
 		input.Phone == nil && input.Age == nil && input.Status == nil {
 		return fail(req.RequestID, "bad_request", "at least one field is required")
 	}
+	// status decides who may log in, so users cannot reactivate themselves
+	if input.Status != nil && !h.allowed(ctx, RequestMessage{RequestID: req.RequestID}, authz.PermUsersWrite) {
+		slog.Info("ws action forbidden", "action", req.Action, "request_id", req.RequestID, "permission", authz.PermUsersWrite)
+		return fail(req.RequestID, "forbidden", "missing permission "+string(authz.PermUsersWrite))
+	}
 	if err := h.validate.Struct(input); err != nil {
-		return fail(req.RequestID, "bad_request", "invalid payload")
+		return failInvalid(req.RequestID, "invalid payload", validation.Violations(err))
 	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: payload.ID}); err != nil {
-		return fail(req.RequestID, "bad_request", "id must be valid uuid")
+		return failInvalid(req.RequestID, "id must be valid uuid", validation.Violations(err))
 	}
 
 	data, err := h.client.Update(ctx, payload.ID, input)
@@ -165,15 +265,19 @@ func (h *Handler) update(ctx context.Context, req RequestMessage) ResponseMessag
 }
 
 func (h *Handler) delete(ctx context.Context, req RequestMessage) ResponseMessage {
-	var payload IDPayload
+	var payload DeletePayload
 	if err := json.Unmarshal(req.Payload, &payload); err != nil {
 		return fail(req.RequestID, "bad_request", "invalid payload")
 	}
 	if err := h.validate.Struct(usersclient.IDRequest{ID: payload.ID}); err != nil {
-		return fail(req.RequestID, "bad_request", "id must be valid uuid")
+		return failInvalid(req.RequestID, "id must be valid uuid", validation.Violations(err))
 	}
 
-	err := h.client.Delete(ctx, payload.ID)
+	if payload.ExpectedVersion != nil && *payload.ExpectedVersion <= 0 {
+		return fail(req.RequestID, "bad_request", "expectedVersion must be positive")
+	}
+
+	err := h.client.Delete(ctx, payload.ID, payload.ExpectedVersion)
 	if err != nil {
 		return failFromError(req.RequestID, err)
 	}
@@ -181,6 +285,36 @@ func (h *Handler) delete(ctx context.Context, req RequestMessage) ResponseMessag
 	return ok(req.RequestID, map[string]string{"message": "user deleted"})
 }
 
+// watchableFields are the user fields a user.updated event can report as changed. deletedAt
+// is not one: it changes only by deleting or restoring, whose events carry no changes.
+var watchableFields = map[string]bool{
+	"firstName": true, "lastName": true, "email": true, "phone": true,
+	"phoneRaw": true, "age": true, "status": true,
+}
+
+// watch limits the user.updated events the client receives to those changing one of the
+// payload's fields; an empty list receives every update again. Other events, such as
+// user.deleted and user.restored, are not filtered.
+func watch(client *clientConn, req RequestMessage) ResponseMessage {
+	var payload WatchPayload
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &payload); err != nil {
+			return fail(req.RequestID, "bad_request", "invalid payload")
+		}
+	}
+	for _, field := range payload.Fields {
+		if !watchableFields[field] {
+			return fail(req.RequestID, "bad_request", "unknown field "+field)
+		}
+	}
+
+	client.watch(payload.Fields)
+	if payload.Fields == nil {
+		payload.Fields = []string{}
+	}
+	return ok(req.RequestID, payload)
+}
+
 func ok(requestID string, data any) ResponseMessage {
 	return ResponseMessage{RequestID: requestID, OK: true, Data: data}
 }
@@ -189,12 +323,30 @@ func fail(requestID, code, message string) ResponseMessage {
 	return ResponseMessage{RequestID: requestID, OK: false, Error: &ErrorMessage{Code: code, Message: message}}
 }
 
+// failInvalid is a bad_request that names the fields that failed validation.
+func failInvalid(requestID, message string, violations []contract.FieldViolation) ResponseMessage {
+	resp := fail(requestID, "bad_request", message)
+	resp.Error.Violations = violations
+	return resp
+}
+
 func failFromError(requestID string, err error) ResponseMessage {
 	switch {
 	case errors.Is(err, usersclient.ErrBadRequest):
-		return fail(requestID, "bad_request", err.Error())
+		return failInvalid(requestID, err.Error(), usersclient.FieldViolations(err))
 	case errors.Is(err, usersclient.ErrNotFound):
 		return fail(requestID, "not_found", err.Error())
+	case errors.Is(err, usersclient.ErrVersionConflict):
+		return fail(requestID, "precondition_failed", err.Error())
+	case errors.Is(err, usersclient.ErrForbidden):
+		return fail(requestID, "forbidden", err.Error())
+	case errors.Is(err, usersclient.ErrConflict):
+		resp := fail(requestID, "conflict", err.Error())
+		var commandErr *usersclient.CommandError
+		if errors.As(err, &commandErr) {
+			resp.Error.Reason = commandErr.Reason
+		}
+		return resp
 	default:
 		return fail(requestID, "internal_error", "internal server error")
 	}
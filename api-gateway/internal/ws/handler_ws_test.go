@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+func TestCreateReportsViolations(t *testing.T) {
+	handler := NewHandler(nil, nil)
+
+	resp := handler.process(context.Background(), RequestMessage{
+		RequestID: "r-1",
+		Action:    "user.create",
+		Payload:   json.RawMessage(`{"firstName":"John","lastName":"Doe","email":"john@example.com","status":"Gone"}`),
+	})
+
+	if resp.OK || resp.Error == nil || resp.Error.Code != "bad_request" {
+		t.Fatalf("expected bad_request, got %+v", resp)
+	}
+	want := []contract.FieldViolation{{Field: "status", Rule: "oneof", Param: "Active Inactive"}}
+	if !reflect.DeepEqual(resp.Error.Violations, want) {
+		t.Fatalf("expected %+v, got %+v", want, resp.Error.Violations)
+	}
+}
+
+func TestListReportsNestedViolations(t *testing.T) {
+	handler := NewHandler(nil, nil)
+
+	resp := handler.process(context.Background(), RequestMessage{
+		Action:  "user.list",
+		Payload: json.RawMessage(`{"filter":{"emailDomain":"not a domain"},"sort":{"order":"up"}}`),
+	})
+
+	if resp.OK || resp.Error == nil || len(resp.Error.Violations) != 2 {
+		t.Fatalf("expected two violations, got %+v", resp.Error)
+	}
+	if resp.Error.Violations[0].Field != "filter.emailDomain" || resp.Error.Violations[1].Field != "sort.order" {
+		t.Fatalf("unexpected violation fields %+v", resp.Error.Violations)
+	}
+}
+
+func TestFailFromErrorConflict(t *testing.T) {
+	err := usersclient.NewCommandError(contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonEmailTaken, Message: "email already exists"})
+
+	resp := failFromError("r-2", err)
+
+	if resp.Error == nil || resp.Error.Code != "conflict" || resp.Error.Reason != contract.ConflictReasonEmailTaken {
+		t.Fatalf("expected a conflict with reason email_taken, got %+v", resp.Error)
+	}
+}
+
+func TestProcessForbidsActionsOutsidePolicy(t *testing.T) {
+	handler := NewHandler(nil, nil)
+	handler.UsePolicy(authz.DefaultPolicy())
+	support := usersclient.WithActor(context.Background(), contract.Actor{ID: "agent-7", Source: contract.SourceWS, Roles: []string{"support"}})
+	owner := usersclient.WithActor(context.Background(), contract.Actor{ID: "u-1", Source: contract.SourceWS, Roles: []string{"user"}})
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		req  RequestMessage
+	}{
+		{"support deletes", support, RequestMessage{Action: "user.delete", Payload: json.RawMessage(`{"id":"u-2"}`)}},
+		{"user updates another user", owner, RequestMessage{Action: "user.update", Payload: json.RawMessage(`{"id":"u-2","lastName":"Roe"}`)}},
+		{"user lists", owner, RequestMessage{Action: "user.list"}},
+		{"user reactivates self", owner, RequestMessage{Action: "user.update", Payload: json.RawMessage(`{"id":"u-1","status":"Active"}`)}},
+		{"support lists deleted users", support, RequestMessage{Action: "user.list", Payload: json.RawMessage(`{"filter":{"includeDeleted":true}}`)}},
+		{"no actor", context.Background(), RequestMessage{Action: "user.get", Payload: json.RawMessage(`{"id":"u-2"}`)}},
+	} {
+		resp := handler.process(tc.ctx, tc.req)
+		if resp.OK || resp.Error == nil || resp.Error.Code != "forbidden" {
+			t.Fatalf("%s: expected forbidden, got %+v", tc.name, resp)
+		}
+	}
+
+	// allowed actions get past the check; this one then fails validation instead
+	resp := handler.process(owner, RequestMessage{Action: "user.update", Payload: json.RawMessage(`{"id":"u-1","lastName":"Roe"}`)})
+	if resp.Error == nil || resp.Error.Code != "bad_request" {
+		t.Fatalf("expected the own update to pass authorization, got %+v", resp)
+	}
+}
@@ -1,8 +1,11 @@
 package ws
 
 import (
+	"context"
+	"encoding/json"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -10,6 +13,47 @@ import (
 type clientConn struct {
 	conn *websocket.Conn
 	mu   sync.Mutex
+
+	readable func(userID string) bool // which users' events the client may see; nil for all
+
+	watchMu sync.RWMutex
+	watched map[string]bool // fields set by user.watch; empty means every update
+}
+
+// watch limits the user.updated events sent to the client to those changing one of fields;
+// no fields removes the limit.
+func (c *clientConn) watch(fields []string) {
+	watched := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		watched[field] = true
+	}
+
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	c.watched = watched
+}
+
+// wants reports whether the client may see the event and is interested in it. Only updates
+// are filtered by interest.
+func (c *clientConn) wants(event eventSummary) bool {
+	if c.readable != nil && !c.readable(event.Data.UserID) {
+		return false
+	}
+	if event.Type != eventTypeUpdated {
+		return true
+	}
+
+	c.watchMu.RLock()
+	defer c.watchMu.RUnlock()
+	if len(c.watched) == 0 {
+		return true
+	}
+	for field := range event.Changes {
+		if c.watched[field] {
+			return true
+		}
+	}
+	return false
 }
 
 // send a JSON message to the client connection in a thread-safe manner
@@ -29,19 +73,39 @@ func (c *clientConn) writeText(message []byte) error {
 	return c.conn.WriteMessage(websocket.TextMessage, message)
 }
 
+// send a close frame telling the client the server is going away; the client's reply ends its read loop.
+func (c *clientConn) writeClose() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	return c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteWait))
+}
+
+const closeWriteWait = time.Second
+
 type Hub struct {
 	clients    map[*clientConn]struct{}
 	registerCh chan *clientConn
 	removeCh   chan *clientConn
 	broadcast  chan []byte
+
+	shutdownCh   chan struct{} // closed by Shutdown
+	forceCloseCh chan struct{} // closed when the shutdown deadline passes
+	drainedCh    chan struct{} // closed by run once the last client is gone after Shutdown
+	shutdownOnce sync.Once
+	forceOnce    sync.Once
 }
 
 func NewHub() *Hub {
 	h := &Hub{
-		clients:    make(map[*clientConn]struct{}),
-		registerCh: make(chan *clientConn),
-		removeCh:   make(chan *clientConn),
-		broadcast:  make(chan []byte, 64), // up to 64 broadcast messages can queue without blocking sender
+		clients:      make(map[*clientConn]struct{}),
+		registerCh:   make(chan *clientConn),
+		removeCh:     make(chan *clientConn),
+		broadcast:    make(chan []byte, 64), // up to 64 broadcast messages can queue without blocking sender
+		shutdownCh:   make(chan struct{}),
+		forceCloseCh: make(chan struct{}),
+		drainedCh:    make(chan struct{}),
 	}
 	// go starts a new goroutine to run the hub's main loop
 	go h.run()
@@ -50,20 +114,52 @@ func NewHub() *Hub {
 
 // hub’s background goroutine loop that continuously listens
 func (h *Hub) run() {
+	shutdownCh, forceCloseCh := h.shutdownCh, h.forceCloseCh
+	closing := false
+
 	for { // infinite loop to keep the hub running and processing incoming events
 		select {
 		case client := <-h.registerCh:
 			h.clients[client] = struct{}{}
 			slog.Info("ws client registered", "clients_count", len(h.clients))
+			if closing { // upgraded just before the HTTP server stopped accepting
+				_ = client.writeClose()
+			}
 		case client := <-h.removeCh:
 			if _, exists := h.clients[client]; exists {
 				delete(h.clients, client)
 				slog.Info("ws client unregistered", "clients_count", len(h.clients))
 				_ = client.conn.Close()
 			}
+			if closing && len(h.clients) == 0 {
+				h.markDrained()
+			}
+		case <-shutdownCh:
+			shutdownCh = nil // handle once
+			closing = true
+			slog.Info("ws hub closing clients", "clients_count", len(h.clients))
+			for client := range h.clients {
+				if err := client.writeClose(); err != nil {
+					slog.Error("ws close frame write failed", "error", err)
+					_ = client.conn.Close() // the read loop fails and unregisters the client
+				}
+			}
+			if len(h.clients) == 0 {
+				h.markDrained()
+			}
+		case <-forceCloseCh:
+			forceCloseCh = nil
+			slog.Warn("ws hub shutdown deadline reached; closing remaining clients", "clients_count", len(h.clients))
+			for client := range h.clients {
+				_ = client.conn.Close()
+			}
 		case message := <-h.broadcast:
 			slog.Info("ws broadcasting message", "clients_count", len(h.clients), "message_size", len(message))
+			event := summarizeEvent(message)
 			for client := range h.clients { // iterate over all connected clients and send the broadcast message
+				if !client.wants(event) {
+					continue
+				}
 				if err := client.writeText(message); err != nil {
 					slog.Error("ws broadcast write failed; removing client", "error", err)
 					delete(h.clients, client)
@@ -74,9 +170,10 @@ func (h *Hub) run() {
 	}
 }
 
-// register a new client connection to the hub and return the clientConn instance
-func (h *Hub) register(conn *websocket.Conn) *clientConn {
-	client := &clientConn{conn: conn}
+// register a new client connection to the hub and return the clientConn instance; readable
+// limits the users whose events it receives, nil for none.
+func (h *Hub) register(conn *websocket.Conn, readable func(userID string) bool) *clientConn {
+	client := &clientConn{conn: conn, readable: readable}
 	h.registerCh <- client // send the clientConn instance to the register channel to be added to the clients map
 	return client
 }
@@ -85,6 +182,47 @@ func (h *Hub) unregister(client *clientConn) {
 	h.removeCh <- client
 }
 
+// Shutdown sends every client a "going away" close frame and waits until they have all
+// disconnected. When ctx ends first, the remaining connections are closed and ctx.Err is returned.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() { close(h.shutdownCh) })
+
+	select {
+	case <-h.drainedCh:
+		return nil
+	case <-ctx.Done():
+		h.forceOnce.Do(func() { close(h.forceCloseCh) })
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) markDrained() {
+	select {
+	case <-h.drainedCh:
+	default:
+		close(h.drainedCh)
+	}
+}
+
+const eventTypeUpdated = "user.updated"
+
+// eventSummary is the part of a user event the hub filters on.
+type eventSummary struct {
+	Type string `json:"type"`
+	Data struct {
+		UserID string `json:"userId"`
+	} `json:"data"`
+	Changes map[string]json.RawMessage `json:"changes"`
+}
+
+// summarizeEvent reads the type and changed fields of a broadcast event; a message that is not
+// an event has an empty summary and goes to every client.
+func summarizeEvent(message []byte) eventSummary {
+	var event eventSummary
+	_ = json.Unmarshal(message, &event)
+	return event
+}
+
 func (h *Hub) Broadcast(message []byte) {
 	slog.Debug("ws message enqueued for broadcast", "message_size", len(message))
 	h.broadcast <- message
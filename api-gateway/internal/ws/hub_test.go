@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHubShutdownSendsCloseFrame(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(http.HandlerFunc(NewHandler(nil, hub).Handle))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// a round trip proves the connection is registered with the hub
+	if err := conn.WriteJSON(map[string]string{"action": "noop"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	// reading lets the client answer the close frame, which unregisters it from the hub
+	readErr := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		readErr <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	var closeErr *websocket.CloseError
+	if err := <-readErr; !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("expected a going-away close frame, got %v", err)
+	}
+}
+
+func TestHubShutdownWithoutClients(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := NewHub().Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWatchFiltersUpdatedEvents(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(http.HandlerFunc(NewHandler(nil, hub).Handle))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]any{"requestId": "w-1", "action": "user.watch", "payload": map[string]any{"fields": []string{"status"}}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var resp ResponseMessage
+	if err := conn.ReadJSON(&resp); err != nil || !resp.OK {
+		t.Fatalf("expected watch to succeed, got %+v, %v", resp, err)
+	}
+
+	hub.Broadcast([]byte(`{"type":"user.updated","data":{"userId":"u-1"},"changes":{"lastName":{"old":"Doe","new":"Roe"}}}`))
+	hub.Broadcast([]byte(`{"type":"user.created","data":{"userId":"u-2"}}`))
+	hub.Broadcast([]byte(`{"type":"user.updated","data":{"userId":"u-1"},"changes":{"status":{"old":"Active","new":"Inactive"}}}`))
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []string{`"user.created"`, `"status"`} {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !strings.Contains(string(message), want) {
+			t.Fatalf("expected a message with %s, got %s", want, message)
+		}
+	}
+}
+
+func TestWatchRejectsUnknownField(t *testing.T) {
+	// deletedAt changes only with user.deleted and user.restored, which watching does not filter
+	for _, field := range []string{"nickname", "deletedAt"} {
+		resp := watch(&clientConn{}, RequestMessage{RequestID: "w-2", Action: "user.watch", Payload: []byte(`{"fields":["` + field + `"]}`)})
+
+		if resp.OK || resp.Error == nil || resp.Error.Code != "bad_request" {
+			t.Fatalf("%s: expected bad_request, got %+v", field, resp)
+		}
+	}
+}
+
+func TestClientOnlyReceivesReadableUsersEvents(t *testing.T) {
+	client := &clientConn{readable: func(userID string) bool { return userID == "u-1" }}
+
+	if !client.wants(summarizeEvent([]byte(`{"type":"user.created","data":{"userId":"u-1"}}`))) {
+		t.Fatalf("expected the client to receive events about its own user")
+	}
+	if client.wants(summarizeEvent([]byte(`{"type":"user.created","data":{"userId":"u-2"}}`))) {
+		t.Fatalf("expected events about other users to be withheld")
+	}
+}
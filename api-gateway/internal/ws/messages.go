@@ -1,6 +1,11 @@
 package ws
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
 
 type RequestMessage struct {
 	RequestID string          `json:"requestId"`
@@ -11,6 +16,10 @@ type RequestMessage struct {
 type ErrorMessage struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Reason refines a conflict, e.g. email_taken.
+	Reason string `json:"reason,omitempty"`
+	// Violations lists the fields that failed validation on a bad_request.
+	Violations []contract.FieldViolation `json:"violations,omitempty"`
 }
 
 type ResponseMessage struct {
@@ -24,6 +33,28 @@ type IDPayload struct {
 	ID string `json:"id"`
 }
 
+type DeletePayload struct {
+	ID              string `json:"id"`
+	ExpectedVersion *int32 `json:"expectedVersion"`
+}
+
+type ListPayload struct {
+	Limit  int32                       `json:"limit"`
+	Cursor string                      `json:"cursor"`
+	Filter usersclient.ListUsersFilter `json:"filter"`
+	Sort   usersclient.ListUsersSort   `json:"sort"`
+}
+
+type SearchPayload struct {
+	Query string `json:"query"`
+	Limit int32  `json:"limit"`
+}
+
+// WatchPayload lists the fields whose changes the client wants user.updated events for.
+type WatchPayload struct {
+	Fields []string `json:"fields"`
+}
+
 type UpdatePayload struct {
 	ID        string  `json:"id"`
 	FirstName *string `json:"firstName"`
@@ -32,4 +63,6 @@ type UpdatePayload struct {
 	Phone     *string `json:"phone"`
 	Age       *int32  `json:"age"`
 	Status    *string `json:"status"`
+
+	ExpectedVersion *int32 `json:"expectedVersion"`
 }
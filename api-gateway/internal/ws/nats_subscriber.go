@@ -1,12 +1,15 @@
 package ws
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
 	"user-service/pkg/contract"
+	"user-service/pkg/eventstream"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 func SubscribeUserEvents(nc *nats.Conn, hub *Hub) error {
@@ -14,6 +17,9 @@ func SubscribeUserEvents(nc *nats.Conn, hub *Hub) error {
 		contract.SubjectUserEventCreated,
 		contract.SubjectUserEventUpdated,
 		contract.SubjectUserEventDeleted,
+		contract.SubjectUserEventRestored,
+		contract.SubjectUserEventLocked,
+		contract.SubjectUserEventUnlocked,
 	}
 
 	for _, subject := range eventSubjects {
@@ -30,3 +36,30 @@ func SubscribeUserEvents(nc *nats.Conn, hub *Hub) error {
 
 	return nil
 }
+
+// SubscribeUserEventStream broadcasts user events read from the JetStream stream through an
+// ordered consumer. The consumer tracks the last delivered sequence and picks up from there
+// after a reconnect, so a NATS blip does not drop events for connected clients.
+func SubscribeUserEventStream(ctx context.Context, js jetstream.JetStream, hub *Hub) error {
+	if _, err := eventstream.Open(ctx, js); err != nil {
+		return err
+	}
+
+	consumer, err := js.OrderedConsumer(ctx, eventstream.StreamName, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{eventstream.Subjects},
+		DeliverPolicy:  jetstream.DeliverNewPolicy, // clients only care about changes from now on
+	})
+	if err != nil {
+		return fmt.Errorf("create ordered consumer: %w", err)
+	}
+
+	if _, err := consumer.Consume(func(msg jetstream.Msg) {
+		slog.Info("received user event", "subject", msg.Subject(), "payload_size", len(msg.Data()))
+		hub.Broadcast(msg.Data())
+	}); err != nil {
+		return fmt.Errorf("consume %s: %w", eventstream.StreamName, err)
+	}
+
+	slog.Info("subscribed to user event stream", "stream", eventstream.StreamName)
+	return nil
+}
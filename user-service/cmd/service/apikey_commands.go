@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"user-service/internal/apikey"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
+)
+
+// apiKeyDTO is an API key as reported to callers; the secret is never part of it.
+type apiKeyDTO struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Scopes      []string   `json:"scopes"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	RotatedFrom string     `json:"rotatedFrom,omitempty"`
+}
+
+// issuedAPIKeyResponse carries the full key, which is shown this once.
+type issuedAPIKeyResponse struct {
+	APIKey apiKeyDTO `json:"apiKey"`
+	Key    string    `json:"key"`
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []apiKeyDTO `json:"apiKeys"`
+}
+
+type rotateAPIKeyRequest struct {
+	ID string `json:"id"`
+	// GraceSeconds is how long the old key keeps working; apikey.DefaultRotateGrace when unset.
+	GraceSeconds *int64 `json:"graceSeconds,omitempty"`
+}
+
+type resolveAPIKeyRequest struct {
+	Key string `json:"key"`
+}
+
+type touchAPIKeysRequest struct {
+	IDs    []string  `json:"ids"`
+	UsedAt time.Time `json:"usedAt"`
+}
+
+func toAPIKeyDTO(key apikey.Key) apiKeyDTO {
+	out := apiKeyDTO{
+		ID:         key.ID.String(),
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+	if key.RotatedFrom != nil {
+		out.RotatedFrom = key.RotatedFrom.String()
+	}
+	return out
+}
+
+func (h *commandHandler) handleIssueAPIKey(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[apikey.IssueInput]](msg.Data)
+	if err != nil {
+		slog.Info("rpc issue api key invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[issuedAPIKeyResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc issue api key start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermAPIKeys, "") {
+		return
+	}
+	// a key cannot hold more than its issuer, as with assigning roles
+	for _, scope := range req.Data.Scopes {
+		if h.authorizer != nil && !h.authorizer.Policy().Holds(*req.Actor, authz.Permission(scope)) {
+			slog.Warn("rpc command forbidden", "subject", msg.Subject, "request_id", req.RequestID, "scope", scope)
+			reply(msg, commandError[issuedAPIKeyResponse]("FORBIDDEN", fmt.Sprintf("%v: %s cannot issue a key with scope %s", authz.ErrForbidden, actorID(req.Actor), scope)))
+			return
+		}
+	}
+
+	issued, err := h.apiKeys.Issue(context.Background(), req.Data, actorID(req.Actor))
+	if err != nil {
+		slog.Error("rpc issue api key failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[issuedAPIKeyResponse](msg, err, "failed to issue api key")
+		return
+	}
+
+	reply(msg, commandOK(issuedAPIKeyResponse{APIKey: toAPIKeyDTO(issued.Key), Key: issued.Secret}))
+	slog.Info("rpc issue api key success", "subject", msg.Subject, "request_id", req.RequestID, "key_id", issued.Key.ID, "scopes", issued.Key.Scopes, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleListAPIKeys(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[struct{}]](msg.Data)
+	if err != nil {
+		slog.Info("rpc list api keys invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[listAPIKeysResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc list api keys start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermAPIKeys, "") {
+		return
+	}
+
+	keys, err := h.apiKeys.List(context.Background())
+	if err != nil {
+		slog.Error("rpc list api keys failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[listAPIKeysResponse](msg, err, "failed to list api keys")
+		return
+	}
+
+	out := listAPIKeysResponse{APIKeys: make([]apiKeyDTO, 0, len(keys))}
+	for _, key := range keys {
+		out.APIKeys = append(out.APIKeys, toAPIKeyDTO(key))
+	}
+	reply(msg, commandOK(out))
+	slog.Info("rpc list api keys success", "subject", msg.Subject, "request_id", req.RequestID, "count", len(out.APIKeys), "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleRotateAPIKey(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[rotateAPIKeyRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc rotate api key invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[issuedAPIKeyResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc rotate api key start", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermAPIKeys, "") {
+		return
+	}
+
+	id, err := uuid.Parse(req.Data.ID)
+	if err != nil {
+		reply(msg, commandError[issuedAPIKeyResponse]("BAD_REQUEST", "id must be valid uuid"))
+		return
+	}
+	grace := apikey.DefaultRotateGrace
+	if req.Data.GraceSeconds != nil {
+		grace = time.Duration(*req.Data.GraceSeconds) * time.Second
+	}
+
+	issued, err := h.apiKeys.Rotate(context.Background(), id, grace, actorID(req.Actor))
+	if err != nil {
+		slog.Error("rpc rotate api key failed", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID, "error", err)
+		replyError[issuedAPIKeyResponse](msg, err, "failed to rotate api key")
+		return
+	}
+
+	reply(msg, commandOK(issuedAPIKeyResponse{APIKey: toAPIKeyDTO(issued.Key), Key: issued.Secret}))
+	slog.Info("rpc rotate api key success", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID, "new_key_id", issued.Key.ID, "grace", grace.String(), "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleRevokeAPIKey(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[idRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc revoke api key invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[apiKeyDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc revoke api key start", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermAPIKeys, "") {
+		return
+	}
+
+	id, err := uuid.Parse(req.Data.ID)
+	if err != nil {
+		reply(msg, commandError[apiKeyDTO]("BAD_REQUEST", "id must be valid uuid"))
+		return
+	}
+
+	revoked, err := h.apiKeys.Revoke(context.Background(), id)
+	if err != nil {
+		slog.Error("rpc revoke api key failed", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID, "error", err)
+		replyError[apiKeyDTO](msg, err, "failed to revoke api key")
+		return
+	}
+
+	reply(msg, commandOK(toAPIKeyDTO(*revoked)))
+	slog.Info("rpc revoke api key success", "subject", msg.Subject, "request_id", req.RequestID, "key_id", req.Data.ID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// handleResolveAPIKey authenticates a presented key for the gateway. It needs no permission,
+// only a signed actor, since the caller is not authenticated yet.
+func (h *commandHandler) handleResolveAPIKey(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[resolveAPIKeyRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc resolve api key invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[apiKeyDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc resolve api key start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.verify(msg, req.Actor, req.RequestID) {
+		return
+	}
+
+	key, err := h.apiKeys.Resolve(context.Background(), req.Data.Key)
+	if err != nil {
+		slog.Info("rpc resolve api key failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[apiKeyDTO](msg, err, "failed to resolve api key")
+		return
+	}
+
+	reply(msg, commandOK(toAPIKeyDTO(*key)))
+	slog.Info("rpc resolve api key success", "subject", msg.Subject, "request_id", req.RequestID, "key_id", key.ID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// handleTouchAPIKeys records the key uses the gateway reports in batches. Nobody waits for
+// the outcome, so nothing is replied.
+func (h *commandHandler) handleTouchAPIKeys(msg *nats.Msg) {
+	req, err := contract.FromJSON[contract.CommandRequest[touchAPIKeysRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc touch api keys invalid request", "subject", msg.Subject, "error", err)
+		return
+	}
+	if h.authorizer != nil {
+		if err := h.authorizer.Verify(req.Actor, req.RequestID); err != nil {
+			slog.Warn("rpc touch api keys forbidden", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+			return
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.Data.IDs))
+	for _, raw := range req.Data.IDs {
+		if id, err := uuid.Parse(raw); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	touched, err := h.apiKeys.Touch(context.Background(), ids, req.Data.UsedAt)
+	if err != nil {
+		slog.Error("rpc touch api keys failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		return
+	}
+	slog.Info("rpc touch api keys success", "subject", msg.Subject, "request_id", req.RequestID, "keys", len(ids), "touched", touched)
+}
+
+func actorID(actor *contract.Actor) string {
+	if actor == nil {
+		return ""
+	}
+	return actor.ID
+}
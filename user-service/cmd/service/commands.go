@@ -3,82 +3,216 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
-	"os"
+	"math"
+	"sync"
 	"time"
 
+	"user-service/internal/apikey"
+	"user-service/internal/credential"
+	"user-service/internal/idempotency"
 	usersvc "user-service/internal/user"
 
-	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
+	"user-service/pkg/authz"
 	"user-service/pkg/contract"
 )
 
-type userDTO struct {
-	UserID    string    `json:"userId"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Phone     *string   `json:"phone,omitempty"`
-	Age       *int32    `json:"age,omitempty"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+type listUsersResponse struct {
+	Users      []usersvc.UserDTO `json:"users"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// searchResultDTO flattens the user and its relevance score into one JSON object.
+type searchResultDTO struct {
+	usersvc.UserDTO
+	Score float32 `json:"score"`
+}
+
+type searchUsersResponse struct {
+	Results []searchResultDTO `json:"results"`
+}
+
+// bulkRowDTO reports one input row: the created user, or why it was not created.
+type bulkRowDTO struct {
+	Row   int                    `json:"row"`
+	User  *usersvc.UserDTO       `json:"user,omitempty"`
+	Error *contract.CommandError `json:"error,omitempty"`
+}
+
+type bulkCreateResponse struct {
+	Mode    string       `json:"mode"`
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Rows    []bulkRowDTO `json:"rows"`
 }
 
 type idRequest struct {
 	ID string `json:"id"`
 }
 
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+type deleteUserRequest struct {
+	ID              string `json:"id"`
+	ExpectedVersion *int32 `json:"expectedVersion,omitempty"`
+}
+
+// auditEntryDTO is one change in a user's history.
+type auditEntryDTO struct {
+	ID         int64                           `json:"id"`
+	UserID     string                          `json:"userId"`
+	Action     string                          `json:"action"`
+	Actor      contract.Actor                  `json:"actor"`
+	RequestID  string                          `json:"requestId,omitempty"`
+	Changes    map[string]contract.FieldChange `json:"changes"`
+	OccurredAt time.Time                       `json:"occurredAt"`
+}
+
+type userHistoryResponse struct {
+	Entries    []auditEntryDTO `json:"entries"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
 type updateUserRequest struct {
 	ID string `json:"id"`
 	usersvc.UpdateInput
 }
 
 type commandHandler struct {
-	service *usersvc.Service
-	nc      *nats.Conn
+	service     *usersvc.Service
+	relay       *outboxRelay // nudged after each mutation so its event goes out without waiting for the next poll
+	idempotency *idempotency.Store
+	apiKeys     *apikey.Store
+	credentials *credential.Store
+	authorizer  *authz.Authorizer // re-checks the signed actor of each command; nil allows everything
+	inflight    sync.WaitGroup    // commands currently being handled
 }
 
-func newCommandHandler(service *usersvc.Service, nc *nats.Conn) *commandHandler {
-	return &commandHandler{service: service, nc: nc}
+func newCommandHandler(service *usersvc.Service, relay *outboxRelay, idempotencyStore *idempotency.Store, apiKeys *apikey.Store, credentials *credential.Store, authorizer *authz.Authorizer) *commandHandler {
+	return &commandHandler{service: service, relay: relay, idempotency: idempotencyStore, apiKeys: apiKeys, credentials: credentials, authorizer: authorizer}
 }
 
-func handleSubscribe(nc *nats.Conn, subject string, handler func(*nats.Msg)) {
-	_, err := nc.Subscribe(subject, handler) // subscribe to the given NATS subject with the provided handler function
-	if err != nil {
-		slog.Error("failed to subscribe subject", "subject", subject, "error", err)
-		os.Exit(1)
-	} else {
-		slog.Info("subscribed to subject", "subject", subject)
+// commandRoute binds a command subject to its handler.
+type commandRoute struct {
+	subject string
+	handler nats.MsgHandler
+}
+
+func (h *commandHandler) routes() []commandRoute {
+	return []commandRoute{
+		{subject: contract.SubjectUserCommandList, handler: h.track(h.handleListUsers)},
+		{subject: contract.SubjectUserCommandCreate, handler: h.track(h.handleCreateUser)},
+		{subject: contract.SubjectUserCommandBulkCreate, handler: h.track(h.handleBulkCreateUsers)},
+		{subject: contract.SubjectUserCommandGet, handler: h.track(h.handleGetUser)},
+		{subject: contract.SubjectUserCommandGetByEmail, handler: h.track(h.handleGetUserByEmail)},
+		{subject: contract.SubjectUserCommandUpdate, handler: h.track(h.handleUpdateUser)},
+		{subject: contract.SubjectUserCommandDelete, handler: h.track(h.handleDeleteUser)},
+		{subject: contract.SubjectUserCommandSearch, handler: h.track(h.handleSearchUsers)},
+		{subject: contract.SubjectUserCommandRestore, handler: h.track(h.handleRestoreUser)},
+		{subject: contract.SubjectUserCommandHistory, handler: h.track(h.handleUserHistory)},
+		{subject: contract.SubjectAPIKeyCommandIssue, handler: h.track(h.handleIssueAPIKey)},
+		{subject: contract.SubjectAPIKeyCommandList, handler: h.track(h.handleListAPIKeys)},
+		{subject: contract.SubjectAPIKeyCommandRotate, handler: h.track(h.handleRotateAPIKey)},
+		{subject: contract.SubjectAPIKeyCommandRevoke, handler: h.track(h.handleRevokeAPIKey)},
+		{subject: contract.SubjectAPIKeyCommandResolve, handler: h.track(h.handleResolveAPIKey)},
+		{subject: contract.SubjectAPIKeyCommandTouch, handler: h.track(h.handleTouchAPIKeys)},
+		{subject: contract.SubjectCredentialCommandSetPassword, handler: h.track(h.handleSetPassword)},
+		{subject: contract.SubjectCredentialCommandAuthenticate, handler: h.track(h.handleAuthenticate)},
+		{subject: contract.SubjectSessionCommandRefresh, handler: h.track(h.handleRefreshSession)},
+		{subject: contract.SubjectSessionCommandRevoke, handler: h.track(h.handleRevokeSession)},
+		{subject: contract.SubjectCredentialCommandUnlock, handler: h.track(h.handleUnlockUser)},
 	}
 }
 
+// subscribeCommands queue-subscribes every route, so replicas sharing the queue group
+// split the commands and each one is handled by a single replica. If any subscription
+// fails, the ones already made are removed again.
+func subscribeCommands(nc *nats.Conn, queue string, routes []commandRoute) ([]*nats.Subscription, error) {
+	subs := make([]*nats.Subscription, 0, len(routes))
+	for _, route := range routes {
+		sub, err := nc.QueueSubscribe(route.subject, queue, route.handler)
+		if err != nil {
+			for _, created := range subs {
+				_ = created.Unsubscribe()
+			}
+			return nil, fmt.Errorf("subscribe %s: %w", route.subject, err)
+		}
+		subs = append(subs, sub)
+		slog.Info("subscribed to subject", "subject", route.subject, "queue", queue)
+	}
+	return subs, nil
+}
+
 func (h *commandHandler) handleListUsers(msg *nats.Msg) {
 	start := time.Now()
-	_, err := contract.FromJSON[contract.CommandRequest[map[string]any]](msg.Data) // parse the incoming NATS message data into a CommandRequest with an empty map as the data payload
+	req, err := contract.FromJSON[contract.CommandRequest[usersvc.ListInput]](msg.Data) // parse the incoming NATS message data into a CommandRequest with ListInput (limit + cursor) as the data payload
 	if err != nil {
 		slog.Info("rpc list users invalid request", "subject", msg.Subject, "error", err)
-		reply(msg, commandError[[]userDTO]("BAD_REQUEST", "invalid request"))
+		reply(msg, commandError[listUsersResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc list users start", "subject", msg.Subject, "request_id", req.RequestID, "limit", req.Data.Limit)
+
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersRead, "") {
+		return
+	}
+	// soft-deleted users are for those who may restore them
+	if req.Data.Filter.IncludeDeleted && !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersDelete, "") {
 		return
 	}
-	slog.Info("rpc list users start", "subject", msg.Subject)
 
-	users, err := h.service.ListUsers(context.Background())
+	page, err := h.service.ListUsers(context.Background(), req.Data)
 	if err != nil {
-		slog.Error("rpc list users failed", "subject", msg.Subject, "error", err)
-		replyError[[]userDTO](msg, err, "failed to list users")
+		slog.Error("rpc list users failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[listUsersResponse](msg, err, "failed to list users")
 		return
 	}
-	// map the list of users returned by the service into a list of userDTOs
-	out := make([]userDTO, 0, len(users))
-	for _, item := range users {
-		out = append(out, mapUser(item)) // map each user to a userDTO and append it to the output list
+	// map the page of users returned by the service into a list of userDTOs
+	out := listUsersResponse{
+		Users:      make([]usersvc.UserDTO, 0, len(page.Users)),
+		NextCursor: page.NextCursor,
+	}
+	for _, item := range page.Users {
+		out.Users = append(out.Users, usersvc.ToDTO(item)) // map each user to a UserDTO and append it to the output list
 	}
 
 	reply(msg, commandOK(out)) // send a successful response back to the NATS message
-	slog.Info("rpc list users success", "subject", msg.Subject, "count", len(out), "duration_ms", time.Since(start).Milliseconds())
+	slog.Info("rpc list users success", "subject", msg.Subject, "request_id", req.RequestID, "count", len(out.Users), "has_more", out.NextCursor != "", "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleSearchUsers(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[usersvc.SearchInput]](msg.Data)
+	if err != nil {
+		slog.Info("rpc search users invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[searchUsersResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc search users start", "subject", msg.Subject, "request_id", req.RequestID, "limit", req.Data.Limit)
+
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersRead, "") {
+		return
+	}
+
+	results, err := h.service.SearchUsers(context.Background(), req.Data)
+	if err != nil {
+		slog.Error("rpc search users failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[searchUsersResponse](msg, err, "failed to search users")
+		return
+	}
+
+	out := searchUsersResponse{Results: make([]searchResultDTO, 0, len(results))}
+	for _, item := range results {
+		out.Results = append(out.Results, searchResultDTO{UserDTO: usersvc.ToDTO(item.User), Score: item.Score})
+	}
+
+	reply(msg, commandOK(out))
+	slog.Info("rpc search users success", "subject", msg.Subject, "request_id", req.RequestID, "count", len(out.Results), "duration_ms", time.Since(start).Milliseconds())
 }
 
 func (h *commandHandler) handleCreateUser(msg *nats.Msg) {
@@ -86,25 +220,81 @@ func (h *commandHandler) handleCreateUser(msg *nats.Msg) {
 	req, err := contract.FromJSON[contract.CommandRequest[usersvc.CreateInput]](msg.Data) // parse the incoming NATS message data into a CommandRequest with CreateInput as the data payload
 	if err != nil {
 		slog.Info("rpc create user invalid request", "subject", msg.Subject, "error", err)
-		reply(msg, commandError[userDTO]("BAD_REQUEST", "invalid request"))
+		reply(msg, commandError[usersvc.UserDTO]("BAD_REQUEST", "invalid request"))
 		return
 	}
 	slog.Info("rpc create user start", "subject", msg.Subject, "request_id", req.RequestID)
 
-	created, err := h.service.CreateUser(context.Background(), req.Data)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, "") {
+		return
+	}
+
+	out := h.beginIdempotent(msg, req.IdempotencyKey, req.Data)
+	if out == nil {
+		return
+	}
+
+	created, err := h.service.CreateUser(commandContext(req), req.Data)
 	if err != nil {
 		slog.Error("rpc create user failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
-		replyError[userDTO](msg, err, "failed to create user")
+		replyError[usersvc.UserDTO](out, err, "failed to create user")
 		return
 	}
 
-	mapped := mapUser(*created) // map the created user returned by the service into a userDTO
-	reply(msg, commandOK(mapped))
+	mapped := usersvc.ToDTO(*created) // map the created user returned by the service into a UserDTO
+	h.relay.Notify()
+	reply(out, commandOK(mapped))
 	slog.Info("rpc create user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", mapped.UserID, "duration_ms", time.Since(start).Milliseconds())
+}
 
-	if err := h.publishEvent(contract.SubjectUserEventCreated, "user.created", mapped); err != nil {
-		slog.Error("failed to publish event", "subject", contract.SubjectUserEventCreated, "error", err)
+func (h *commandHandler) handleBulkCreateUsers(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[usersvc.BulkCreateInput]](msg.Data)
+	if err != nil {
+		slog.Info("rpc bulk create users invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[bulkCreateResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc bulk create users start", "subject", msg.Subject, "request_id", req.RequestID, "mode", req.Data.Mode, "rows", len(req.Data.Users))
+
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, "") {
+		return
 	}
+
+	out := h.beginIdempotent(msg, req.IdempotencyKey, req.Data)
+	if out == nil {
+		return
+	}
+
+	result, err := h.service.BulkCreateUsers(commandContext(req), req.Data)
+	if err != nil {
+		slog.Error("rpc bulk create users failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[bulkCreateResponse](out, err, "failed to create users")
+		return
+	}
+
+	mapped := bulkCreateResponse{
+		Mode:    result.Mode,
+		Created: result.Created,
+		Failed:  result.Failed,
+		Rows:    make([]bulkRowDTO, 0, len(result.Rows)),
+	}
+	for _, row := range result.Rows {
+		item := bulkRowDTO{Row: row.Row}
+		if row.Err != nil {
+			item.Error = commandErrorFor(row.Err, "failed to create user")
+		} else {
+			user := usersvc.ToDTO(*row.User)
+			item.User = &user
+		}
+		mapped.Rows = append(mapped.Rows, item)
+	}
+
+	if result.Created > 0 {
+		h.relay.Notify()
+	}
+	reply(out, commandOK(mapped))
+	slog.Info("rpc bulk create users success", "subject", msg.Subject, "request_id", req.RequestID, "mode", result.Mode, "created", result.Created, "failed", result.Failed, "duration_ms", time.Since(start).Milliseconds())
 }
 
 func (h *commandHandler) handleGetUser(msg *nats.Msg) {
@@ -112,51 +302,97 @@ func (h *commandHandler) handleGetUser(msg *nats.Msg) {
 	req, err := contract.FromJSON[contract.CommandRequest[idRequest]](msg.Data)
 	if err != nil {
 		slog.Info("rpc get user invalid request", "subject", msg.Subject, "error", err)
-		reply(msg, commandError[userDTO]("BAD_REQUEST", "invalid request"))
+		reply(msg, commandError[usersvc.UserDTO]("BAD_REQUEST", "invalid request"))
 		return
 	}
 	slog.Info("rpc get user start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID)
 
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersRead, req.Data.ID) {
+		return
+	}
+
 	found, err := h.service.GetUserByID(context.Background(), req.Data.ID)
 	if err != nil {
 		slog.Error("rpc get user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
-		replyError[userDTO](msg, err, "failed to get user")
+		replyError[usersvc.UserDTO](msg, err, "failed to get user")
 		return
 	}
 
-	reply(msg, commandOK(mapUser(*found)))
+	reply(msg, commandOK(usersvc.ToDTO(*found)))
 	slog.Info("rpc get user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "duration_ms", time.Since(start).Milliseconds())
 }
 
+func (h *commandHandler) handleGetUserByEmail(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[emailRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc get user by email invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[usersvc.UserDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc get user by email start", "subject", msg.Subject, "request_id", req.RequestID)
+
+	if !h.verify(msg, req.Actor, req.RequestID) {
+		return
+	}
+
+	found, err := h.service.GetUserByEmail(context.Background(), req.Data.Email)
+	if err != nil {
+		slog.Error("rpc get user by email failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[usersvc.UserDTO](msg, err, "failed to get user")
+		return
+	}
+	// authorized against the user found, so users can look up their own email; a user the
+	// actor may not read is answered as not found, so the lookup does not tell which emails exist
+	if h.authorizer != nil && !h.authorizer.Policy().Allows(*req.Actor, authz.PermUsersRead, found.UserID) {
+		slog.Warn("rpc command forbidden", "subject", msg.Subject, "request_id", req.RequestID, "permission", authz.PermUsersRead, "user_id", found.UserID)
+		reply(msg, commandError[usersvc.UserDTO]("NOT_FOUND", usersvc.ErrUserNotFound.Error()))
+		return
+	}
+
+	reply(msg, commandOK(usersvc.ToDTO(*found)))
+	slog.Info("rpc get user by email success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", found.UserID, "duration_ms", time.Since(start).Milliseconds())
+}
+
 func (h *commandHandler) handleUpdateUser(msg *nats.Msg) {
 	start := time.Now()
 	req, err := contract.FromJSON[contract.CommandRequest[updateUserRequest]](msg.Data)
 	if err != nil {
 		slog.Info("rpc update user invalid request", "subject", msg.Subject, "error", err)
-		reply(msg, commandError[userDTO]("BAD_REQUEST", "invalid request"))
+		reply(msg, commandError[usersvc.UserDTO]("BAD_REQUEST", "invalid request"))
 		return
 	}
 	slog.Info("rpc update user start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID)
 
-	updated, err := h.service.UpdateUser(context.Background(), req.Data.ID, req.Data.UpdateInput)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, req.Data.ID) {
+		return
+	}
+	// status decides who may log in, so users cannot reactivate themselves
+	if req.Data.Status != nil && !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, "") {
+		return
+	}
+
+	out := h.beginIdempotent(msg, req.IdempotencyKey, req.Data)
+	if out == nil {
+		return
+	}
+
+	updated, err := h.service.UpdateUser(commandContext(req), req.Data.ID, req.Data.UpdateInput)
 	if err != nil {
 		slog.Error("rpc update user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
-		replyError[userDTO](msg, err, "failed to update user")
+		replyError[usersvc.UserDTO](out, err, "failed to update user")
 		return
 	}
 
-	mapped := mapUser(*updated)
-	reply(msg, commandOK(mapped))
+	mapped := usersvc.ToDTO(*updated)
+	h.relay.Notify()
+	reply(out, commandOK(mapped))
 	slog.Info("rpc update user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", mapped.UserID, "duration_ms", time.Since(start).Milliseconds())
-
-	if err := h.publishEvent(contract.SubjectUserEventUpdated, "user.updated", mapped); err != nil {
-		slog.Error("failed to publish event", "subject", contract.SubjectUserEventUpdated, "error", err)
-	}
 }
 
 func (h *commandHandler) handleDeleteUser(msg *nats.Msg) {
 	start := time.Now()
-	req, err := contract.FromJSON[contract.CommandRequest[idRequest]](msg.Data)
+	req, err := contract.FromJSON[contract.CommandRequest[deleteUserRequest]](msg.Data)
 	if err != nil {
 		slog.Info("rpc delete user invalid request", "subject", msg.Subject, "error", err)
 		reply(msg, commandError[map[string]string]("BAD_REQUEST", "invalid request"))
@@ -164,28 +400,141 @@ func (h *commandHandler) handleDeleteUser(msg *nats.Msg) {
 	}
 	slog.Info("rpc delete user start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID)
 
-	if err := h.service.DeleteUser(context.Background(), req.Data.ID); err != nil {
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersDelete, "") {
+		return
+	}
+
+	out := h.beginIdempotent(msg, req.IdempotencyKey, req.Data)
+	if out == nil {
+		return
+	}
+
+	if err := h.service.DeleteUser(commandContext(req), req.Data.ID, req.Data.ExpectedVersion); err != nil {
 		slog.Error("rpc delete user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
-		replyError[map[string]string](msg, err, "failed to delete user")
+		replyError[map[string]string](out, err, "failed to delete user")
 		return
 	}
+	h.relay.Notify()
 
-	reply(msg, commandOK(map[string]string{"message": "user deleted"}))
+	reply(out, commandOK(map[string]string{"message": "user deleted"}))
 	slog.Info("rpc delete user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleRestoreUser(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[idRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc restore user invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[usersvc.UserDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc restore user start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID)
 
-	if err := h.publishEvent(contract.SubjectUserEventDeleted, "user.deleted", map[string]string{"userId": req.Data.ID}); err != nil {
-		slog.Error("failed to publish event", "subject", contract.SubjectUserEventDeleted, "error", err)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersDelete, "") {
+		return
+	}
+
+	restored, err := h.service.RestoreUser(commandContext(req), req.Data.ID)
+	if err != nil {
+		slog.Error("rpc restore user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[usersvc.UserDTO](msg, err, "failed to restore user")
+		return
 	}
+
+	mapped := usersvc.ToDTO(*restored)
+	h.relay.Notify()
+	reply(msg, commandOK(mapped))
+	slog.Info("rpc restore user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", mapped.UserID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleUserHistory(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[usersvc.HistoryInput]](msg.Data)
+	if err != nil {
+		slog.Info("rpc user history invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[userHistoryResponse]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc user history start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "limit", req.Data.Limit)
+
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersRead, req.Data.ID) {
+		return
+	}
+
+	page, err := h.service.UserHistory(context.Background(), req.Data)
+	if err != nil {
+		slog.Error("rpc user history failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[userHistoryResponse](msg, err, "failed to get user history")
+		return
+	}
+
+	out := userHistoryResponse{
+		Entries:    make([]auditEntryDTO, 0, len(page.Entries)),
+		NextCursor: page.NextCursor,
+	}
+	for _, entry := range page.Entries {
+		out.Entries = append(out.Entries, auditEntryDTO{
+			ID:         entry.ID,
+			UserID:     entry.UserID,
+			Action:     entry.Action,
+			Actor:      entry.Audit.Actor,
+			RequestID:  entry.Audit.RequestID,
+			Changes:    entry.Changes,
+			OccurredAt: entry.CreatedAt,
+		})
+	}
+
+	reply(msg, commandOK(out))
+	slog.Info("rpc user history success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "count", len(out.Entries), "has_more", out.NextCursor != "", "duration_ms", time.Since(start).Milliseconds())
+}
+
+// authorize checks the command's actor against the access policy, since NATS callers need
+// not have gone through the gateway; on denial it replies FORBIDDEN and returns false.
+func (h *commandHandler) authorize(msg *nats.Msg, actor *contract.Actor, requestID string, permission authz.Permission, userID string) bool {
+	if h.authorizer == nil {
+		return true
+	}
+	if err := h.authorizer.Authorize(actor, requestID, permission, userID); err != nil {
+		slog.Warn("rpc command forbidden", "subject", msg.Subject, "request_id", requestID, "permission", permission, "error", err)
+		reply(msg, commandError[struct{}]("FORBIDDEN", err.Error()))
+		return false
+	}
+	return true
+}
+
+// verify checks only that the command's actor is signed, for commands that need no
+// permission; otherwise it replies FORBIDDEN and returns false.
+func (h *commandHandler) verify(msg *nats.Msg, actor *contract.Actor, requestID string) bool {
+	if h.authorizer == nil {
+		return true
+	}
+	if err := h.authorizer.Verify(actor, requestID); err != nil {
+		slog.Warn("rpc command forbidden", "subject", msg.Subject, "request_id", requestID, "error", err)
+		reply(msg, commandError[struct{}]("FORBIDDEN", err.Error()))
+		return false
+	}
+	return true
+}
+
+// commandContext carries who issued a mutating command down to the repository,
+// which records it in the audit history of the users it changes.
+func commandContext[T any](req contract.CommandRequest[T]) context.Context {
+	audit := usersvc.Audit{RequestID: req.RequestID}
+	if req.Actor != nil {
+		// the history records who acted, not the roles and signature they acted with
+		audit.Actor = contract.Actor{ID: req.Actor.ID, Source: req.Actor.Source}
+	}
+	return usersvc.WithAudit(context.Background(), audit)
 }
 
 // handle NATS messages and sending responses
-func reply[T any](msg *nats.Msg, resp contract.CommandResponse[T]) {
+func reply[T any](out responder, resp contract.CommandResponse[T]) {
 	payload, err := contract.ToJSON(resp)
 	if err != nil {
 		slog.Error("failed to marshal response", "error", err)
 		return
 	}
-	if err := msg.Respond(payload); err != nil {
+	if err := out.Respond(payload); err != nil {
 		slog.Error("failed to respond command", "error", err)
 	}
 }
@@ -207,55 +556,48 @@ func commandError[T any](code, message string) contract.CommandResponse[T] {
 	}
 }
 
-func replyError[T any](msg *nats.Msg, err error, internalMessage string) {
+func replyError[T any](msg responder, err error, internalMessage string) {
+	reply(msg, contract.CommandResponse[T]{OK: false, Error: commandErrorFor(err, internalMessage)})
+}
+
+// commandErrorFor maps a service error to its command error code; anything unexpected is
+// reported as INTERNAL with internalMessage so no details leak to the caller.
+func commandErrorFor(err error, internalMessage string) *contract.CommandError {
+	var validationErr *usersvc.ValidationError
+	var lockedErr *credential.LockedError
 	switch {
+	case errors.As(err, &validationErr):
+		return &contract.CommandError{Code: "BAD_REQUEST", Message: err.Error(), Violations: validationErr.Violations}
 	case errors.Is(err, usersvc.ErrInvalidInput):
-		reply(msg, commandError[T]("BAD_REQUEST", err.Error()))
+		return &contract.CommandError{Code: "BAD_REQUEST", Message: err.Error()}
 	case errors.Is(err, usersvc.ErrUserNotFound):
-		reply(msg, commandError[T]("NOT_FOUND", err.Error()))
+		return &contract.CommandError{Code: "NOT_FOUND", Message: err.Error()}
 	case errors.Is(err, usersvc.ErrEmailAlreadyExists):
-		reply(msg, commandError[T]("BAD_REQUEST", err.Error()))
+		return &contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonEmailTaken, Message: err.Error()}
+	case errors.Is(err, usersvc.ErrVersionConflict):
+		return &contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonVersionMismatch, Message: err.Error()}
+	case errors.Is(err, usersvc.ErrBulkAborted):
+		return &contract.CommandError{Code: "ABORTED", Message: err.Error()}
+	case errors.Is(err, apikey.ErrInvalidInput):
+		return &contract.CommandError{Code: "BAD_REQUEST", Message: err.Error()}
+	case errors.Is(err, apikey.ErrNotFound), errors.Is(err, apikey.ErrInvalidKey):
+		return &contract.CommandError{Code: "NOT_FOUND", Message: err.Error()}
+	case errors.Is(err, credential.ErrInvalidInput):
+		return &contract.CommandError{Code: "BAD_REQUEST", Message: err.Error()}
+	case errors.Is(err, credential.ErrUserNotFound):
+		return &contract.CommandError{Code: "NOT_FOUND", Message: err.Error()}
+	case errors.Is(err, credential.ErrInvalidCredentials), errors.Is(err, credential.ErrInvalidToken):
+		return &contract.CommandError{Code: "UNAUTHENTICATED", Message: err.Error()}
+	case errors.Is(err, authz.ErrForbidden):
+		return &contract.CommandError{Code: "FORBIDDEN", Message: err.Error()}
+	case errors.As(err, &lockedErr):
+		reason := contract.LockedReasonAccount
+		if lockedErr.Source {
+			reason = contract.LockedReasonSource
+		}
+		retryAfter := int64(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+		return &contract.CommandError{Code: "LOCKED", Reason: reason, Message: err.Error(), RetryAfter: max(retryAfter, 1)}
 	default:
-		reply(msg, commandError[T]("INTERNAL", internalMessage))
-	}
-}
-
-// publish an event to a NATS subject with the given event type and data payload
-func (h *commandHandler) publishEvent(subject, eventType string, data any) error {
-	event := contract.Event[any]{
-		EventID:    uuid.NewString(),
-		Type:       eventType,
-		OccurredAt: time.Now().UTC().Format(time.RFC3339),
-		Data:       data,
-	}
-
-	payload, err := contract.ToJSON(event)
-	if err != nil {
-		return err
-	}
-
-	if err := h.nc.Publish(subject, payload); err != nil {
-		return err
-	}
-
-	slog.Info("event publish succeeded",
-		"subject", subject,
-		"event_type", eventType,
-		"event_id", event.EventID,
-	)
-	return nil
-}
-
-func mapUser(in usersvc.User) userDTO {
-	return userDTO{
-		UserID:    in.UserID,
-		FirstName: in.FirstName,
-		LastName:  in.LastName,
-		Email:     in.Email,
-		Phone:     in.Phone,
-		Age:       in.Age,
-		Status:    in.Status,
-		CreatedAt: in.CreatedAt,
-		UpdatedAt: in.UpdatedAt,
+		return &contract.CommandError{Code: "INTERNAL", Message: internalMessage}
 	}
 }
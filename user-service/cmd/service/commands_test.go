@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	usersvc "user-service/internal/user"
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestCommandErrorFor(t *testing.T) {
+	violations := []contract.FieldViolation{{Field: "email", Rule: "email"}}
+	for _, tc := range []struct {
+		err  error
+		want contract.CommandError
+	}{
+		{
+			err:  &usersvc.ValidationError{Message: "invalid create payload", Violations: violations},
+			want: contract.CommandError{Code: "BAD_REQUEST", Message: "invalid input: invalid create payload", Violations: violations},
+		},
+		{
+			err:  fmt.Errorf("%w: same email as row 1", usersvc.ErrEmailAlreadyExists),
+			want: contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonEmailTaken, Message: "email already exists: same email as row 1"},
+		},
+		{
+			err:  usersvc.ErrVersionConflict,
+			want: contract.CommandError{Code: "CONFLICT", Reason: contract.ConflictReasonVersionMismatch, Message: usersvc.ErrVersionConflict.Error()},
+		},
+		{
+			err:  usersvc.ErrUserNotFound,
+			want: contract.CommandError{Code: "NOT_FOUND", Message: usersvc.ErrUserNotFound.Error()},
+		},
+		{
+			err:  fmt.Errorf("%w: role admin grants permissions the caller does not hold", authz.ErrForbidden),
+			want: contract.CommandError{Code: "FORBIDDEN", Message: "forbidden: role admin grants permissions the caller does not hold"},
+		},
+		{
+			err:  errors.New("connection refused"),
+			want: contract.CommandError{Code: "INTERNAL", Message: "failed to create user"},
+		},
+	} {
+		if got := commandErrorFor(tc.err, "failed to create user"); !reflect.DeepEqual(*got, tc.want) {
+			t.Fatalf("%v: expected %+v, got %+v", tc.err, tc.want, *got)
+		}
+	}
+}
+
+func TestCommandsRejectActorsThePolicyDenies(t *testing.T) {
+	srv := runNATSServer(t)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	authorizer, err := authz.NewAuthorizer(authz.DefaultPolicy(), key)
+	if err != nil {
+		t.Fatalf("new authorizer: %v", err)
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	// no service: every command below must be refused before reaching it
+	handler := newCommandHandler(nil, nil, nil, nil, nil, authorizer)
+	if _, err := subscribeCommands(nc, "user-service", handler.routes()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	signed := usersclient.New(nc, 2*time.Second)
+	signed.SignActors(key)
+	support := usersclient.WithActor(context.Background(), contract.Actor{ID: "agent-7", Source: contract.SourceREST, Roles: []string{"support"}})
+	if err := signed.Delete(support, "9f1c3f52-9d0c-4a8e-8c43-7f5e43a3a001", nil); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected support to be forbidden to delete, got %v", err)
+	}
+	if _, err := signed.List(support, usersclient.ListUsersInput{Filter: usersclient.ListUsersFilter{IncludeDeleted: true}}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected support to be forbidden to list deleted users, got %v", err)
+	}
+	self := usersclient.WithActor(context.Background(), contract.Actor{ID: "u1", Source: contract.SourceREST, Roles: []string{"user"}})
+	if _, err := signed.Update(self, "u2", usersclient.UpdateUserInput{}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected a user to be forbidden to edit another user, got %v", err)
+	}
+	active := "Active"
+	if _, err := signed.Update(self, "u1", usersclient.UpdateUserInput{Status: &active}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected a user to be forbidden to change their own status, got %v", err)
+	}
+	if _, err := signed.SetPassword(self, "u2", usersclient.SetPasswordInput{Password: "correct horse battery"}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected a user to be forbidden to set another user's password, got %v", err)
+	}
+	promote := usersclient.SetPasswordInput{Password: "correct horse battery", CurrentPassword: "old password", Roles: []string{"admin"}}
+	if _, err := signed.SetPassword(self, "u1", promote); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected a user to be forbidden to change their own roles, got %v", err)
+	}
+	// users:write alone does not assign roles, so a batch job cannot reset a user to admin
+	batch := usersclient.WithActor(context.Background(), contract.Actor{ID: "apikey:1", Source: contract.SourceREST, Scopes: []string{"users:write"}, APIKey: true})
+	if _, err := signed.SetPassword(batch, "9f1c3f52-9d0c-4a8e-8c43-7f5e43a3a001", promote); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected a users:write actor to be forbidden to grant admin, got %v", err)
+	}
+	manager := usersclient.WithActor(context.Background(), contract.Actor{ID: "apikey:2", Source: contract.SourceREST, Scopes: []string{"users:read", "users:write", "users:roles"}, APIKey: true})
+	if _, err := signed.SetPassword(manager, "9f1c3f52-9d0c-4a8e-8c43-7f5e43a3a001", promote); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected granting a role above the actor's own permissions to be forbidden, got %v", err)
+	}
+	keyManager := usersclient.WithActor(context.Background(), contract.Actor{ID: "apikey:3", Source: contract.SourceREST, Scopes: []string{"apikeys:manage"}, APIKey: true})
+	if _, err := signed.IssueAPIKey(keyManager, usersclient.IssueAPIKeyInput{Name: "cleanup", Scopes: []string{"users:delete"}}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected issuing a key with a scope the issuer lacks to be forbidden, got %v", err)
+	}
+	// only admins lift a lockout, even the user's own
+	for _, ctx := range []context.Context{self, support} {
+		if _, err := signed.UnlockUser(ctx, "u1"); !errors.Is(err, usersclient.ErrForbidden) {
+			t.Fatalf("expected %+v to be forbidden to unlock accounts, got %v", usersclient.ActorFromContext(ctx), err)
+		}
+	}
+
+	// a caller talking to NATS directly cannot sign, whatever roles it claims
+	unsigned := usersclient.New(nc, 2*time.Second)
+	admin := usersclient.WithActor(context.Background(), contract.Actor{ID: "mallory", Roles: []string{"admin"}})
+	if _, err := unsigned.List(admin, usersclient.ListUsersInput{}); !errors.Is(err, usersclient.ErrForbidden) {
+		t.Fatalf("expected an unsigned actor to be forbidden, got %v", err)
+	}
+}
+
+// emailRepository answers GetByEmail for a single stored user.
+type emailRepository struct {
+	usersvc.Repository
+	user *usersvc.User
+}
+
+func (r *emailRepository) GetByEmail(ctx context.Context, emailNormalized string) (*usersvc.User, error) {
+	if emailNormalized != r.user.Email {
+		return nil, usersvc.ErrUserNotFound
+	}
+	return r.user, nil
+}
+
+func TestGetUserByEmailHidesUsersTheActorMayNotRead(t *testing.T) {
+	srv := runNATSServer(t)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	authorizer, err := authz.NewAuthorizer(authz.DefaultPolicy(), key)
+	if err != nil {
+		t.Fatalf("new authorizer: %v", err)
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	stored := &usersvc.User{UserID: "9f1c3f52-9d0c-4a8e-8c43-7f5e43a3a001", Email: "john@example.com", Status: usersvc.StatusActive, Version: 1}
+	service := usersvc.NewService(&emailRepository{user: stored}, usersvc.Config{})
+	handler := newCommandHandler(service, nil, nil, nil, nil, authorizer)
+	if _, err := subscribeCommands(nc, "user-service", handler.routes()); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	client := usersclient.New(nc, 2*time.Second)
+	client.SignActors(key)
+	owner := usersclient.WithActor(context.Background(), contract.Actor{ID: stored.UserID, Source: contract.SourceREST, Roles: []string{"user"}})
+	if got, err := client.GetByEmail(owner, stored.Email); err != nil || got.UserID != stored.UserID {
+		t.Fatalf("expected users to look up their own email, got %+v, %v", got, err)
+	}
+	// another user's email is answered as if nobody had it
+	other := usersclient.WithActor(context.Background(), contract.Actor{ID: "u2", Source: contract.SourceREST, Roles: []string{"user"}})
+	for _, email := range []string{stored.Email, "nobody@example.com"} {
+		if _, err := client.GetByEmail(other, email); !errors.Is(err, usersclient.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound looking up %s, got %v", email, err)
+		}
+	}
+	support := usersclient.WithActor(context.Background(), contract.Actor{ID: "agent-7", Source: contract.SourceREST, Roles: []string{"support"}})
+	if _, err := client.GetByEmail(support, stored.Email); err != nil {
+		t.Fatalf("expected support to look up any email, got %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"user-service/internal/credential"
+	usersvc "user-service/internal/user"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"user-service/pkg/authz"
+	"user-service/pkg/contract"
+)
+
+const (
+	refreshTokenPruneInterval = time.Hour
+	lockReleaseInterval       = 15 * time.Second // how late the end of a lock may be announced
+)
+
+type setPasswordRequest struct {
+	ID       string `json:"id"`
+	Password string `json:"password"`
+	// CurrentPassword is required when users change their own password.
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	// Roles replaces the roles the user logs in with; unchanged when nil.
+	Roles []string `json:"roles,omitempty"`
+}
+
+type credentialDTO struct {
+	UserID    string    `json:"userId"`
+	Roles     []string  `json:"roles"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type authenticateRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// SourceIP is the address the login comes from; failed logins are counted per address too.
+	SourceIP string `json:"sourceIp,omitempty"`
+}
+
+type unlockDTO struct {
+	UserID    string `json:"userId"`
+	WasLocked bool   `json:"wasLocked"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// sessionDTO is a login or refresh: the gateway turns it into an access token for the user and
+// hands the refresh token to the client.
+type sessionDTO struct {
+	UserID           string    `json:"userId"`
+	Roles            []string  `json:"roles"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+func toSessionDTO(session *credential.Session) sessionDTO {
+	return sessionDTO{
+		UserID:           session.UserID.String(),
+		Roles:            session.Roles,
+		RefreshToken:     session.RefreshToken,
+		RefreshExpiresAt: session.RefreshExpiresAt,
+	}
+}
+
+// checkGrantable returns an error unless the policy defines role and the actor holds all the
+// permissions it grants.
+func (h *commandHandler) checkGrantable(actor *contract.Actor, role string) error {
+	if h.authorizer == nil {
+		return nil
+	}
+	policy := h.authorizer.Policy()
+	if !policy.HasRole(role) {
+		return fmt.Errorf("%w: unknown role %s", usersvc.ErrInvalidInput, role)
+	}
+	if !policy.CanGrant(*actor, role) {
+		return fmt.Errorf("%w: role %s grants permissions the caller does not hold", authz.ErrForbidden, role)
+	}
+	return nil
+}
+
+// checkResettable returns an error unless the actor holds all the permissions of the user's
+// current roles: whoever sets a password can log in with it, so resetting the password of a
+// user of higher rank would take over that rank.
+func (h *commandHandler) checkResettable(ctx context.Context, actor *contract.Actor, userID uuid.UUID) error {
+	if h.authorizer == nil {
+		return nil
+	}
+	roles, err := h.credentials.Roles(ctx, userID)
+	if err != nil {
+		return err
+	}
+	policy := h.authorizer.Policy()
+	for _, role := range roles {
+		if policy.HasRole(role) && !policy.CanGrant(*actor, role) { // roles the policy dropped grant nothing
+			return fmt.Errorf("%w: the user's role %s grants permissions the caller does not hold", authz.ErrForbidden, role)
+		}
+	}
+	return nil
+}
+
+// handleSetPassword sets a user's password. Users may change their own with their current
+// password; setting anyone's roles takes users:roles, and only roles whose permissions the
+// caller holds itself, so nobody can promote themselves or others above their own rank. For
+// the same reason only users of the caller's rank or below can have their password reset.
+func (h *commandHandler) handleSetPassword(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[setPasswordRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc set password invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[credentialDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc set password start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "roles", req.Data.Roles)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, req.Data.ID) {
+		return
+	}
+	if req.Data.Roles != nil {
+		if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersRoles, "") {
+			return
+		}
+		for _, role := range req.Data.Roles {
+			if err := h.checkGrantable(req.Actor, role); err != nil {
+				slog.Info("rpc set password refused role", "subject", msg.Subject, "request_id", req.RequestID, "role", role, "error", err)
+				replyError[credentialDTO](msg, err, "failed to set password")
+				return
+			}
+		}
+	}
+
+	id, err := uuid.Parse(req.Data.ID)
+	if err != nil {
+		reply(msg, commandError[credentialDTO]("BAD_REQUEST", "id must be valid uuid"))
+		return
+	}
+	ctx := context.Background()
+	if _, err := h.service.GetUserByID(ctx, req.Data.ID); err != nil {
+		slog.Info("rpc set password failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[credentialDTO](msg, err, "failed to set password")
+		return
+	}
+	if actorID(req.Actor) == req.Data.ID {
+		if _, err := h.credentials.CheckPassword(ctx, id, req.Data.CurrentPassword); err != nil {
+			slog.Info("rpc set password failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+			if errors.Is(err, credential.ErrInvalidCredentials) {
+				reply(msg, commandError[credentialDTO]("UNAUTHENTICATED", "current password is wrong"))
+				return
+			}
+			replyError[credentialDTO](msg, err, "failed to set password")
+			return
+		}
+	} else if err := h.checkResettable(ctx, req.Actor, id); err != nil {
+		slog.Info("rpc set password refused", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[credentialDTO](msg, err, "failed to set password")
+		return
+	}
+
+	updated, err := h.credentials.SetPassword(ctx, id, req.Data.Password, req.Data.Roles)
+	if err != nil {
+		slog.Info("rpc set password failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[credentialDTO](msg, err, "failed to set password")
+		return
+	}
+
+	reply(msg, commandOK(credentialDTO{UserID: req.Data.ID, Roles: updated.Roles, UpdatedAt: updated.UpdatedAt}))
+	slog.Info("rpc set password success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// handleAuthenticate logs a user in with email and password for the gateway. Like resolving
+// an API key, it needs only a signed actor, since the caller is not authenticated yet.
+// Failed logins lock the account and the source address for a while; see credential.LockoutPolicy.
+func (h *commandHandler) handleAuthenticate(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[authenticateRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc authenticate invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[sessionDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc authenticate start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.verify(msg, req.Actor, req.RequestID) {
+		return
+	}
+
+	ctx := context.Background()
+	userID := uuid.Nil // unknown emails still go through a password check, see Store.Authenticate
+	user, err := h.service.GetUserByEmail(ctx, req.Data.Email)
+	switch {
+	case err == nil:
+		userID, _ = uuid.Parse(user.UserID)
+	case !errors.Is(err, usersvc.ErrUserNotFound) && !errors.Is(err, usersvc.ErrInvalidInput):
+		slog.Error("rpc authenticate failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[sessionDTO](msg, err, "failed to authenticate")
+		return
+	}
+
+	session, err := h.credentials.Authenticate(ctx, credential.LoginAttempt{
+		UserID:   userID,
+		Email:    req.Data.Email,
+		SourceIP: req.Data.SourceIP,
+		Password: req.Data.Password,
+	})
+	if err != nil {
+		slog.Info("rpc authenticate failed", "subject", msg.Subject, "request_id", req.RequestID, "source_ip", req.Data.SourceIP, "error", err)
+		h.relay.Notify() // the failure may have locked the account
+		replyError[sessionDTO](msg, err, "failed to authenticate")
+		return
+	}
+
+	reply(msg, commandOK(toSessionDTO(session)))
+	slog.Info("rpc authenticate success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", session.UserID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleRefreshSession(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[refreshTokenRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc refresh session invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[sessionDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc refresh session start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.verify(msg, req.Actor, req.RequestID) {
+		return
+	}
+
+	session, err := h.credentials.Refresh(context.Background(), req.Data.RefreshToken)
+	if err != nil {
+		slog.Info("rpc refresh session failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[sessionDTO](msg, err, "failed to refresh session")
+		return
+	}
+
+	reply(msg, commandOK(toSessionDTO(session)))
+	slog.Info("rpc refresh session success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", session.UserID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+func (h *commandHandler) handleRevokeSession(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[refreshTokenRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc revoke session invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[struct{}]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc revoke session start", "subject", msg.Subject, "request_id", req.RequestID)
+	if !h.verify(msg, req.Actor, req.RequestID) {
+		return
+	}
+
+	if err := h.credentials.Revoke(context.Background(), req.Data.RefreshToken); err != nil {
+		slog.Info("rpc revoke session failed", "subject", msg.Subject, "request_id", req.RequestID, "error", err)
+		replyError[struct{}](msg, err, "failed to revoke session")
+		return
+	}
+
+	reply(msg, commandOK(struct{}{}))
+	slog.Info("rpc revoke session success", "subject", msg.Subject, "request_id", req.RequestID, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// handleUnlockUser lifts the lock failed logins put on a user's account. It takes users:write on
+// all users, so locked users cannot unlock themselves.
+func (h *commandHandler) handleUnlockUser(msg *nats.Msg) {
+	start := time.Now()
+	req, err := contract.FromJSON[contract.CommandRequest[idRequest]](msg.Data)
+	if err != nil {
+		slog.Info("rpc unlock user invalid request", "subject", msg.Subject, "error", err)
+		reply(msg, commandError[unlockDTO]("BAD_REQUEST", "invalid request"))
+		return
+	}
+	slog.Info("rpc unlock user start", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID)
+	if !h.authorize(msg, req.Actor, req.RequestID, authz.PermUsersWrite, "") {
+		return
+	}
+
+	id, err := uuid.Parse(req.Data.ID)
+	if err != nil {
+		reply(msg, commandError[unlockDTO]("BAD_REQUEST", "id must be valid uuid"))
+		return
+	}
+	ctx := context.Background()
+	if _, err := h.service.GetUserByID(ctx, req.Data.ID); err != nil {
+		slog.Info("rpc unlock user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[unlockDTO](msg, err, "failed to unlock user")
+		return
+	}
+
+	wasLocked, err := h.credentials.Unlock(ctx, id, actorID(req.Actor))
+	if err != nil {
+		slog.Error("rpc unlock user failed", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "error", err)
+		replyError[unlockDTO](msg, err, "failed to unlock user")
+		return
+	}
+	h.relay.Notify()
+
+	reply(msg, commandOK(unlockDTO{UserID: req.Data.ID, WasLocked: wasLocked}))
+	slog.Info("rpc unlock user success", "subject", msg.Subject, "request_id", req.RequestID, "user_id", req.Data.ID, "was_locked", wasLocked, "duration_ms", time.Since(start).Milliseconds())
+}
+
+// runRefreshTokenPruneLoop deletes expired refresh tokens and forgotten failed logins once per
+// interval until ctx is cancelled.
+func runRefreshTokenPruneLoop(ctx context.Context, store *credential.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := store.Prune(ctx)
+		if err != nil {
+			slog.Error("credential prune failed", "error", err)
+			continue
+		}
+		if pruned > 0 {
+			slog.Info("credential prune succeeded", "count", pruned)
+		}
+	}
+}
+
+// runLockReleaseLoop announces the account locks that ended, once per interval until ctx is
+// cancelled. The events go out through the outbox like the ones of user changes.
+func runLockReleaseLoop(ctx context.Context, store *credential.Store, relay *outboxRelay, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		released, err := store.ReleaseExpiredLocks(ctx)
+		if err != nil {
+			slog.Error("login lock release failed", "error", err)
+			continue
+		}
+		if released > 0 {
+			slog.Info("login lock release succeeded", "count", released)
+			relay.Notify()
+		}
+	}
+}
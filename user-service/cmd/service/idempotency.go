@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"user-service/internal/idempotency"
+	"user-service/pkg/contract"
+
+	"github.com/nats-io/nats.go"
+)
+
+const idempotencyPruneInterval = time.Hour
+
+// responder is where a command reply goes; *nats.Msg is the usual one.
+type responder interface {
+	Respond(data []byte) error
+}
+
+// idempotentReply stores the reply under the idempotency key before sending it, so a retry
+// of the same command is answered with it. Internal errors release the key instead, because
+// retrying those may well succeed.
+type idempotentReply struct {
+	msg     *nats.Msg
+	store   *idempotency.Store
+	subject string
+	key     string
+}
+
+func (r *idempotentReply) Respond(data []byte) error {
+	ctx := context.Background()
+	resp, err := contract.FromJSON[contract.CommandResponse[struct{}]](data)
+	if err == nil && !resp.OK && resp.Error != nil && resp.Error.Code == "INTERNAL" {
+		err = r.store.Release(ctx, r.subject, r.key)
+	} else {
+		err = r.store.Complete(ctx, r.subject, r.key, data)
+	}
+	if err != nil {
+		slog.Error("idempotency store failed", "subject", r.subject, "idempotency_key", r.key, "error", err)
+	}
+
+	return r.msg.Respond(data)
+}
+
+// beginIdempotent returns where the command's reply should go, or nil when the command
+// must not run because beginIdempotent already answered it (replay, key reuse, in progress).
+func (h *commandHandler) beginIdempotent(msg *nats.Msg, key string, data any) responder {
+	if key == "" {
+		return msg
+	}
+	if len(key) > idempotency.MaxKeyLen {
+		reply(msg, commandError[struct{}]("BAD_REQUEST", "idempotency key is too long"))
+		return nil
+	}
+
+	payload, err := contract.ToJSON(data)
+	if err != nil {
+		reply(msg, commandError[struct{}]("INTERNAL", "failed to process request"))
+		return nil
+	}
+
+	stored, claimed, err := h.idempotency.Begin(context.Background(), msg.Subject, key, idempotency.HashRequest(payload))
+	switch {
+	case err == nil && claimed:
+		return &idempotentReply{msg: msg, store: h.idempotency, subject: msg.Subject, key: key}
+	case err == nil:
+		slog.Info("rpc idempotent replay", "subject", msg.Subject, "idempotency_key", key)
+		if err := msg.Respond(stored); err != nil {
+			slog.Error("failed to respond command", "error", err)
+		}
+	case errors.Is(err, idempotency.ErrKeyReused):
+		reply(msg, commandError[struct{}]("BAD_REQUEST", err.Error()))
+	case errors.Is(err, idempotency.ErrInProgress):
+		reply(msg, commandError[struct{}]("IN_PROGRESS", err.Error()))
+	default:
+		slog.Error("idempotency claim failed", "subject", msg.Subject, "idempotency_key", key, "error", err)
+		reply(msg, commandError[struct{}]("INTERNAL", "failed to process request"))
+	}
+	return nil
+}
+
+// runIdempotencyPruneLoop deletes expired idempotency keys once per interval until ctx is cancelled.
+func runIdempotencyPruneLoop(ctx context.Context, store *idempotency.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := store.Prune(ctx)
+		if err != nil {
+			slog.Error("idempotency prune failed", "error", err)
+			continue
+		}
+		if pruned > 0 {
+			slog.Info("idempotency prune succeeded", "count", pruned)
+		}
+	}
+}
@@ -2,30 +2,99 @@ package main
 
 import (
 	"context"
-	"os"
-	"path/filepath"
-	"sort"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+
+	"user-service/internal/migrate"
+	"user-service/migrations"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const migrateUsage = "usage: service migrate up | down [steps] | to <version> | status"
+
+// runMigrations brings the schema up to date on startup. It refuses to continue when an
+// applied migration was edited or the database is ahead of this binary.
 func runMigrations(ctx context.Context, dbPool *pgxpool.Pool) error {
-	files, err := filepath.Glob("migrations/*.up.sql")
+	migrator, err := migrate.New(dbPool, migrations.FS)
 	if err != nil {
 		return err
 	}
 
-	sort.Strings(files)
-	for _, path := range files {
-		sqlBytes, readErr := os.ReadFile(path)
-		if readErr != nil {
-			return readErr
-		}
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		slog.Info("migration applied", "version", m.Version, "name", m.Name)
+	}
+	return err
+}
+
+// runMigrateCommand handles `service migrate ...` and writes its report to out.
+func runMigrateCommand(ctx context.Context, dbPool *pgxpool.Pool, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	migrator, err := migrate.New(dbPool, migrations.FS)
+	if err != nil {
+		return err
+	}
 
-		if _, execErr := dbPool.Exec(ctx, string(sqlBytes)); execErr != nil {
-			return execErr
+	var done []migrate.Migration
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive integer; %s", migrateUsage)
+			}
+		}
+		done, err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || version < 0 {
+			return fmt.Errorf("version must be a non-negative integer; %s", migrateUsage)
 		}
+		done, err = migrator.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator, out)
+	default:
+		return errors.New(migrateUsage)
 	}
 
-	return nil
+	for _, m := range done {
+		_, _ = fmt.Fprintf(out, "%s %06d_%s\n", args[0], m.Version, m.Name)
+	}
+	if err == nil && len(done) == 0 {
+		_, _ = fmt.Fprintln(out, "nothing to do")
+	}
+	return err
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrate.Migrator, out io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.AppliedAt != nil {
+			state, appliedAt = "applied", s.AppliedAt.UTC().Format("2006-01-02 15:04:05Z")
+		}
+		if s.Drifted {
+			state = "checksum mismatch"
+		}
+		_, _ = fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return w.Flush()
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	usersvc "user-service/internal/user"
+)
+
+const (
+	outboxBatchSize  = 100
+	outboxPruneEvery = time.Hour
+)
+
+// outboxStore is the part of the repository the relay needs.
+type outboxStore interface {
+	RelayOutbox(ctx context.Context, limit int32, publish func(usersvc.OutboxMessage) error) (int, error)
+	PruneOutbox(ctx context.Context, sentBefore time.Time) (int64, error)
+}
+
+// outboxRelay publishes events committed to the outbox table through an eventPublisher.
+// It polls every interval and also wakes up early when Notify is called.
+type outboxRelay struct {
+	store     outboxStore
+	publisher eventPublisher
+	interval  time.Duration
+	retention time.Duration
+	wake      chan struct{}
+}
+
+func newOutboxRelay(store outboxStore, publisher eventPublisher, interval, retention time.Duration) *outboxRelay {
+	return &outboxRelay{
+		store:     store,
+		publisher: publisher,
+		interval:  interval,
+		retention: retention,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify asks the relay to run soon; it never blocks.
+func (r *outboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default: // a run is already pending
+	}
+}
+
+func (r *outboxRelay) run(ctx context.Context) {
+	slog.Info("outbox relay started", "interval", r.interval.String())
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		r.relayPending(ctx)
+
+		if time.Since(lastPrune) >= outboxPruneEvery {
+			r.prune(ctx)
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// relayPending drains the outbox in batches until a batch comes back short.
+func (r *outboxRelay) relayPending(ctx context.Context) {
+	for {
+		sent, err := r.store.RelayOutbox(ctx, outboxBatchSize, func(msg usersvc.OutboxMessage) error {
+			return r.publish(ctx, msg)
+		})
+		if err != nil {
+			slog.Error("outbox relay failed", "error", err)
+			return
+		}
+		if sent < outboxBatchSize {
+			return
+		}
+	}
+}
+
+func (r *outboxRelay) publish(ctx context.Context, msg usersvc.OutboxMessage) error {
+	if err := r.publisher.Publish(ctx, msg); err != nil {
+		slog.Error("event publish failed", "subject", msg.Subject, "event_id", msg.EventID, "attempts", msg.Attempts, "error", err)
+		return err
+	}
+
+	slog.Info("event publish succeeded", "subject", msg.Subject, "event_id", msg.EventID)
+	return nil
+}
+
+func (r *outboxRelay) prune(ctx context.Context) {
+	pruned, err := r.store.PruneOutbox(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		slog.Error("outbox prune failed", "error", err)
+		return
+	}
+	if pruned > 0 {
+		slog.Info("outbox prune succeeded", "count", pruned)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	usersvc "user-service/internal/user"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const publishTimeout = 2 * time.Second // how long to wait for the server to confirm a publish
+
+// eventPublisher delivers one outbox event to NATS and returns only once the server has it.
+type eventPublisher interface {
+	Publish(ctx context.Context, msg usersvc.OutboxMessage) error
+}
+
+// corePublisher uses plain NATS publish; subscribers that are offline miss the event.
+type corePublisher struct {
+	nc *nats.Conn
+}
+
+func (p corePublisher) Publish(ctx context.Context, msg usersvc.OutboxMessage) error {
+	if err := p.nc.Publish(msg.Subject, msg.Payload); err != nil {
+		return err
+	}
+	// core NATS publish is fire-and-forget; the flush round-trip confirms the server has the message.
+	return p.nc.FlushTimeout(publishTimeout)
+}
+
+// streamPublisher stores events in the USER_EVENTS JetStream stream. The event ID is
+// used as the message ID, so a retry after a lost ack is dropped as a duplicate.
+type streamPublisher struct {
+	js jetstream.JetStream
+}
+
+func (p streamPublisher) Publish(ctx context.Context, msg usersvc.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	_, err := p.js.Publish(ctx, msg.Subject, msg.Payload, jetstream.WithMsgID(msg.EventID))
+	return err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	usersvc "user-service/internal/user"
+)
+
+// runPurgeLoop hard-deletes users that have been soft-deleted for longer than retention,
+// once per interval, until ctx is cancelled.
+func runPurgeLoop(ctx context.Context, service *usersvc.Service, retention, interval time.Duration) {
+	slog.Info("purge loop started", "retention", retention.String(), "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purgeDeletedUsers(ctx, service, retention)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("purge loop stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeDeletedUsers(ctx context.Context, service *usersvc.Service, retention time.Duration) {
+	start := time.Now()
+	purged, err := service.PurgeDeletedUsers(ctx, retention)
+	if err != nil {
+		slog.Error("purge deleted users failed", "error", err)
+		return
+	}
+	if purged > 0 {
+		slog.Info("purge deleted users succeeded", "count", purged, "duration_ms", time.Since(start).Milliseconds())
+	}
+}
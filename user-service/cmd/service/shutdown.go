@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const drainPollInterval = 50 * time.Millisecond
+
+// drainSubscriptions stops the subscriptions from taking new commands and waits until the
+// messages already delivered to them have been handled.
+func drainSubscriptions(ctx context.Context, subs []*nats.Subscription) error {
+	for _, sub := range subs {
+		if err := sub.Drain(); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for _, sub := range subs {
+		for sub.IsValid() { // a drained subscription becomes invalid once its last message is processed
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+	return nil
+}
+
+// waitGroup waits for wg, giving up when ctx ends.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track counts a handler call as in flight until it returns, so shutdown can wait for it.
+func (h *commandHandler) track(next nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		h.inflight.Add(1)
+		defer h.inflight.Done()
+		next(msg)
+	}
+}
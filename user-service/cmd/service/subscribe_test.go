@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func runNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("create nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestSubscribeCommandsSplitsLoadAcrossReplicas(t *testing.T) {
+	srv := runNATSServer(t)
+
+	const commands = 200
+	var (
+		mu        sync.Mutex
+		handledBy = map[string][]string{} // request id -> replicas that handled it
+		perCount  = map[string]int{}
+	)
+
+	startReplica := func(name string) (*nats.Conn, chan struct{}) {
+		closed := make(chan struct{})
+		nc, err := nats.Connect(srv.ClientURL(), nats.ClosedHandler(func(*nats.Conn) { close(closed) }))
+		if err != nil {
+			t.Fatalf("connect %s: %v", name, err)
+		}
+
+		routes := []commandRoute{{subject: contract.SubjectUserCommandCreate, handler: func(msg *nats.Msg) {
+			req, err := contract.FromJSON[contract.CommandRequest[struct{}]](msg.Data)
+			if err != nil {
+				t.Errorf("%s: decode request: %v", name, err)
+				return
+			}
+			mu.Lock()
+			handledBy[req.RequestID] = append(handledBy[req.RequestID], name)
+			perCount[name]++
+			mu.Unlock()
+			reply(msg, commandOK(name))
+		}}}
+		if _, err := subscribeCommands(nc, "user-service", routes); err != nil {
+			t.Fatalf("subscribe %s: %v", name, err)
+		}
+		if err := nc.Flush(); err != nil {
+			t.Fatalf("flush %s: %v", name, err)
+		}
+		return nc, closed
+	}
+
+	replicaA, closedA := startReplica("a")
+	replicaB, closedB := startReplica("b")
+
+	client, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect client: %v", err)
+	}
+	defer client.Close()
+
+	for i := range commands {
+		payload, _ := contract.ToJSON(contract.CommandRequest[struct{}]{RequestID: fmt.Sprintf("req-%d", i)})
+		if _, err := client.Request(contract.SubjectUserCommandCreate, payload, 2*time.Second); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	// draining waits until every delivered message has been handled, so a duplicate would be counted
+	for _, replica := range []struct {
+		nc     *nats.Conn
+		closed chan struct{}
+	}{{replicaA, closedA}, {replicaB, closedB}} {
+		if err := replica.nc.Drain(); err != nil {
+			t.Fatalf("drain replica: %v", err)
+		}
+		select {
+		case <-replica.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replica did not drain")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handledBy) != commands {
+		t.Fatalf("expected %d distinct commands handled, got %d", commands, len(handledBy))
+	}
+	for requestID, replicas := range handledBy {
+		if len(replicas) != 1 {
+			t.Fatalf("command %s handled %d times by %v", requestID, len(replicas), replicas)
+		}
+	}
+	if perCount["a"] == 0 || perCount["b"] == 0 {
+		t.Fatalf("expected both replicas to take load, got a=%d b=%d", perCount["a"], perCount["b"])
+	}
+}
+
+func TestSubscribeCommandsReturnsErrorOnClosedConnection(t *testing.T) {
+	srv := runNATSServer(t)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	nc.Close()
+
+	routes := []commandRoute{{subject: contract.SubjectUserCommandGet, handler: func(*nats.Msg) {}}}
+	if _, err := subscribeCommands(nc, "user-service", routes); err == nil {
+		t.Fatalf("expected an error subscribing on a closed connection")
+	}
+}
+
+func TestDrainSubscriptionsWaitsForInFlightCommands(t *testing.T) {
+	srv := runNATSServer(t)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+
+	h := &commandHandler{}
+	started := make(chan struct{})
+	var finished bool
+	routes := []commandRoute{{subject: contract.SubjectUserCommandDelete, handler: h.track(func(msg *nats.Msg) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		finished = true
+		reply(msg, commandOK("done"))
+	})}}
+	subs, err := subscribeCommands(nc, "user-service", routes)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	if err := nc.PublishRequest(contract.SubjectUserCommandDelete, nats.NewInbox(), []byte(`{}`)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := drainSubscriptions(ctx, subs); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if err := waitGroup(ctx, &h.inflight); err != nil {
+		t.Fatalf("wait in-flight: %v", err)
+	}
+	if !finished {
+		t.Fatalf("expected the in-flight command to finish before drain returned")
+	}
+}
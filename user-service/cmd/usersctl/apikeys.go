@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"user-service/pkg/usersclient"
+)
+
+// apiKeys runs the "apikeys" subcommands; keys are managed with the apikeys:manage permission.
+func (a *app) apiKeys(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: usersctl apikeys issue|list|rotate|revoke [args]")
+	}
+	switch args[0] {
+	case "issue":
+		return a.issueAPIKey(ctx, args[1:])
+	case "list":
+		keys, err := a.apiKeyClient.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return printAPIKeys(a.out, a.format, keys)
+	case "rotate":
+		return a.rotateAPIKey(ctx, args[1:])
+	case "revoke":
+		id, _, err := splitID("apikeys revoke", args[1:])
+		if err != nil {
+			return err
+		}
+		revoked, err := a.apiKeyClient.RevokeAPIKey(ctx, id)
+		if err != nil {
+			return err
+		}
+		return printAPIKeys(a.out, a.format, []usersclient.APIKey{*revoked})
+	default:
+		return fmt.Errorf("unknown apikeys command %q", args[0])
+	}
+}
+
+func (a *app) issueAPIKey(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("apikeys issue", flag.ContinueOnError)
+	name := flags.String("name", "", "what the key is for")
+	scopes := flags.String("scopes", "", "comma-separated permissions, e.g. users:read")
+	expires := flags.Duration("expires", 0, "expire the key after this long (never when 0)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	input := usersclient.IssueAPIKeyInput{Name: *name, Scopes: splitRoles(*scopes)}
+	if *expires > 0 {
+		expiresAt := time.Now().Add(*expires).UTC()
+		input.ExpiresAt = &expiresAt
+	}
+	issued, err := a.apiKeyClient.IssueAPIKey(ctx, input)
+	if err != nil {
+		return err
+	}
+	return printIssuedAPIKey(a.out, a.format, issued)
+}
+
+func (a *app) rotateAPIKey(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("apikeys rotate", flag.ContinueOnError)
+	grace := flags.Duration("grace", -1, "how long the old key keeps working (service default when unset)")
+	id, rest, err := splitID("apikeys rotate", args)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(rest); err != nil {
+		return err
+	}
+
+	var gracePeriod *time.Duration
+	if *grace >= 0 {
+		gracePeriod = grace
+	}
+	issued, err := a.apiKeyClient.RotateAPIKey(ctx, id, gracePeriod)
+	if err != nil {
+		return err
+	}
+	return printIssuedAPIKey(a.out, a.format, issued)
+}
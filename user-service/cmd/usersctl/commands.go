@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"user-service/pkg/usersclient"
+
+	"github.com/nats-io/nats.go"
+)
+
+type app struct {
+	client           usersclient.Client
+	apiKeyClient     usersclient.APIKeyClient
+	credentialClient usersclient.CredentialClient
+	nc               *nats.Conn // only needed by tail
+	in               io.Reader
+	out              io.Writer
+	format           outputFormat
+	timeout          time.Duration
+}
+
+func (a *app) dispatch(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "create":
+		return a.create(ctx, args)
+	case "get":
+		return a.get(ctx, args)
+	case "list":
+		return a.list(ctx, args)
+	case "update":
+		return a.update(ctx, args)
+	case "delete":
+		return a.delete(ctx, args)
+	case "history":
+		return a.history(ctx, args)
+	case "tail":
+		return a.tail(ctx, args)
+	case "apikeys":
+		return a.apiKeys(ctx, args)
+	case "passwd":
+		return a.passwd(ctx, args)
+	case "unlock":
+		return a.unlock(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (a *app) create(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	file := flags.String("f", "-", "JSON body file, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var input usersclient.CreateUserInput
+	if err := a.readBody(*file, &input); err != nil {
+		return err
+	}
+
+	created, err := a.client.Create(ctx, input)
+	if err != nil {
+		return err
+	}
+	return printUsers(a.out, a.format, []usersclient.User{*created})
+}
+
+func (a *app) get(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: usersctl get <id|email>")
+	}
+
+	get := a.client.Get
+	if strings.Contains(args[0], "@") {
+		get = a.client.GetByEmail
+	}
+	found, err := get(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return printUsers(a.out, a.format, []usersclient.User{*found})
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := flags.Int("limit", 0, "page size (server default when 0)")
+	cursor := flags.String("cursor", "", "continue from a previous page's nextCursor")
+	status := flags.String("status", "", "Active or Inactive")
+	emailDomain := flags.String("email-domain", "", "only users with this email domain")
+	includeDeleted := flags.Bool("include-deleted", false, "include soft-deleted users")
+	sortField := flags.String("sort", "", "createdAt, firstName or lastName")
+	order := flags.String("order", "", "asc or desc")
+	all := flags.Bool("all", false, "follow cursors and print every page")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	input := usersclient.ListUsersInput{
+		Limit:  int32(*limit),
+		Cursor: *cursor,
+		Filter: usersclient.ListUsersFilter{Status: *status, EmailDomain: *emailDomain, IncludeDeleted: *includeDeleted},
+		Sort:   usersclient.ListUsersSort{Field: *sortField, Order: *order},
+	}
+
+	var users []usersclient.User
+	nextCursor := ""
+	for {
+		page, err := a.client.List(ctx, input)
+		if err != nil {
+			return err
+		}
+		users = append(users, page.Users...)
+		nextCursor = page.NextCursor
+		if !*all || nextCursor == "" {
+			break
+		}
+		input.Cursor = nextCursor
+	}
+
+	if a.format != formatTable { // same shape as the gateway's GET /users
+		if users == nil {
+			users = []usersclient.User{}
+		}
+		return printValue(a.out, a.format, usersclient.UserPage{Users: users, NextCursor: nextCursor})
+	}
+	if err := printUsers(a.out, a.format, users); err != nil {
+		return err
+	}
+	if nextCursor != "" {
+		_, err := fmt.Fprintf(a.out, "\nnext cursor: %s\n", nextCursor)
+		return err
+	}
+	return nil
+}
+
+func (a *app) update(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	file := flags.String("f", "-", "JSON patch body file, - for stdin")
+	ifVersion := flags.Int("if-version", 0, "only update if the user is still at this version")
+	id, rest, err := splitID("update", args)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(rest); err != nil {
+		return err
+	}
+
+	var input usersclient.UpdateUserInput
+	if err := a.readBody(*file, &input); err != nil {
+		return err
+	}
+	if *ifVersion > 0 {
+		version := int32(*ifVersion)
+		input.ExpectedVersion = &version
+	}
+
+	updated, err := a.client.Update(ctx, id, input)
+	if err != nil {
+		return err
+	}
+	return printUsers(a.out, a.format, []usersclient.User{*updated})
+}
+
+func (a *app) delete(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	ifVersion := flags.Int("if-version", 0, "only delete if the user is still at this version")
+	id, rest, err := splitID("delete", args)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(rest); err != nil {
+		return err
+	}
+
+	var expectedVersion *int32
+	if *ifVersion > 0 {
+		version := int32(*ifVersion)
+		expectedVersion = &version
+	}
+	if err := a.client.Delete(ctx, id, expectedVersion); err != nil {
+		return err
+	}
+	return printValue(a.out, a.format, map[string]string{"message": "user deleted", "userId": id})
+}
+
+func (a *app) history(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := flags.Int("limit", 0, "page size (server default when 0)")
+	cursor := flags.String("cursor", "", "continue from a previous page's nextCursor")
+	id, rest, err := splitID("history", args)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(rest); err != nil {
+		return err
+	}
+
+	page, err := a.client.History(ctx, id, usersclient.HistoryInput{Limit: int32(*limit), Cursor: *cursor})
+	if err != nil {
+		return err
+	}
+	return printHistory(a.out, a.format, page)
+}
+
+// passwd sets a user's password, read from the first line of stdin so it stays out of the
+// shell history.
+func (a *app) passwd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("passwd", flag.ContinueOnError)
+	roles := flags.String("roles", "", "comma-separated roles the user logs in with (unchanged when empty)")
+	id, rest, err := splitID("passwd", args)
+	if err != nil {
+		return err
+	}
+	if err := flags.Parse(rest); err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(a.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read password: %w", err)
+	}
+	input := usersclient.SetPasswordInput{Password: strings.TrimRight(line, "\r\n"), Roles: splitRoles(*roles)}
+	updated, err := a.credentialClient.SetPassword(ctx, id, input)
+	if err != nil {
+		return err
+	}
+	return printValue(a.out, a.format, updated)
+}
+
+// unlock lifts the lock failed logins put on a user's account.
+func (a *app) unlock(ctx context.Context, args []string) error {
+	id, rest, err := splitID("unlock", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("usage: usersctl unlock <id>")
+	}
+	result, err := a.credentialClient.UnlockUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printValue(a.out, a.format, result)
+}
+
+// splitID takes the leading <id> argument so flags may follow it.
+func splitID(command string, args []string) (string, []string, error) {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		return "", nil, fmt.Errorf("usage: usersctl %s <id> [flags]", command)
+	}
+	return args[0], args[1:], nil
+}
+
+// readBody decodes a JSON body from a file, or from stdin when path is "-".
+func (a *app) readBody(path string, dst any) error {
+	var r io.Reader = a.in
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields() // catch typos like "firstname" instead of silently ignoring them
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	return nil
+}
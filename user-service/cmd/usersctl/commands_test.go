@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+)
+
+type fakeClient struct {
+	created   usersclient.CreateUserInput
+	page      *usersclient.UserPage
+	listCalls []usersclient.ListUsersInput
+}
+
+func (c *fakeClient) Create(ctx context.Context, input usersclient.CreateUserInput) (*usersclient.User, error) {
+	c.created = input
+	return &usersclient.User{UserID: "u-1", FirstName: input.FirstName, LastName: input.LastName, Email: input.Email, Status: "Active", Version: 1}, nil
+}
+
+func (c *fakeClient) BulkCreate(ctx context.Context, input usersclient.BulkCreateUsersInput) (*usersclient.BulkCreateReport, error) {
+	return &usersclient.BulkCreateReport{}, nil
+}
+
+func (c *fakeClient) List(ctx context.Context, input usersclient.ListUsersInput) (*usersclient.UserPage, error) {
+	c.listCalls = append(c.listCalls, input)
+	if input.Cursor != "" {
+		return &usersclient.UserPage{Users: []usersclient.User{{UserID: "u-3", Email: "c@example.com"}}}, nil
+	}
+	return c.page, nil
+}
+
+func (c *fakeClient) Search(ctx context.Context, input usersclient.SearchUsersInput) ([]usersclient.SearchResult, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) Get(ctx context.Context, userID string) (*usersclient.User, error) {
+	return &usersclient.User{UserID: userID, FirstName: "John", Phone: ptr("0123"), Version: 2}, nil
+}
+
+func (c *fakeClient) GetByEmail(ctx context.Context, email string) (*usersclient.User, error) {
+	return &usersclient.User{UserID: "u-2", Email: email, Version: 1}, nil
+}
+
+func (c *fakeClient) Update(ctx context.Context, userID string, input usersclient.UpdateUserInput) (*usersclient.User, error) {
+	return &usersclient.User{UserID: userID}, nil
+}
+
+func (c *fakeClient) Delete(ctx context.Context, userID string, expectedVersion *int32) error {
+	return nil
+}
+
+func (c *fakeClient) Restore(ctx context.Context, userID string) (*usersclient.User, error) {
+	return &usersclient.User{UserID: userID}, nil
+}
+
+func (c *fakeClient) History(ctx context.Context, userID string, input usersclient.HistoryInput) (*usersclient.HistoryPage, error) {
+	return &usersclient.HistoryPage{Entries: []usersclient.AuditEntry{{
+		ID:      7,
+		UserID:  userID,
+		Action:  "updated",
+		Actor:   contract.Actor{ID: "alice", Source: contract.SourceCLI},
+		Changes: map[string]contract.FieldChange{"lastName": {Old: "Doe", New: "Roe"}, "email": {Old: "a@x.io", New: "b@x.io"}},
+	}}}, nil
+}
+
+func ptr(s string) *string { return &s }
+
+func TestCreateReadsBodyFromStdin(t *testing.T) {
+	client := &fakeClient{}
+	var out bytes.Buffer
+	a := &app{client: client, in: strings.NewReader(`{"firstName":"John","lastName":"Doe","email":"john@example.com"}`), out: &out, format: formatJSON}
+
+	if err := a.dispatch(context.Background(), "create", nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if client.created.Email != "john@example.com" {
+		t.Fatalf("expected body from stdin, got %+v", client.created)
+	}
+	if !strings.Contains(out.String(), `"userId": "u-1"`) {
+		t.Fatalf("expected JSON output, got %s", out.String())
+	}
+}
+
+func TestCreateRejectsUnknownFields(t *testing.T) {
+	a := &app{client: &fakeClient{}, in: strings.NewReader(`{"nickname":"Johnny"}`), out: &bytes.Buffer{}, format: formatJSON}
+
+	if err := a.dispatch(context.Background(), "create", nil); err == nil {
+		t.Fatalf("expected an error for an unknown field")
+	}
+}
+
+func TestListAllFollowsCursorsAsTable(t *testing.T) {
+	client := &fakeClient{page: &usersclient.UserPage{
+		Users:      []usersclient.User{{UserID: "u-1", Email: "a@example.com", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, {UserID: "u-2", Email: "b@example.com"}},
+		NextCursor: "next",
+	}}
+	var out bytes.Buffer
+	a := &app{client: client, out: &out, format: formatTable}
+
+	if err := a.dispatch(context.Background(), "list", []string{"-all", "-limit", "2", "-status", "Active"}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(client.listCalls) != 2 || client.listCalls[1].Cursor != "next" || client.listCalls[0].Filter.Status != "Active" {
+		t.Fatalf("unexpected list calls %+v", client.listCalls)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "2024-01-02T03:04:05Z") {
+		t.Fatalf("unexpected table:\n%s", out.String())
+	}
+}
+
+func TestGetAsYAMLUsesJSONKeys(t *testing.T) {
+	var out bytes.Buffer
+	a := &app{client: &fakeClient{}, out: &out, format: formatYAML}
+
+	if err := a.dispatch(context.Background(), "get", []string{"u-9"}); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"userId: u-9\n", "firstName: John\n", `phone: "0123"`, "version: 2\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in YAML output:\n%s", want, got)
+		}
+	}
+}
+
+func TestGetByEmail(t *testing.T) {
+	var out bytes.Buffer
+	a := &app{client: &fakeClient{}, out: &out, format: formatJSON}
+
+	if err := a.dispatch(context.Background(), "get", []string{"Bob@Example.com"}); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !strings.Contains(out.String(), `"userId": "u-2"`) {
+		t.Fatalf("expected the user found by email, got:\n%s", out.String())
+	}
+}
+
+func TestHistoryTableListsChangedFields(t *testing.T) {
+	var out bytes.Buffer
+	a := &app{client: &fakeClient{}, out: &out, format: formatTable}
+
+	if err := a.dispatch(context.Background(), "history", []string{"u-1", "-limit", "5"}); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "alice") || !strings.Contains(lines[1], "email,lastName") {
+		t.Fatalf("unexpected table:\n%s", out.String())
+	}
+}
+
+func TestPrintEventTable(t *testing.T) {
+	var out bytes.Buffer
+	payload := []byte(`{"eventId":"e-1","type":"user.updated","occurredAt":"2024-01-02T03:04:05Z","data":{"userId":"u-1","email":"a@example.com","version":3},"changes":{"status":{"old":"Active","new":"Inactive"},"email":{"old":"b@example.com","new":"a@example.com"}}}`)
+
+	if err := printEvent(&out, formatTable, "user.event.updated", payload); err != nil {
+		t.Fatalf("print event: %v", err)
+	}
+	want := "2024-01-02T03:04:05Z  user.updated   user=u-1 email=a@example.com version=3 changed=email,status\n"
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+}
+
+type fakeAPIKeyClient struct {
+	usersclient.APIKeyClient
+	issued usersclient.IssueAPIKeyInput
+	grace  *time.Duration
+}
+
+func (c *fakeAPIKeyClient) IssueAPIKey(ctx context.Context, input usersclient.IssueAPIKeyInput) (*usersclient.IssuedAPIKey, error) {
+	c.issued = input
+	return &usersclient.IssuedAPIKey{
+		APIKey: usersclient.APIKey{ID: "k-1", Name: input.Name, Scopes: input.Scopes, CreatedAt: time.Now()},
+		Key:    "uk_secret",
+	}, nil
+}
+
+func (c *fakeAPIKeyClient) RotateAPIKey(ctx context.Context, keyID string, grace *time.Duration) (*usersclient.IssuedAPIKey, error) {
+	c.grace = grace
+	return &usersclient.IssuedAPIKey{
+		APIKey: usersclient.APIKey{ID: "k-2", Name: "ci", RotatedFrom: keyID, CreatedAt: time.Now()},
+		Key:    "uk_rotated",
+	}, nil
+}
+
+func TestAPIKeysIssuePrintsKeyOnce(t *testing.T) {
+	var out bytes.Buffer
+	keys := &fakeAPIKeyClient{}
+	a := &app{apiKeyClient: keys, out: &out, format: formatTable}
+
+	args := []string{"issue", "-name", "ci", "-scopes", "users:read, users:write", "-expires", "24h"}
+	if err := a.dispatch(context.Background(), "apikeys", args); err != nil {
+		t.Fatalf("apikeys issue: %v", err)
+	}
+	if keys.issued.Name != "ci" || len(keys.issued.Scopes) != 2 || keys.issued.Scopes[1] != "users:write" {
+		t.Fatalf("unexpected issue input: %+v", keys.issued)
+	}
+	if keys.issued.ExpiresAt == nil || time.Until(*keys.issued.ExpiresAt) < 23*time.Hour {
+		t.Fatalf("expected an expiry a day from now, got %v", keys.issued.ExpiresAt)
+	}
+	if !strings.Contains(out.String(), "key (shown only once): uk_secret") {
+		t.Fatalf("expected the key value, got:\n%s", out.String())
+	}
+}
+
+func TestAPIKeysRotateUsesServiceGraceByDefault(t *testing.T) {
+	keys := &fakeAPIKeyClient{}
+	a := &app{apiKeyClient: keys, out: &bytes.Buffer{}, format: formatJSON}
+
+	if err := a.dispatch(context.Background(), "apikeys", []string{"rotate", "k-1"}); err != nil {
+		t.Fatalf("apikeys rotate: %v", err)
+	}
+	if keys.grace != nil {
+		t.Fatalf("expected no grace period, got %v", *keys.grace)
+	}
+
+	if err := a.dispatch(context.Background(), "apikeys", []string{"rotate", "k-1", "-grace", "0s"}); err != nil {
+		t.Fatalf("apikeys rotate: %v", err)
+	}
+	if keys.grace == nil || *keys.grace != 0 {
+		t.Fatalf("expected an immediate cutover, got %v", keys.grace)
+	}
+}
+
+type fakeCredentialClient struct {
+	usersclient.CredentialClient
+	userID string
+	input  usersclient.SetPasswordInput
+}
+
+func (c *fakeCredentialClient) SetPassword(ctx context.Context, userID string, input usersclient.SetPasswordInput) (*usersclient.Credential, error) {
+	c.userID, c.input = userID, input
+	return &usersclient.Credential{UserID: userID, Roles: []string{"admin"}}, nil
+}
+
+func TestPasswdReadsPasswordFromStdin(t *testing.T) {
+	credentials := &fakeCredentialClient{}
+	a := &app{credentialClient: credentials, in: strings.NewReader("correct horse battery\n"), out: &bytes.Buffer{}, format: formatJSON}
+
+	if err := a.dispatch(context.Background(), "passwd", []string{"u-1", "-roles", "admin"}); err != nil {
+		t.Fatalf("passwd: %v", err)
+	}
+	if credentials.userID != "u-1" || credentials.input.Password != "correct horse battery" {
+		t.Fatalf("unexpected set password call: %s %+v", credentials.userID, credentials.input)
+	}
+	if len(credentials.input.Roles) != 1 || credentials.input.Roles[0] != "admin" {
+		t.Fatalf("expected the admin role, got %v", credentials.input.Roles)
+	}
+}
@@ -0,0 +1,126 @@
+// usersctl inspects and changes users from a terminal by sending the same NATS commands
+// as the API gateway.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"user-service/pkg/contract"
+	"user-service/pkg/usersclient"
+
+	"github.com/nats-io/nats.go"
+)
+
+const usage = `usage: usersctl [flags] <command> [args]
+
+commands:
+  create [-f file]              create a user from a JSON body (stdin by default)
+  get <id|email>               show one user, looked up by id or email
+  list [flags]                  list users (see usersctl list -h)
+  update <id> [-f file] [-if-version n]
+                                apply a JSON patch body (stdin by default)
+  delete <id> [-if-version n]   soft-delete a user
+  history <id> [-limit n] [-cursor c]
+                                show who changed a user and what changed
+  tail                          print user events as they arrive
+  passwd <id> [-roles r,s]      set a user's password, read from stdin, and optionally their roles
+  unlock <id>                   lift the lock failed logins put on a user's account
+  apikeys issue -name n -scopes a,b [-expires d]
+                                issue an API key; its value is only shown once
+  apikeys list                  list API keys
+  apikeys rotate <id> [-grace d]
+                                issue a successor, keeping the old key working for d
+  apikeys revoke <id>           revoke an API key immediately
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "usersctl:", err)
+		for _, violation := range usersclient.FieldViolations(err) {
+			fmt.Fprintf(os.Stderr, "  %s: failed %s\n", violation.Field, strings.TrimSpace(violation.Rule+" "+violation.Param))
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("usersctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	natsURL := flags.String("nats", envOr("NATS_URL", nats.DefaultURL), "NATS server URL")
+	output := flags.String("o", "table", "output format: table, json or yaml")
+	timeout := flags.Duration("timeout", 5*time.Second, "per-command timeout")
+	actor := flags.String("actor", os.Getenv("USER"), "who the changes are recorded as in the audit history")
+	roles := flags.String("roles", "admin", "comma-separated roles to act with, checked against the service's access policy")
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	format, err := parseFormat(*output)
+	if err != nil {
+		return err
+	}
+
+	nc, err := nats.Connect(*natsURL, nats.Name("usersctl"))
+	if err != nil {
+		return fmt.Errorf("connect to nats %s: %w", *natsURL, err)
+	}
+	defer nc.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = usersclient.WithActor(ctx, contract.Actor{ID: *actor, Source: contract.SourceCLI, Roles: splitRoles(*roles)})
+
+	// the service only accepts commands whose actor is signed with its ACTOR_SIGNING_KEY
+	client := usersclient.New(nc, *timeout)
+	if key := os.Getenv("ACTOR_SIGNING_KEY"); key != "" {
+		client.SignActors([]byte(key))
+	}
+
+	a := &app{
+		client:           client,
+		apiKeyClient:     client,
+		credentialClient: client,
+		nc:               nc,
+		in:               stdin,
+		out:              stdout,
+		format:           format,
+		timeout:          *timeout,
+	}
+	return a.dispatch(ctx, flags.Arg(0), flags.Args()[1:])
+}
+
+func splitRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
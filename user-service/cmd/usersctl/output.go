@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"user-service/pkg/usersclient"
+
+	"gopkg.in/yaml.v3"
+)
+
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+)
+
+func parseFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(value); format {
+	case formatTable, formatJSON, formatYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (want table, json or yaml)", value)
+	}
+}
+
+// printUsers writes users as a table; for JSON/YAML a single user is written as an object.
+func printUsers(w io.Writer, format outputFormat, users []usersclient.User) error {
+	if format != formatTable {
+		if len(users) == 1 {
+			return printValue(w, format, users[0])
+		}
+		return printValue(w, format, users)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tFIRST NAME\tLAST NAME\tEMAIL\tSTATUS\tVERSION\tCREATED\tDELETED")
+	for _, u := range users {
+		deleted := ""
+		if u.DeletedAt != nil {
+			deleted = u.DeletedAt.UTC().Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			u.UserID, u.FirstName, u.LastName, u.Email, u.Status, u.Version, u.CreatedAt.UTC().Format(time.RFC3339), deleted)
+	}
+	return tw.Flush()
+}
+
+// printHistory writes audit entries as a table listing the changed fields of each entry.
+func printHistory(w io.Writer, format outputFormat, page *usersclient.HistoryPage) error {
+	if format != formatTable {
+		return printValue(w, format, page)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tACTION\tACTOR\tSOURCE\tFIELDS\tOCCURRED")
+	for _, e := range page.Entries {
+		fields := make([]string, 0, len(e.Changes))
+		for field := range e.Changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.Action, e.Actor.ID, e.Actor.Source, strings.Join(fields, ","), e.OccurredAt.UTC().Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if page.NextCursor != "" {
+		_, err := fmt.Fprintf(w, "\nnext cursor: %s\n", page.NextCursor)
+		return err
+	}
+	return nil
+}
+
+// printAPIKeys writes API keys as a table; for JSON/YAML a single key is written as an object.
+func printAPIKeys(w io.Writer, format outputFormat, keys []usersclient.APIKey) error {
+	if format != formatTable {
+		if len(keys) == 1 {
+			return printValue(w, format, keys[0])
+		}
+		return printValue(w, format, keys)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES\tREVOKED\tLAST USED")
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, strings.Join(k.Scopes, ","), k.CreatedAt.UTC().Format(time.RFC3339),
+			formatTime(k.ExpiresAt), formatTime(k.RevokedAt), formatTime(k.LastUsedAt))
+	}
+	return tw.Flush()
+}
+
+// printIssuedAPIKey writes a new key followed by its value, which the service never shows again.
+func printIssuedAPIKey(w io.Writer, format outputFormat, issued *usersclient.IssuedAPIKey) error {
+	if format != formatTable {
+		return printValue(w, format, issued)
+	}
+	if err := printAPIKeys(w, format, []usersclient.APIKey{issued.APIKey}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nkey (shown only once): %s\n", issued.Key)
+	return err
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// printValue writes v as indented JSON or as YAML with the same (camelCase) keys.
+// Table output of arbitrary values falls back to JSON.
+func printValue(w io.Writer, format outputFormat, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format != formatYAML {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	// YAML is a superset of JSON: parsing the JSON keeps the json tags and field order,
+	// and clearing the flow style turns it into block YAML.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode && node.Style&yaml.DoubleQuotedStyle != 0 {
+		node.Style &^= yaml.DoubleQuotedStyle // let the encoder quote only where needed
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
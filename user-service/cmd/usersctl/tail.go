@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"user-service/pkg/contract"
+
+	"github.com/nats-io/nats.go"
+)
+
+// tail prints user events until interrupted.
+func (a *app) tail(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	subject := flags.String("subject", "user.event.*", "subject to subscribe to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	events := make(chan *nats.Msg, 64)
+	sub, err := a.nc.ChanSubscribe(*subject, events)
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", *subject, err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-events:
+			if err := printEvent(a.out, a.format, msg.Subject, msg.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// printEvent renders one event; payloads that are not events are shown raw rather than dropped.
+func printEvent(w io.Writer, format outputFormat, subject string, payload []byte) error {
+	event, err := contract.FromJSON[contract.Event[json.RawMessage]](payload)
+	if err != nil {
+		_, err = fmt.Fprintf(w, "%s\t(unparsed) %s\n", subject, payload)
+		return err
+	}
+
+	switch format {
+	case formatTable:
+		var data struct {
+			UserID  string `json:"userId"`
+			Email   string `json:"email"`
+			Version int32  `json:"version"`
+		}
+		_ = json.Unmarshal(event.Data, &data)
+		line := fmt.Sprintf("%s  %-14s user=%s", event.OccurredAt, event.Type, data.UserID)
+		if data.Email != "" {
+			line += " email=" + data.Email
+		}
+		if data.Version > 0 {
+			line += fmt.Sprintf(" version=%d", data.Version)
+		}
+		if len(event.Changes) > 0 {
+			fields := make([]string, 0, len(event.Changes))
+			for field := range event.Changes {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			line += " changed=" + strings.Join(fields, ",")
+		}
+		_, err = fmt.Fprintln(w, line)
+		return err
+	case formatYAML:
+		if _, err := fmt.Fprintln(w, "---"); err != nil {
+			return err
+		}
+	}
+	return printValue(w, format, struct {
+		Subject string `json:"subject"`
+		contract.Event[json.RawMessage]
+	}{Subject: subject, Event: event})
+}
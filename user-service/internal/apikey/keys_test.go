@@ -0,0 +1,73 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNewKeyParsesBack(t *testing.T) {
+	id := uuid.New()
+	key, hash, err := newKey(id)
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+
+	gotID, secret, err := parseKey(key)
+	if err != nil {
+		t.Fatalf("parse %s: %v", key, err)
+	}
+	if gotID != id || string(hashSecret(secret)) != string(hash) {
+		t.Fatalf("expected id %s and the issued secret back, got %s", id, gotID)
+	}
+	if strings.Contains(key[len(keyPrefix):], "-") {
+		t.Fatalf("expected no dashes, so the key survives double-click selection: %s", key)
+	}
+}
+
+func TestParseKeyRejectsMalformedKeys(t *testing.T) {
+	for _, key := range []string{
+		"",
+		"sk_0123456789abcdef0123456789abcdef_secret",
+		"uk_0123456789abcdef0123456789abcdef",
+		"uk_0123456789abcdef0123456789abcdef_",
+		"uk_0123456789abcdef_secret",
+		"uk_zz23456789abcdef0123456789abcdef_secret",
+	} {
+		if _, _, err := parseKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("%q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestIssueInputValidate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	for _, in := range []IssueInput{
+		{Name: " ", Scopes: []string{"users:read"}},
+		{Name: "nightly export"},
+		{Name: "nightly export", Scopes: []string{"users:everything"}},
+		{Name: "nightly export", Scopes: []string{"users:read"}, ExpiresAt: &past},
+	} {
+		if err := in.validate(now); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%+v: expected ErrInvalidInput, got %v", in, err)
+		}
+	}
+	if err := (IssueInput{Name: "nightly export", Scopes: []string{"users:read"}}).validate(now); err != nil {
+		t.Fatalf("expected a valid input, got %v", err)
+	}
+}
+
+func TestKeyActive(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	if !(Key{}).Active(now) || !(Key{ExpiresAt: &later}).Active(now) {
+		t.Fatalf("expected keys without expiry or expiring later to be active")
+	}
+	if (Key{ExpiresAt: &earlier}).Active(now) || (Key{RevokedAt: &earlier}).Active(now) {
+		t.Fatalf("expected expired and revoked keys to be inactive")
+	}
+}
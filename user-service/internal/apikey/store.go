@@ -0,0 +1,194 @@
+package apikey
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	db "user-service/internal/db/sqlc"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Store struct {
+	pool    *pgxpool.Pool
+	queries *db.Queries
+	now     func() time.Time
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool, queries: db.New(pool), now: time.Now}
+}
+
+// Issue creates a key on behalf of createdBy.
+func (s *Store) Issue(ctx context.Context, input IssueInput, createdBy string) (*Issued, error) {
+	if err := input.validate(s.now()); err != nil {
+		return nil, err
+	}
+	params := db.InsertAPIKeyParams{Name: strings.TrimSpace(input.Name), Scopes: normalizedScopes(input.Scopes), CreatedBy: createdBy}
+	if input.ExpiresAt != nil {
+		params.ExpiresAt = pgtype.Timestamptz{Time: *input.ExpiresAt, Valid: true}
+	}
+	return insertKey(ctx, s.queries, params)
+}
+
+// List returns every key, newest first, including revoked and expired ones.
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.queries.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, toKey(row))
+	}
+	return keys, nil
+}
+
+// Rotate issues a successor of the active key id with the same name, scopes and expiry. The
+// old key keeps working for grace, so clients can switch over without downtime.
+func (s *Store) Rotate(ctx context.Context, id uuid.UUID, grace time.Duration, createdBy string) (*Issued, error) {
+	if grace < 0 || grace > MaxRotateGrace {
+		return nil, fmt.Errorf("%w: grace must be between 0 and %s", ErrInvalidInput, MaxRotateGrace)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	old, err := q.LockAPIKey(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	now := s.now()
+	if !toKey(old).Active(now) {
+		return nil, fmt.Errorf("%w: only an active key can be rotated", ErrInvalidInput)
+	}
+
+	issued, err := insertKey(ctx, q, db.InsertAPIKeyParams{
+		Name:        old.Name,
+		Scopes:      old.Scopes,
+		CreatedBy:   createdBy,
+		ExpiresAt:   old.ExpiresAt,
+		RotatedFrom: old.KeyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := q.ExpireAPIKey(ctx, db.ExpireAPIKeyParams{
+		KeyID:     old.KeyID,
+		ExpiresAt: pgtype.Timestamptz{Time: now.Add(grace), Valid: true},
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// Revoke disables the key for good. Revoking a revoked key is ErrNotFound.
+func (s *Store) Revoke(ctx context.Context, id uuid.UUID) (*Key, error) {
+	row, err := s.queries.RevokeAPIKey(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	key := toKey(row)
+	return &key, nil
+}
+
+// Resolve returns the active key the presented key value belongs to, or ErrInvalidKey.
+func (s *Store) Resolve(ctx context.Context, value string) (*Key, error) {
+	id, secret, err := parseKey(value)
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.queries.GetAPIKey(ctx, pgtype.UUID{Bytes: id, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(row.SecretHash, hashSecret(secret)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	key := toKey(row)
+	if !key.Active(s.now()) {
+		return nil, ErrInvalidKey
+	}
+	return &key, nil
+}
+
+// Touch records that the keys were used at usedAt.
+func (s *Store) Touch(ctx context.Context, ids []uuid.UUID, usedAt time.Time) (int64, error) {
+	keyIDs := make([]pgtype.UUID, 0, len(ids))
+	for _, id := range ids {
+		keyIDs = append(keyIDs, pgtype.UUID{Bytes: id, Valid: true})
+	}
+	return s.queries.TouchAPIKeys(ctx, db.TouchAPIKeysParams{
+		KeyIds: keyIDs,
+		UsedAt: pgtype.Timestamptz{Time: usedAt, Valid: true},
+	})
+}
+
+// insertKey generates a key for params and stores it.
+func insertKey(ctx context.Context, q *db.Queries, params db.InsertAPIKeyParams) (*Issued, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	secret, hash, err := newKey(id)
+	if err != nil {
+		return nil, err
+	}
+	params.KeyID = pgtype.UUID{Bytes: id, Valid: true}
+	params.SecretHash = hash
+
+	row, err := q.InsertAPIKey(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &Issued{Key: toKey(row), Secret: secret}, nil
+}
+
+func toKey(row db.ApiKey) Key {
+	key := Key{
+		ID:        uuid.UUID(row.KeyID.Bytes),
+		Name:      row.Name,
+		Scopes:    row.Scopes,
+		CreatedBy: row.CreatedBy,
+		CreatedAt: row.CreatedAt.Time,
+	}
+	key.ExpiresAt = timePtr(row.ExpiresAt)
+	key.RevokedAt = timePtr(row.RevokedAt)
+	key.LastUsedAt = timePtr(row.LastUsedAt)
+	if row.RotatedFrom.Valid {
+		from := uuid.UUID(row.RotatedFrom.Bytes)
+		key.RotatedFrom = &from
+	}
+	return key
+}
+
+func timePtr(value pgtype.Timestamptz) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := value.Time
+	return &t
+}
@@ -0,0 +1,371 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+
+	db "user-service/internal/db/sqlc"
+	"user-service/pkg/contract"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// event types carried in contract.Event.Type.
+const (
+	EventTypeLocked   = "user.locked"
+	EventTypeUnlocked = "user.unlocked"
+)
+
+// why a lock ended, carried in the unlocked event.
+const (
+	UnlockReasonExpired = "expired"
+	UnlockReasonAdmin   = "admin"
+)
+
+// scopes failed logins are counted in.
+const (
+	scopeUser  = "user"
+	scopeEmail = "email"
+	scopeIP    = "ip"
+)
+
+// ipv6PrefixLen groups IPv6 sources by network: a single client usually holds a whole /64.
+const ipv6PrefixLen = 64
+
+var ErrLocked = errors.New("too many failed logins")
+
+// LockedError refuses a login without checking the password: the account, or the address the
+// login comes from, is locked until Until.
+type LockedError struct {
+	Until  time.Time
+	Source bool // the source address is locked rather than the account
+}
+
+func (e *LockedError) Error() string {
+	if e.Source {
+		return ErrLocked.Error() + " from this address, try again later"
+	}
+	return ErrLocked.Error() + " for this account, try again later"
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// LockoutPolicy is when failed logins lock an account or a source address. Each lock in a row
+// lasts twice as long as the one before, from BaseDuration up to MaxDuration; failures and
+// locks are forgotten after ResetAfter without a failure or a lock.
+type LockoutPolicy struct {
+	Threshold       int // failed logins of one account before it is locked; 0 never locks accounts
+	SourceThreshold int // failed logins from one address, for any accounts, before it is locked; 0 never locks addresses
+	BaseDuration    time.Duration
+	MaxDuration     time.Duration
+	ResetAfter      time.Duration
+}
+
+// DefaultLockoutPolicy locks an account for a minute after 5 failed logins, up to an hour when
+// it keeps happening. Many users can share an address, so addresses get more tries.
+var DefaultLockoutPolicy = LockoutPolicy{
+	Threshold:       5,
+	SourceThreshold: 50,
+	BaseDuration:    time.Minute,
+	MaxDuration:     time.Hour,
+	ResetAfter:      15 * time.Minute,
+}
+
+func (p LockoutPolicy) validate() error {
+	if p.Threshold < 0 || p.SourceThreshold < 0 {
+		return errors.New("lockout thresholds must not be negative")
+	}
+	if p.BaseDuration <= 0 || p.MaxDuration < p.BaseDuration || p.ResetAfter <= 0 {
+		return fmt.Errorf("lockout durations must satisfy 0 < base (%s) <= max (%s) and reset (%s) > 0", p.BaseDuration, p.MaxDuration, p.ResetAfter)
+	}
+	return nil
+}
+
+// lockDuration is how long lock number n in a row lasts.
+func (p LockoutPolicy) lockDuration(n int32) time.Duration {
+	d := p.BaseDuration
+	for i := int32(1); i < n && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDuration)
+}
+
+// throttle is the failure count of one account or address.
+type throttle struct {
+	failures    int32
+	lockouts    int32 // locks in a row
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// fail counts a failed login at now and reports whether it locked the account or address.
+func (p LockoutPolicy) fail(t throttle, threshold int, now time.Time) (throttle, bool) {
+	if now.Before(t.lockedUntil) { // raced with the login that locked it
+		return t, false
+	}
+	if !now.Before(later(t.lastFailure, t.lockedUntil).Add(p.ResetAfter)) {
+		t = throttle{lockedUntil: t.lockedUntil}
+	}
+	t.failures++
+	t.lastFailure = now
+	if int(t.failures) < threshold {
+		return t, false
+	}
+	t.failures = 0
+	t.lockouts++
+	t.lockedUntil = now.Add(p.lockDuration(t.lockouts))
+	return t, true
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// LoginAttempt is a login to check. UserID is uuid.Nil when no user has Email; SourceIP is
+// where the login comes from, empty when unknown.
+type LoginAttempt struct {
+	UserID   uuid.UUID
+	Email    string
+	SourceIP string
+	Password string
+}
+
+// throttleKey names the row failed logins of an account or address are counted in.
+type throttleKey struct {
+	scope     string
+	subject   string
+	userID    uuid.UUID // set for scopeUser
+	threshold int
+}
+
+// throttleKeys returns the counters attempt is checked against: its account, known or not,
+// and its source address.
+func (s *Store) throttleKeys(attempt LoginAttempt) ([]throttleKey, error) {
+	var keys []throttleKey
+	if p := s.cfg.Lockout; p.Threshold > 0 {
+		if attempt.UserID != uuid.Nil {
+			keys = append(keys, throttleKey{scope: scopeUser, subject: attempt.UserID.String(), userID: attempt.UserID, threshold: p.Threshold})
+		} else {
+			keys = append(keys, throttleKey{scope: scopeEmail, subject: strings.ToLower(strings.TrimSpace(attempt.Email)), threshold: p.Threshold})
+		}
+	}
+	if attempt.SourceIP != "" && s.cfg.Lockout.SourceThreshold > 0 {
+		source, err := sourceKey(attempt.SourceIP)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, throttleKey{scope: scopeIP, subject: source, threshold: s.cfg.Lockout.SourceThreshold})
+	}
+	return keys, nil
+}
+
+// sourceKey is the address failed logins from ip are counted under: the address itself for
+// IPv4, its /64 network for IPv6.
+func sourceKey(ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", fmt.Errorf("%w: source ip %q is not an IP address", ErrInvalidInput, ip)
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return addr.String(), nil
+	}
+	return netip.PrefixFrom(addr, ipv6PrefixLen).Masked().String(), nil
+}
+
+// checkLocked returns a LockedError when one of keys is locked.
+func (s *Store) checkLocked(ctx context.Context, keys []throttleKey) error {
+	now := s.now()
+	for _, key := range keys {
+		row, err := s.queries.GetLoginThrottle(ctx, db.GetLoginThrottleParams{Scope: key.scope, Subject: key.subject})
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if row.LockedUntil.Valid && now.Before(row.LockedUntil.Time) {
+			return &LockedError{Until: row.LockedUntil.Time, Source: key.scope == scopeIP}
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login against each of keys, locking those that reach their
+// threshold. A locked user account is announced with a user.event.locked event.
+func (s *Store) recordFailure(ctx context.Context, keys []throttleKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	now := s.now()
+	for _, key := range keys {
+		params := db.EnsureLoginThrottleParams{Scope: key.scope, Subject: key.subject}
+		if key.userID != uuid.Nil {
+			params.UserID = pgtype.UUID{Bytes: key.userID, Valid: true}
+		}
+		if err := q.EnsureLoginThrottle(ctx, params); err != nil {
+			return err
+		}
+		row, err := q.LockLoginThrottle(ctx, db.LockLoginThrottleParams{Scope: key.scope, Subject: key.subject})
+		if err != nil {
+			return err
+		}
+
+		next, locked := s.cfg.Lockout.fail(throttle{
+			failures:    row.Failures,
+			lockouts:    row.Lockouts,
+			lastFailure: row.LastFailureAt.Time,
+			lockedUntil: row.LockedUntil.Time,
+		}, key.threshold, now)
+		update := db.UpdateLoginThrottleParams{
+			Failures:      next.failures,
+			Lockouts:      next.lockouts,
+			LastFailureAt: pgtype.Timestamptz{Time: next.lastFailure, Valid: true},
+			LockedUntil:   pgtype.Timestamptz{Time: next.lockedUntil, Valid: !next.lockedUntil.IsZero()},
+			UnlockPending: row.UnlockPending,
+			Scope:         key.scope,
+			Subject:       key.subject,
+		}
+		if locked {
+			slog.Warn("login locked after failed logins", "scope", key.scope, "subject", key.subject, "lockouts", next.lockouts, "locked_until", next.lockedUntil)
+			if key.scope == scopeUser {
+				update.UnlockPending = true
+				data := lockEventData{UserID: key.subject, LockedUntil: &next.lockedUntil, Lockouts: next.lockouts}
+				if err := insertLockEvent(ctx, q, contract.SubjectUserEventLocked, EventTypeLocked, data, now); err != nil {
+					return err
+				}
+			}
+		}
+		if err := q.UpdateLoginThrottle(ctx, update); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// clearFailures forgets the failed logins of a user who just logged in. A lock that ended
+// before ReleaseExpiredLocks announced it is announced now.
+func (s *Store) clearFailures(ctx context.Context, userID uuid.UUID) error {
+	if s.cfg.Lockout.Threshold == 0 {
+		return nil
+	}
+	_, err := s.deleteThrottle(ctx, userID, "")
+	return err
+}
+
+// Unlock lifts the lock of a user's account and forgets its failed logins, and reports whether
+// the account was locked. Locks of the addresses the logins came from stay.
+func (s *Store) Unlock(ctx context.Context, userID uuid.UUID, unlockedBy string) (bool, error) {
+	row, err := s.deleteThrottle(ctx, userID, unlockedBy)
+	if err != nil || row == nil {
+		return false, err
+	}
+	return row.LockedUntil.Valid && s.now().Before(row.LockedUntil.Time), nil
+}
+
+// deleteThrottle deletes the failure count of a user and announces the end of its lock, if
+// not announced yet. It returns the deleted row, nil when there was none.
+func (s *Store) deleteThrottle(ctx context.Context, userID uuid.UUID, unlockedBy string) (*db.LoginThrottle, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	row, err := q.DeleteLoginThrottle(ctx, db.DeleteLoginThrottleParams{Scope: scopeUser, Subject: userID.String()})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if row.UnlockPending {
+		now := s.now()
+		data := lockEventData{UserID: row.Subject, Reason: UnlockReasonExpired}
+		if now.Before(row.LockedUntil.Time) {
+			data.Reason, data.UnlockedBy = UnlockReasonAdmin, unlockedBy
+		}
+		if err := insertLockEvent(ctx, q, contract.SubjectUserEventUnlocked, EventTypeUnlocked, data, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ReleaseExpiredLocks announces the user locks that have ended since the last call.
+func (s *Store) ReleaseExpiredLocks(ctx context.Context) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	now := s.now()
+	rows, err := q.ReleaseExpiredLoginLocks(ctx, pgtype.Timestamptz{Time: now, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		data := lockEventData{UserID: row.Subject, Reason: UnlockReasonExpired}
+		if err := insertLockEvent(ctx, q, contract.SubjectUserEventUnlocked, EventTypeUnlocked, data, now); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// lockEventData is the payload of user.event.locked and user.event.unlocked.
+type lockEventData struct {
+	UserID      string     `json:"userId"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"` // locked only
+	Lockouts    int32      `json:"lockouts,omitempty"`    // locked only: the number of locks in a row
+	Reason      string     `json:"reason,omitempty"`      // unlocked only: expired or admin
+	UnlockedBy  string     `json:"unlockedBy,omitempty"`  // unlocked by an admin only
+}
+
+// insertLockEvent writes a lock event to the outbox inside the caller's transaction; the
+// outbox relay publishes it with the user events.
+func insertLockEvent(ctx context.Context, q *db.Queries, subject, eventType string, data lockEventData, now time.Time) error {
+	eventID := uuid.New()
+	payload, err := contract.ToJSON(contract.Event[lockEventData]{
+		EventID:    eventID.String(),
+		Type:       eventType,
+		OccurredAt: now.UTC().Format(time.RFC3339),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+	return q.InsertOutboxEvent(ctx, db.InsertOutboxEventParams{
+		EventID: pgtype.UUID{Bytes: eventID, Valid: true},
+		Subject: subject,
+		Payload: payload,
+	})
+}
@@ -0,0 +1,74 @@
+package credential
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyBacksOffExponentially(t *testing.T) {
+	p := LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: 5 * time.Minute, ResetAfter: time.Hour}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var state throttle
+	var locks []time.Duration
+	for range 4 {
+		var locked bool
+		for i := range 3 {
+			state, locked = p.fail(state, p.Threshold, now)
+			if locked != (i == 2) {
+				t.Fatalf("failure %d: expected a lock only on the third failure, got locked=%v", i+1, locked)
+			}
+		}
+		locks = append(locks, state.lockedUntil.Sub(now))
+		if again, locked := p.fail(state, p.Threshold, now.Add(time.Second)); locked || again != state {
+			t.Fatalf("expected failures while locked to be ignored, got %+v", again)
+		}
+		now = state.lockedUntil
+	}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		if locks[i] != want {
+			t.Fatalf("lock %d: expected %s, got %s", i+1, want, locks[i])
+		}
+	}
+}
+
+func TestLockoutPolicyForgetsIdleFailures(t *testing.T) {
+	p := LockoutPolicy{Threshold: 2, BaseDuration: time.Minute, MaxDuration: time.Hour, ResetAfter: 10 * time.Minute}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	state, _ := p.fail(throttle{}, p.Threshold, now)
+	state, locked := p.fail(state, p.Threshold, now.Add(10*time.Minute))
+	if locked || state.failures != 1 {
+		t.Fatalf("expected an old failure to be forgotten, got %+v", state)
+	}
+
+	state, _ = p.fail(state, p.Threshold, now.Add(11*time.Minute))
+	if state.lockouts != 1 {
+		t.Fatalf("expected a lock, got %+v", state)
+	}
+	// the reset counts from the end of the lock, so the next lock is short again
+	state, _ = p.fail(state, p.Threshold, state.lockedUntil.Add(10*time.Minute))
+	state, _ = p.fail(state, p.Threshold, state.lastFailure)
+	if state.lockouts != 1 || state.lockedUntil.Sub(state.lastFailure) != time.Minute {
+		t.Fatalf("expected the backoff to start over, got %+v", state)
+	}
+}
+
+func TestSourceKey(t *testing.T) {
+	for _, tc := range []struct{ ip, want string }{
+		{"203.0.113.7", "203.0.113.7"},
+		{"::ffff:203.0.113.7", "203.0.113.7"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:ffff::1", "2001:db8:1:2::/64"},
+	} {
+		got, err := sourceKey(tc.ip)
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: expected %s, got %s (%v)", tc.ip, tc.want, got, err)
+		}
+	}
+	if _, err := sourceKey("not an address"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
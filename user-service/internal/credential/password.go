@@ -0,0 +1,201 @@
+// Package credential stores the passwords users log in with and the refresh tokens of their
+// login sessions.
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+	bcryptMaxLen  = 72 // bcrypt ignores everything after the 72nd byte
+)
+
+var (
+	ErrInvalidInput = errors.New("invalid credential input")
+	// ErrInvalidCredentials covers every reason a login is refused, so callers learn nothing
+	// about which users exist or have a password.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrInvalidToken covers unknown, expired, revoked and reused refresh tokens.
+	ErrInvalidToken = errors.New("invalid refresh token")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Argon2Params are the argon2id cost parameters; Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params is the OWASP recommendation for argon2id: 19 MiB, 2 iterations, 1 lane.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+const DefaultBcryptCost = 12
+
+// Hasher hashes new passwords with Algorithm and verifies hashes of either algorithm, so the
+// algorithm or its cost can be changed without resetting passwords.
+type Hasher struct {
+	Algorithm  string // AlgorithmArgon2id or AlgorithmBcrypt
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultHasher hashes with argon2id.
+func DefaultHasher() Hasher {
+	return Hasher{Algorithm: AlgorithmArgon2id, Argon2: DefaultArgon2Params, BcryptCost: DefaultBcryptCost}
+}
+
+func (h Hasher) validate() error {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		if h.Argon2.Memory < 8*uint32(h.Argon2.Parallelism) || h.Argon2.Iterations < 1 || h.Argon2.Parallelism < 1 {
+			return fmt.Errorf("invalid argon2id parameters %+v", h.Argon2)
+		}
+	case AlgorithmBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q (want %s or %s)", h.Algorithm, AlgorithmArgon2id, AlgorithmBcrypt)
+	}
+	return nil
+}
+
+// Hash returns the encoded hash of password: a PHC string for argon2id, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>, or a standard bcrypt hash.
+func (h Hasher) Hash(password string) (string, error) {
+	if h.Algorithm == AlgorithmBcrypt {
+		if len(password) > bcryptMaxLen {
+			return "", fmt.Errorf("%w: password must be at most %d bytes", ErrInvalidInput, bcryptMaxLen)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.Argon2
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches the encoded hash, and whether the hash should be
+// replaced because it was made with another algorithm or cost than the hasher's.
+func (h Hasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	if strings.HasPrefix(encoded, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, h.Algorithm != AlgorithmBcrypt || cost != h.BcryptCost, err
+	}
+
+	var version int
+	var p Argon2Params
+	parts := strings.Split(encoded, "$") // "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errors.New("unrecognized password hash")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, false, fmt.Errorf("argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("argon2id salt: %w", err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, false, errors.New("argon2id hash is not valid base64")
+	}
+
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false, nil
+	}
+	return true, h.Algorithm != AlgorithmArgon2id || p != h.Argon2, nil
+}
+
+// PasswordPolicy is what a new password must satisfy. Lengths count characters.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinCharClasses is how many of lower case letters, upper case letters, digits and other
+	// characters the password must mix; 0 or 1 accepts any.
+	MinCharClasses int
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: length matters, composition rules do not.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 12, MaxLength: 64}
+
+func (p PasswordPolicy) validate() error {
+	if p.MinLength < 1 || p.MaxLength < p.MinLength {
+		return fmt.Errorf("password lengths must satisfy 1 <= min (%d) <= max (%d)", p.MinLength, p.MaxLength)
+	}
+	if p.MinCharClasses < 0 || p.MinCharClasses > 4 {
+		return fmt.Errorf("password character classes must be between 0 and 4, got %d", p.MinCharClasses)
+	}
+	return nil
+}
+
+// Check returns an ErrInvalidInput naming the first rule password breaks, or nil.
+func (p PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case !utf8.ValidString(password):
+		return fmt.Errorf("%w: password must be valid UTF-8", ErrInvalidInput)
+	case length < p.MinLength:
+		return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidInput, p.MinLength)
+	case length > p.MaxLength:
+		return fmt.Errorf("%w: password must be at most %d characters", ErrInvalidInput, p.MaxLength)
+	case strings.TrimSpace(password) == "":
+		return fmt.Errorf("%w: password must not be blank", ErrInvalidInput)
+	case charClasses(password) < p.MinCharClasses:
+		return fmt.Errorf("%w: password must mix at least %d of lower case, upper case, digits and symbols", ErrInvalidInput, p.MinCharClasses)
+	}
+	return nil
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
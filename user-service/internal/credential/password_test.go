@@ -0,0 +1,102 @@
+package credential
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps the tests fast; production uses DefaultArgon2Params.
+var testArgon2 = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestHasherVerifiesItsOwnHashes(t *testing.T) {
+	for _, h := range []Hasher{
+		{Algorithm: AlgorithmArgon2id, Argon2: testArgon2},
+		{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost},
+	} {
+		encoded, err := h.Hash("correct horse battery staple")
+		if err != nil {
+			t.Fatalf("%s: hash: %v", h.Algorithm, err)
+		}
+		if ok, rehash, err := h.Verify(encoded, "correct horse battery staple"); err != nil || !ok || rehash {
+			t.Fatalf("%s: expected a match without rehash, got ok=%v rehash=%v err=%v", h.Algorithm, ok, rehash, err)
+		}
+		if ok, _, err := h.Verify(encoded, "correct horse battery stapler"); err != nil || ok {
+			t.Fatalf("%s: expected a mismatch, got ok=%v err=%v", h.Algorithm, ok, err)
+		}
+	}
+}
+
+func TestHasherAsksToRehashOtherAlgorithmsAndCosts(t *testing.T) {
+	argon := Hasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}
+	bcryptHasher := Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+
+	fromBcrypt, err := bcryptHasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if ok, rehash, err := argon.Verify(fromBcrypt, "correct horse battery staple"); err != nil || !ok || !rehash {
+		t.Fatalf("expected the bcrypt hash to verify and need a rehash, got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	stronger := argon
+	stronger.Argon2.Iterations = 2
+	fromArgon, err := argon.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if !strings.HasPrefix(fromArgon, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("expected a PHC string, got %s", fromArgon)
+	}
+	if ok, rehash, err := stronger.Verify(fromArgon, "correct horse battery staple"); err != nil || !ok || !rehash {
+		t.Fatalf("expected a rehash after raising the cost, got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	if _, _, err := argon.Verify("plaintext", "plaintext"); err == nil {
+		t.Fatal("expected an error for an unrecognized hash")
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MaxLength: 20, MinCharClasses: 3}
+	for password, valid := range map[string]bool{
+		"Sh0rt!":                 false,
+		"alllowercaseletters":    false,
+		"Mixed case and 1 digit": false, // too long
+		"Mixed case 1 digit":     true,
+		"            ":           false,
+		"Ünïcödé 1234":           true,
+	} {
+		err := policy.Check(password)
+		if valid && err != nil {
+			t.Fatalf("%q: expected valid, got %v", password, err)
+		}
+		if !valid && !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%q: expected ErrInvalidInput, got %v", password, err)
+		}
+	}
+}
+
+func TestRefreshTokenParsesBack(t *testing.T) {
+	id := uuid.New()
+	token, hash, err := newRefreshToken(id)
+	if err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+	gotID, secret, err := parseRefreshToken(token)
+	if err != nil {
+		t.Fatalf("parse %s: %v", token, err)
+	}
+	if gotID != id || string(hashSecret(secret)) != string(hash) {
+		t.Fatalf("expected id %s and the issued secret back, got %s", id, gotID)
+	}
+
+	for _, malformed := range []string{"", "uk_" + token[3:], "rt_0123456789abcdef_secret", "rt_0123456789abcdef0123456789abcdef_"} {
+		if _, _, err := parseRefreshToken(malformed); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%q: expected ErrInvalidToken, got %v", malformed, err)
+		}
+	}
+}
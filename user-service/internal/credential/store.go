@@ -0,0 +1,386 @@
+package credential
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	db "user-service/internal/db/sqlc"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// a refresh token reads rt_<token id as 32 hex digits>_<secret>, like an API key: the id
+	// finds the row and only a SHA-256 of the random secret is stored.
+	refreshTokenPrefix = "rt_"
+	secretBytes        = 32
+
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// Config tunes how passwords are hashed and checked, how long login sessions last and when
+// failed logins lock an account.
+type Config struct {
+	Hasher     Hasher
+	Policy     PasswordPolicy
+	RefreshTTL time.Duration // how long a refresh token can be used; each refresh starts anew
+	Lockout    LockoutPolicy
+}
+
+// DefaultConfig hashes with argon2id, applies DefaultPasswordPolicy and DefaultLockoutPolicy and
+// keeps sessions for 30 days.
+func DefaultConfig() Config {
+	return Config{Hasher: DefaultHasher(), Policy: DefaultPasswordPolicy, RefreshTTL: DefaultRefreshTTL, Lockout: DefaultLockoutPolicy}
+}
+
+// Credential is a user's password entry, without the hash.
+type Credential struct {
+	UserID    uuid.UUID
+	Roles     []string
+	UpdatedAt time.Time
+}
+
+// Session is a successful login or refresh: who logged in, with which roles, and the refresh
+// token that continues the session. The token is not stored and cannot be shown again.
+type Session struct {
+	UserID           uuid.UUID
+	Roles            []string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+type Store struct {
+	pool    *pgxpool.Pool
+	queries *db.Queries
+	cfg     Config
+	now     func() time.Time
+}
+
+func NewStore(pool *pgxpool.Pool, cfg Config) (*Store, error) {
+	if err := cfg.Hasher.validate(); err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+	if err := cfg.Policy.validate(); err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+	if cfg.RefreshTTL <= 0 {
+		return nil, errors.New("credential: the refresh token lifetime must be positive")
+	}
+	if err := cfg.Lockout.validate(); err != nil {
+		return nil, fmt.Errorf("credential: %w", err)
+	}
+	return &Store{pool: pool, queries: db.New(pool), cfg: cfg, now: time.Now}, nil
+}
+
+// SetPassword sets the user's password after checking it against the policy, and replaces the
+// user's roles when roles is not nil. Every session of the user is revoked, so a changed
+// password logs out whoever knew the old one.
+func (s *Store) SetPassword(ctx context.Context, userID uuid.UUID, password string, roles []string) (*Credential, error) {
+	if err := s.cfg.Policy.Check(password); err != nil {
+		return nil, err
+	}
+	if roles != nil && len(roles) == 0 {
+		return nil, fmt.Errorf("%w: roles must not be empty", ErrInvalidInput)
+	}
+	hash, err := s.cfg.Hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	id := pgtype.UUID{Bytes: userID, Valid: true}
+	row, err := q.UpsertCredential(ctx, db.UpsertCredentialParams{UserID: id, PasswordHash: hash, Roles: roles})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation: the user is gone
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if _, err := q.RevokeUserRefreshTokens(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &Credential{UserID: userID, Roles: row.Roles, UpdatedAt: row.UpdatedAt.Time}, nil
+}
+
+// Roles returns the user's roles, nil when the user has no password yet. Unlike a login it
+// ignores the user's status.
+func (s *Store) Roles(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	roles, err := s.queries.GetCredentialRoles(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return roles, err
+}
+
+// CheckPassword returns ErrInvalidCredentials unless password is the active user's password.
+func (s *Store) CheckPassword(ctx context.Context, userID uuid.UUID, password string) (*Credential, error) {
+	row, err := s.queries.GetActiveCredential(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			s.burnHash(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	ok, rehash, err := s.cfg.Hasher.Verify(row.PasswordHash, password)
+	if err != nil {
+		return nil, fmt.Errorf("verify password of %s: %w", userID, err)
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if rehash {
+		s.upgradeHash(ctx, row.UserID, password)
+	}
+	return &Credential{UserID: userID, Roles: row.Roles, UpdatedAt: row.UpdatedAt.Time}, nil
+}
+
+// Authenticate checks the password of a login and starts a session. Locked accounts and
+// addresses get a LockedError without a password check; a wrong password counts towards
+// locking both. Unknown emails are hashed and locked like real users, so neither the time of
+// the reply nor a lock tells whether someone has the email.
+func (s *Store) Authenticate(ctx context.Context, attempt LoginAttempt) (*Session, error) {
+	keys, err := s.throttleKeys(attempt)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLocked(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	var credential *Credential
+	if attempt.UserID == uuid.Nil {
+		s.burnHash(attempt.Password)
+		err = ErrInvalidCredentials
+	} else {
+		credential, err = s.CheckPassword(ctx, attempt.UserID, attempt.Password)
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := s.recordFailure(ctx, keys); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.clearFailures(ctx, attempt.UserID); err != nil {
+		return nil, err
+	}
+
+	familyID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	token, expiresAt, err := s.insertRefreshToken(ctx, s.queries, familyID, attempt.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{UserID: attempt.UserID, Roles: credential.Roles, RefreshToken: token, RefreshExpiresAt: expiresAt}, nil
+}
+
+// Refresh exchanges a refresh token for a new one of the same session, with the user's current
+// roles. Each token works once: presenting a used token again revokes the whole session.
+func (s *Store) Refresh(ctx context.Context, token string) (*Session, error) {
+	tokenID, secret, err := parseRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	row, err := q.LockRefreshToken(ctx, pgtype.UUID{Bytes: tokenID, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(row.SecretHash, hashSecret(secret)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if row.RevokedAt.Valid || !s.now().Before(row.ExpiresAt.Time) {
+		return nil, ErrInvalidToken
+	}
+
+	// a used token, or one whose user may no longer log in, ends the session
+	endSession := row.UsedAt.Valid
+	var credential db.UserCredential
+	if !endSession {
+		credential, err = q.GetActiveCredential(ctx, row.UserID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		endSession = err != nil
+	}
+	if endSession {
+		if row.UsedAt.Valid {
+			slog.Warn("refresh token reused, revoking its session", "token_id", tokenID, "user_id", uuid.UUID(row.UserID.Bytes))
+		}
+		if _, err := q.RevokeRefreshTokenFamily(ctx, row.FamilyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if err := q.MarkRefreshTokenUsed(ctx, row.TokenID); err != nil {
+		return nil, err
+	}
+	userID := uuid.UUID(row.UserID.Bytes)
+	next, expiresAt, err := s.insertRefreshToken(ctx, q, uuid.UUID(row.FamilyID.Bytes), userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &Session{UserID: userID, Roles: credential.Roles, RefreshToken: next, RefreshExpiresAt: expiresAt}, nil
+}
+
+// Revoke ends the session a refresh token belongs to. The token stays locked until the family
+// is revoked, so a concurrent Refresh with it either finishes first and has its new token
+// revoked too, or waits and finds the token revoked.
+func (s *Store) Revoke(ctx context.Context, token string) error {
+	tokenID, secret, err := parseRefreshToken(token)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+	q := s.queries.WithTx(tx)
+
+	row, err := q.LockRefreshToken(ctx, pgtype.UUID{Bytes: tokenID, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	if subtle.ConstantTimeCompare(row.SecretHash, hashSecret(secret)) != 1 {
+		return ErrInvalidToken
+	}
+	if _, err := q.RevokeRefreshTokenFamily(ctx, row.FamilyID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Prune deletes expired refresh tokens and the failed logins that are forgotten.
+func (s *Store) Prune(ctx context.Context) (int64, error) {
+	tokens, err := s.queries.DeleteExpiredRefreshTokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+	idleBefore := pgtype.Timestamptz{Time: s.now().Add(-s.cfg.Lockout.ResetAfter), Valid: true}
+	throttles, err := s.queries.DeleteIdleLoginThrottles(ctx, idleBefore)
+	if err != nil {
+		return tokens, err
+	}
+	return tokens + throttles, nil
+}
+
+func (s *Store) insertRefreshToken(ctx context.Context, q *db.Queries, familyID, userID uuid.UUID) (string, time.Time, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	token, hash, err := newRefreshToken(tokenID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	row, err := q.InsertRefreshToken(ctx, db.InsertRefreshTokenParams{
+		TokenID:    pgtype.UUID{Bytes: tokenID, Valid: true},
+		FamilyID:   pgtype.UUID{Bytes: familyID, Valid: true},
+		UserID:     pgtype.UUID{Bytes: userID, Valid: true},
+		SecretHash: hash,
+		ExpiresAt:  pgtype.Timestamptz{Time: s.now().Add(s.cfg.RefreshTTL), Valid: true},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, row.ExpiresAt.Time, nil
+}
+
+// upgradeHash re-hashes a verified password with the current algorithm and cost. A failure
+// only means the old hash stays, so it is logged rather than failing the login.
+func (s *Store) upgradeHash(ctx context.Context, userID pgtype.UUID, password string) {
+	hash, err := s.cfg.Hasher.Hash(password)
+	if err == nil {
+		err = s.queries.UpdatePasswordHash(ctx, db.UpdatePasswordHashParams{PasswordHash: hash, UserID: userID})
+	}
+	if err != nil {
+		slog.Warn("failed to upgrade password hash", "user_id", uuid.UUID(userID.Bytes), "error", err)
+	}
+}
+
+// burnHash spends the time of a password check without a stored hash.
+func (s *Store) burnHash(password string) {
+	_, _ = s.cfg.Hasher.Hash(password)
+}
+
+// newRefreshToken returns the full token for id and the hash of its secret.
+func newRefreshToken(id uuid.UUID) (string, []byte, error) {
+	raw := make([]byte, secretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	secret := hex.EncodeToString(raw)
+	return refreshTokenPrefix + hex.EncodeToString(id[:]) + "_" + secret, hashSecret(secret), nil
+}
+
+// parseRefreshToken splits a presented token into its id and secret.
+func parseRefreshToken(token string) (uuid.UUID, string, error) {
+	rest, ok := strings.CutPrefix(token, refreshTokenPrefix)
+	if !ok {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	rawID, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(rawID) != 32 || secret == "" {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	return id, secret, nil
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
@@ -8,14 +8,93 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type User struct {
+type ApiKey struct {
+	KeyID       pgtype.UUID        `json:"key_id"`
+	Name        string             `json:"name"`
+	SecretHash  []byte             `json:"secret_hash"`
+	Scopes      []string           `json:"scopes"`
+	CreatedBy   string             `json:"created_by"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt   pgtype.Timestamptz `json:"revoked_at"`
+	LastUsedAt  pgtype.Timestamptz `json:"last_used_at"`
+	RotatedFrom pgtype.UUID        `json:"rotated_from"`
+}
+
+type IdempotencyKey struct {
+	Key         string             `json:"key"`
+	Subject     string             `json:"subject"`
+	RequestHash string             `json:"request_hash"`
+	Response    []byte             `json:"response"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+type LoginThrottle struct {
+	Scope         string             `json:"scope"`
+	Subject       string             `json:"subject"`
+	UserID        pgtype.UUID        `json:"user_id"`
+	Failures      int32              `json:"failures"`
+	Lockouts      int32              `json:"lockouts"`
+	LastFailureAt pgtype.Timestamptz `json:"last_failure_at"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+	UnlockPending bool               `json:"unlock_pending"`
+}
+
+type Outbox struct {
+	ID            int64              `json:"id"`
+	EventID       pgtype.UUID        `json:"event_id"`
+	Subject       string             `json:"subject"`
+	Payload       []byte             `json:"payload"`
+	Attempts      int32              `json:"attempts"`
+	LastError     pgtype.Text        `json:"last_error"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	SentAt        pgtype.Timestamptz `json:"sent_at"`
+}
+
+type RefreshToken struct {
+	TokenID    pgtype.UUID        `json:"token_id"`
+	FamilyID   pgtype.UUID        `json:"family_id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	SecretHash []byte             `json:"secret_hash"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	UsedAt     pgtype.Timestamptz `json:"used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type UserAudit struct {
+	ID        int64              `json:"id"`
 	UserID    pgtype.UUID        `json:"user_id"`
-	FirstName string             `json:"first_name"`
-	LastName  string             `json:"last_name"`
-	Email     string             `json:"email"`
-	Phone     pgtype.Text        `json:"phone"`
-	Age       pgtype.Int4        `json:"age"`
-	Status    string             `json:"status"`
+	Action    string             `json:"action"`
+	ActorID   string             `json:"actor_id"`
+	Source    string             `json:"source"`
+	RequestID string             `json:"request_id"`
+	Changes   []byte             `json:"changes"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type UserCredential struct {
+	UserID       pgtype.UUID        `json:"user_id"`
+	PasswordHash string             `json:"password_hash"`
+	Roles        []string           `json:"roles"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+}
+
+type User struct {
+	UserID          pgtype.UUID        `json:"user_id"`
+	FirstName       string             `json:"first_name"`
+	LastName        string             `json:"last_name"`
+	Email           string             `json:"email"`
+	Phone           pgtype.Text        `json:"phone"`
+	Age             pgtype.Int4        `json:"age"`
+	Status          string             `json:"status"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt       pgtype.Timestamptz `json:"deleted_at"`
+	Version         int32              `json:"version"`
+	EmailNormalized string             `json:"email_normalized"`
+	PhoneRaw        pgtype.Text        `json:"phone_raw"`
 }
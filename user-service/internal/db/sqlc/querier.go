@@ -11,11 +11,66 @@ import (
 )
 
 type Querier interface {
+	// inserts one user per array element in a single statement; an empty phone and a zero age are stored as NULL.
+	BulkCreateUsers(ctx context.Context, arg BulkCreateUsersParams) ([]User, error)
+	// claims the key for a new request; an expired key, or one whose request died without
+	// storing a response, is taken over. Zero rows means someone else holds the key.
+	ClaimIdempotencyKey(ctx context.Context, arg ClaimIdempotencyKeyParams) (int64, error)
+	ClaimPendingOutboxEvents(ctx context.Context, batchSize int32) ([]ClaimPendingOutboxEventsRow, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeleteUser(ctx context.Context, userID pgtype.UUID) (int64, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	DeleteExpiredRefreshTokens(ctx context.Context) (int64, error)
+	DeleteIdleLoginThrottles(ctx context.Context, idleBefore pgtype.Timestamptz) (int64, error)
+	// forgets the failures of a successful login or an unlock.
+	DeleteLoginThrottle(ctx context.Context, arg DeleteLoginThrottleParams) (LoginThrottle, error)
+	DeleteSentOutboxEvents(ctx context.Context, sentBefore pgtype.Timestamptz) (int64, error)
+	DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error)
+	// creates the row a failed login is counted in, so it can be locked.
+	EnsureLoginThrottle(ctx context.Context, arg EnsureLoginThrottleParams) error
+	// brings the expiry forward to expires_at; a key already expiring sooner keeps its expiry.
+	ExpireAPIKey(ctx context.Context, arg ExpireAPIKeyParams) error
+	GetAPIKey(ctx context.Context, keyID pgtype.UUID) (ApiKey, error)
+	// reads the credential of a user that may log in: not deleted and Active.
+	GetActiveCredential(ctx context.Context, userID pgtype.UUID) (UserCredential, error)
+	// reads the user's roles whatever the user's status, e.g. to check who may reset the password.
+	GetCredentialRoles(ctx context.Context, userID pgtype.UUID) ([]string, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (GetIdempotencyKeyRow, error)
+	GetLoginThrottle(ctx context.Context, arg GetLoginThrottleParams) (LoginThrottle, error)
+	GetUserByEmail(ctx context.Context, emailNormalized string) (User, error)
 	GetUserByID(ctx context.Context, userID pgtype.UUID) (User, error)
-	ListUsers(ctx context.Context) ([]User, error)
+	InsertAPIKey(ctx context.Context, arg InsertAPIKeyParams) (ApiKey, error)
+	InsertOutboxEvent(ctx context.Context, arg InsertOutboxEventParams) error
+	InsertRefreshToken(ctx context.Context, arg InsertRefreshTokenParams) (RefreshToken, error)
+	InsertUserAudit(ctx context.Context, arg InsertUserAuditParams) error
+	ListAPIKeys(ctx context.Context) ([]ApiKey, error)
+	ListLiveNormalizedEmails(ctx context.Context, emailsNormalized []string) ([]string, error)
+	// newest first; before_id continues after the last entry of the previous page.
+	ListUserAudit(ctx context.Context, arg ListUserAuditParams) ([]UserAudit, error)
+	LockAPIKey(ctx context.Context, keyID pgtype.UUID) (ApiKey, error)
+	LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) (LoginThrottle, error)
+	LockRefreshToken(ctx context.Context, tokenID pgtype.UUID) (RefreshToken, error)
+	// reads the user, deleted or not, and locks the row until the transaction ends.
+	LockUser(ctx context.Context, userID pgtype.UUID) (User, error)
+	MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) error
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	MarkRefreshTokenUsed(ctx context.Context, tokenID pgtype.UUID) error
+	PurgeDeletedUsers(ctx context.Context, deletedBefore pgtype.Timestamptz) (int64, error)
+	// claims the user locks that have ended, so each end is announced once.
+	ReleaseExpiredLoginLocks(ctx context.Context, now pgtype.Timestamptz) ([]LoginThrottle, error)
+	ReleaseIdempotencyKey(ctx context.Context, arg ReleaseIdempotencyKeyParams) error
+	RestoreUser(ctx context.Context, userID pgtype.UUID) (User, error)
+	RevokeAPIKey(ctx context.Context, keyID pgtype.UUID) (ApiKey, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID pgtype.UUID) (int64, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID pgtype.UUID) (int64, error)
+	SaveIdempotencyResponse(ctx context.Context, arg SaveIdempotencyResponseParams) error
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
+	// records a use of the keys; reports arriving out of order never move last_used_at back.
+	TouchAPIKeys(ctx context.Context, arg TouchAPIKeysParams) (int64, error)
+	UpdateLoginThrottle(ctx context.Context, arg UpdateLoginThrottleParams) error
+	UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	// sets the user's password; roles are kept when not given, and default to {user} for a new credential.
+	UpsertCredential(ctx context.Context, arg UpsertCredentialParams) (UserCredential, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,6 +11,86 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const bulkCreateUsers = `-- name: BulkCreateUsers :many
+INSERT INTO users (
+    first_name,
+    last_name,
+    email,
+    phone,
+    age,
+    status,
+    email_normalized,
+    phone_raw
+)
+SELECT first_name, last_name, email, NULLIF(phone, ''), NULLIF(age, 0), status, email_normalized, NULLIF(phone_raw, '')
+FROM unnest(
+    $1::text[],
+    $2::text[],
+    $3::text[],
+    $4::text[],
+    $5::int[],
+    $6::text[],
+    $7::text[],
+    $8::text[]
+) AS input(first_name, last_name, email, phone, age, status, email_normalized, phone_raw)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+`
+
+type BulkCreateUsersParams struct {
+	FirstNames       []string `json:"first_names"`
+	LastNames        []string `json:"last_names"`
+	Emails           []string `json:"emails"`
+	Phones           []string `json:"phones"`
+	Ages             []int32  `json:"ages"`
+	Statuses         []string `json:"statuses"`
+	EmailsNormalized []string `json:"emails_normalized"`
+	PhoneRaws        []string `json:"phone_raws"`
+}
+
+// inserts one user per array element in a single statement; an empty phone and a zero age are stored as NULL.
+func (q *Queries) BulkCreateUsers(ctx context.Context, arg BulkCreateUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, bulkCreateUsers,
+		arg.FirstNames,
+		arg.LastNames,
+		arg.Emails,
+		arg.Phones,
+		arg.Ages,
+		arg.Statuses,
+		arg.EmailsNormalized,
+		arg.PhoneRaws,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.Age,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Version,
+			&i.EmailNormalized,
+			&i.PhoneRaw,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     first_name,
@@ -18,25 +98,31 @@ INSERT INTO users (
     email,
     phone,
     age,
-    status
+    status,
+    email_normalized,
+    phone_raw
 ) VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7,
+    $8
 )
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
 `
 
 type CreateUserParams struct {
-	FirstName string      `json:"first_name"`
-	LastName  string      `json:"last_name"`
-	Email     string      `json:"email"`
-	Phone     pgtype.Text `json:"phone"`
-	Age       pgtype.Int4 `json:"age"`
-	Status    string      `json:"status"`
+	FirstName       string      `json:"first_name"`
+	LastName        string      `json:"last_name"`
+	Email           string      `json:"email"`
+	Phone           pgtype.Text `json:"phone"`
+	Age             pgtype.Int4 `json:"age"`
+	Status          string      `json:"status"`
+	EmailNormalized string      `json:"email_normalized"`
+	PhoneRaw        pgtype.Text `json:"phone_raw"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -47,6 +133,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.Phone,
 		arg.Age,
 		arg.Status,
+		arg.EmailNormalized,
+		arg.PhoneRaw,
 	)
 	var i User
 	err := row.Scan(
@@ -59,31 +147,185 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :execrows
-DELETE FROM users
+const deleteUser = `-- name: DeleteUser :one
+UPDATE users
+SET
+    deleted_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NULL
+    AND ($2::int IS NULL OR version = $2::int)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+`
+
+type DeleteUserParams struct {
+	UserID          pgtype.UUID `json:"user_id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
+}
+
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, deleteUser, arg.UserID, arg.ExpectedVersion)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+FROM users
+WHERE email_normalized = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, emailNormalized string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, emailNormalized)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+FROM users
+WHERE user_id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, userID pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, userID)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
+	)
+	return i, err
+}
+
+const listLiveNormalizedEmails = `-- name: ListLiveNormalizedEmails :many
+SELECT email_normalized
+FROM users
+WHERE email_normalized = ANY($1::text[]) AND deleted_at IS NULL
+`
+
+func (q *Queries) ListLiveNormalizedEmails(ctx context.Context, emailsNormalized []string) ([]string, error) {
+	rows, err := q.db.Query(ctx, listLiveNormalizedEmails, emailsNormalized)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var email_normalized string
+		if err := rows.Scan(&email_normalized); err != nil {
+			return nil, err
+		}
+		items = append(items, email_normalized)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUser = `-- name: LockUser :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+FROM users
 WHERE user_id = $1
+FOR UPDATE
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, userID pgtype.UUID) (int64, error) {
-	result, err := q.db.Exec(ctx, deleteUser, userID)
+// reads the user, deleted or not, and locks the row until the transaction ends.
+func (q *Queries) LockUser(ctx context.Context, userID pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, lockUser, userID)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedUsers, deletedBefore)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected(), nil
 }
 
-const getUserByID = `-- name: GetUserByID :one
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
-FROM users
-WHERE user_id = $1
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET
+    deleted_at = NULL,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
 `
 
-func (q *Queries) GetUserByID(ctx context.Context, userID pgtype.UUID) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByID, userID)
+func (q *Queries) RestoreUser(ctx context.Context, userID pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, restoreUser, userID)
 	var i User
 	err := row.Scan(
 		&i.UserID,
@@ -95,25 +337,76 @@ func (q *Queries) GetUserByID(ctx context.Context, userID pgtype.UUID) (User, er
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
 	)
 	return i, err
 }
 
-const listUsers = `-- name: ListUsers :many
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+const searchUsers = `-- name: SearchUsers :many
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, phone_raw,
+    GREATEST(
+        similarity(first_name || ' ' || last_name, $1::text),
+        word_similarity($1::text, first_name || ' ' || last_name),
+        word_similarity($1::text, email),
+        CASE WHEN $2::text = '' THEN 0
+            ELSE word_similarity($2::text, regexp_replace(COALESCE(phone, ''), '[^0-9]', '', 'g'))
+        END
+    )::real AS score
 FROM users
-ORDER BY created_at DESC
+WHERE deleted_at IS NULL
+    AND (
+        (first_name || ' ' || last_name) % $1::text
+        OR $1::text <% (first_name || ' ' || last_name)
+        OR email ILIKE $3::text
+        OR $1::text <% email
+        OR ($2::text <> '' AND regexp_replace(phone, '[^0-9]', '', 'g') LIKE $4::text)
+        OR ($2::text <> '' AND $2::text <% regexp_replace(phone, '[^0-9]', '', 'g'))
+    )
+ORDER BY score DESC, user_id
+LIMIT $5
 `
 
-func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
-	rows, err := q.db.Query(ctx, listUsers)
+type SearchUsersParams struct {
+	Term         string `json:"term"`
+	Digits       string `json:"digits"`
+	EmailPattern string `json:"email_pattern"`
+	PhonePattern string `json:"phone_pattern"`
+	ResultLimit  int32  `json:"result_limit"`
+}
+
+type SearchUsersRow struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	FirstName string             `json:"first_name"`
+	LastName  string             `json:"last_name"`
+	Email     string             `json:"email"`
+	Phone     pgtype.Text        `json:"phone"`
+	Age       pgtype.Int4        `json:"age"`
+	Status    string             `json:"status"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+	Version   int32              `json:"version"`
+	PhoneRaw  pgtype.Text        `json:"phone_raw"`
+	Score     float32            `json:"score"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchUsers,
+		arg.Term,
+		arg.Digits,
+		arg.EmailPattern,
+		arg.PhonePattern,
+		arg.ResultLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []SearchUsersRow
 	for rows.Next() {
-		var i User
+		var i SearchUsersRow
 		if err := rows.Scan(
 			&i.UserID,
 			&i.FirstName,
@@ -124,6 +417,9 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Version,
+			&i.PhoneRaw,
+			&i.Score,
 		); err != nil {
 			return nil, err
 		}
@@ -141,22 +437,29 @@ SET
     first_name = COALESCE($1, first_name),
     last_name = COALESCE($2, last_name),
     email = COALESCE($3, email),
-    phone = COALESCE($4, phone),
-    age = COALESCE($5, age),
-    status = COALESCE($6, status),
-    updated_at = NOW()
-WHERE user_id = $7
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+    email_normalized = COALESCE($4, email_normalized),
+    phone = COALESCE($5, phone),
+    phone_raw = COALESCE($6, phone_raw),
+    age = COALESCE($7, age),
+    status = COALESCE($8, status),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $9 AND deleted_at IS NULL
+    AND ($10::int IS NULL OR version = $10::int)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
 `
 
 type UpdateUserParams struct {
-	FirstName pgtype.Text `json:"first_name"`
-	LastName  pgtype.Text `json:"last_name"`
-	Email     pgtype.Text `json:"email"`
-	Phone     pgtype.Text `json:"phone"`
-	Age       pgtype.Int4 `json:"age"`
-	Status    pgtype.Text `json:"status"`
-	UserID    pgtype.UUID `json:"user_id"`
+	FirstName       pgtype.Text `json:"first_name"`
+	LastName        pgtype.Text `json:"last_name"`
+	Email           pgtype.Text `json:"email"`
+	EmailNormalized pgtype.Text `json:"email_normalized"`
+	Phone           pgtype.Text `json:"phone"`
+	PhoneRaw        pgtype.Text `json:"phone_raw"`
+	Age             pgtype.Int4 `json:"age"`
+	Status          pgtype.Text `json:"status"`
+	UserID          pgtype.UUID `json:"user_id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
@@ -164,10 +467,13 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		arg.FirstName,
 		arg.LastName,
 		arg.Email,
+		arg.EmailNormalized,
 		arg.Phone,
+		arg.PhoneRaw,
 		arg.Age,
 		arg.Status,
 		arg.UserID,
+		arg.ExpectedVersion,
 	)
 	var i User
 	err := row.Scan(
@@ -180,6 +486,10 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Version,
+		&i.EmailNormalized,
+		&i.PhoneRaw,
 	)
 	return i, err
 }
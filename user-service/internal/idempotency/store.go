@@ -0,0 +1,103 @@
+// Package idempotency remembers the responses of mutating commands by idempotency key,
+// so a command retried after a timeout is answered from the store instead of re-executed.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	db "user-service/internal/db/sqlc"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	DefaultTTL = 24 * time.Hour
+	MaxKeyLen  = 255
+
+	// a claim without a response older than this belongs to a request that died mid-way.
+	staleClaimAfter = time.Minute
+)
+
+var (
+	ErrKeyReused  = errors.New("idempotency key was already used for a different request")
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+type Store struct {
+	queries *db.Queries
+	ttl     time.Duration
+}
+
+func NewStore(pool *pgxpool.Pool, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{queries: db.New(pool), ttl: ttl}
+}
+
+// Begin claims key for a command on subject. When it returns claimed, the caller must run
+// the command and then call Complete or Release. Otherwise it returns the stored response
+// of the earlier request, ErrKeyReused if that request had a different payload, or
+// ErrInProgress if it has not finished yet.
+func (s *Store) Begin(ctx context.Context, subject, key, requestHash string) (response []byte, claimed bool, err error) {
+	now := time.Now()
+	affected, err := s.queries.ClaimIdempotencyKey(ctx, db.ClaimIdempotencyKeyParams{
+		Key:         key,
+		Subject:     subject,
+		RequestHash: requestHash,
+		ExpiresAt:   pgtype.Timestamptz{Time: now.Add(s.ttl), Valid: true},
+		StaleBefore: pgtype.Timestamptz{Time: now.Add(-staleClaimAfter), Valid: true},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if affected == 1 {
+		return nil, true, nil
+	}
+
+	row, err := s.queries.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{Key: key, Subject: subject})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) { // released between the claim and the lookup
+			return nil, false, ErrInProgress
+		}
+		return nil, false, err
+	}
+	if row.RequestHash != requestHash {
+		return nil, false, ErrKeyReused
+	}
+	if row.Response == nil {
+		return nil, false, ErrInProgress
+	}
+	return row.Response, false, nil
+}
+
+// Complete stores the response for a claimed key.
+func (s *Store) Complete(ctx context.Context, subject, key string, response []byte) error {
+	return s.queries.SaveIdempotencyResponse(ctx, db.SaveIdempotencyResponseParams{
+		Key:      key,
+		Subject:  subject,
+		Response: response,
+	})
+}
+
+// Release drops a claim without a response, so the command can be retried with the same key.
+func (s *Store) Release(ctx context.Context, subject, key string) error {
+	return s.queries.ReleaseIdempotencyKey(ctx, db.ReleaseIdempotencyKeyParams{Key: key, Subject: subject})
+}
+
+// Prune deletes expired keys.
+func (s *Store) Prune(ctx context.Context) (int64, error) {
+	return s.queries.DeleteExpiredIdempotencyKeys(ctx)
+}
+
+// HashRequest fingerprints a command payload so a key reused for a different request is detected.
+func HashRequest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,370 @@
+// Package migrate applies the versioned SQL migrations and records them in schema_migrations.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey is the pg_advisory_lock key that serialises migration runs across replicas.
+const lockKey int64 = 0x75736572_6d696772 // "usermigr"
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration differs from the embedded file")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up; detects an applied migration being edited afterwards
+}
+
+// Status describes one migration as seen by the database.
+type Status struct {
+	Migration
+	AppliedAt *time.Time // nil while pending
+	Drifted   bool       // applied with a different checksum
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration // sorted by version
+}
+
+func New(pool *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// Load reads the migration pairs from the root of fsys. Every version needs an up file;
+// the down file is optional, but a migration without one cannot be rolled back.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d: up and down files have different names", version)
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Latest is the highest embedded version, or 0 when there are none.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive")
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var target int64
+		versions := sortedVersions(applied)
+		if steps < len(versions) {
+			target = versions[len(versions)-steps-1]
+		}
+		done, err = m.migrateTo(ctx, conn, applied, target)
+		return err
+	})
+	return done, err
+}
+
+// To migrates up or down until target is the newest applied version; 0 rolls everything back.
+// It returns the migrations it applied or rolled back, in execution order.
+func (m *Migrator) To(ctx context.Context, target int64) ([]Migration, error) {
+	if target != 0 && m.find(target) == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+		done, err = m.migrateTo(ctx, conn, applied, target)
+		return err
+	})
+	return done, err
+}
+
+// migrateTo does the work of To; the caller holds the lock.
+func (m *Migrator) migrateTo(ctx context.Context, conn *pgxpool.Conn, applied map[int64]appliedRow, target int64) ([]Migration, error) {
+	var done []Migration
+
+	// up: pending migrations at or below target, oldest first
+	for _, migration := range m.migrations {
+		if migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := apply(ctx, conn, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	// down: applied migrations above target, newest first
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= target {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := revert(ctx, conn, migration); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Status lists every embedded migration with its applied time, plus drift. It does not
+// take the lock, so it can be used while another replica is migrating.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.appliedAt
+			status.AppliedAt = &appliedAt
+			status.Drifted = row.checksum != migration.Checksum
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+type appliedRow struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock,
+// after making sure the tracking table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// the lock belongs to the session, so release it even if ctx was cancelled
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *pgxpool.Conn) error {
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// verify loads the applied versions and fails if any of them is unknown to this binary
+// or was applied from different SQL than what is embedded now.
+func (m *Migrator) verify(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedRow, error) {
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for version, row := range applied {
+		migration := m.find(version)
+		if migration == nil {
+			return nil, fmt.Errorf("%w: database has version %d, which this binary does not know", ErrUnknownVersion, version)
+		}
+		if row.checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+func loadApplied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedRow, error) {
+	rows, err := conn.Query(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]appliedRow{}
+	for rows.Next() {
+		var version int64
+		var row appliedRow
+		if err := rows.Scan(&version, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		out[version] = row
+	}
+	return out, rows.Err()
+}
+
+// apply runs the up SQL and records the version in one transaction.
+func apply(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.Up); err != nil {
+			return fmt.Errorf("apply %d_%s: %w%s", migration.Version, migration.Name, err, pgDetail(err))
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+			migration.Version, migration.Name, migration.Checksum)
+		return err
+	})
+}
+
+// revert runs the down SQL and removes the version in one transaction.
+func revert(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.Down); err != nil {
+			return fmt.Errorf("revert %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		return err
+	})
+}
+
+// pgDetail returns the DETAIL and HINT of a Postgres error, which its Error() leaves out;
+// migrations that refuse to run use them to say why and what to do.
+func pgDetail(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	var out strings.Builder
+	if pgErr.Detail != "" {
+		out.WriteString("\n" + pgErr.Detail)
+	}
+	if pgErr.Hint != "" {
+		out.WriteString("\nhint: " + pgErr.Hint)
+	}
+	return out.String()
+}
+
+func sortedVersions(applied map[int64]appliedRow) []int64 {
+	out := make([]int64, 0, len(applied))
+	for version := range applied {
+		out = append(out, version)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
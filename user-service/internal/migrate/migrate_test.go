@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"user-service/migrations"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestLoadPairsAndSortsMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (a);")},
+		"000002_add_index.down.sql":    {Data: []byte("DROP INDEX i;")},
+		"000001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (a INT);")},
+		"000001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"embed.go":                     {Data: []byte("package migrations")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 {
+		t.Fatalf("expected versions [1 2], got %+v", got)
+	}
+	if got[0].Name != "create_table" || got[0].Down != "DROP TABLE t;" {
+		t.Fatalf("unexpected first migration %+v", got[0])
+	}
+	if len(got[0].Checksum) != 64 || got[0].Checksum == got[1].Checksum {
+		t.Fatalf("expected distinct sha256 checksums, got %q and %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+func TestLoadRejectsMissingUpFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+
+	if _, err := Load(fsys); err == nil || !strings.Contains(err.Error(), "missing up file") {
+		t.Fatalf("expected missing up file error, got %v", err)
+	}
+}
+
+func TestLoadRejectsMismatchedNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_create_table.up.sql": {Data: []byte("CREATE TABLE t (a INT);")},
+		"000001_create_tbl.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+
+	if _, err := Load(fsys); err == nil {
+		t.Fatalf("expected an error for mismatched up/down names")
+	}
+}
+
+func TestEmbeddedMigrationsAreReversible(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("load embedded migrations: %v", err)
+	}
+	if len(got) == 0 {
+		t.Fatalf("expected embedded migrations")
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Fatalf("expected contiguous versions, got %d at position %d", m.Version, i)
+		}
+		if m.Down == "" {
+			t.Fatalf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestPGDetailAppendsDetailAndHint(t *testing.T) {
+	err := fmt.Errorf("exec: %w", &pgconn.PgError{Message: "refused", Detail: "a@example.com: 1, 2", Hint: "fix it"})
+	if got, want := pgDetail(err), "\na@example.com: 1, 2\nhint: fix it"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got := pgDetail(errors.New("plain")); got != "" {
+		t.Fatalf("expected no detail for a non-Postgres error, got %q", got)
+	}
+}
@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"user-service/pkg/contract"
+
+	"github.com/google/uuid"
+)
+
+// actions recorded in the audit history.
+const (
+	AuditActionCreated  = "created"
+	AuditActionUpdated  = "updated"
+	AuditActionDeleted  = "deleted"
+	AuditActionRestored = "restored"
+)
+
+// Audit identifies the command behind a change. The repository records it next to every
+// change made with a context carrying it.
+type Audit struct {
+	Actor     contract.Actor
+	RequestID string
+}
+
+type auditKey struct{}
+
+// WithAudit returns a context whose changes are attributed to audit.
+func WithAudit(ctx context.Context, audit Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// AuditFromContext returns the audit set by WithAudit, or the zero Audit.
+func AuditFromContext(ctx context.Context) Audit {
+	audit, _ := ctx.Value(auditKey{}).(Audit)
+	return audit
+}
+
+// AuditEntry is one recorded change of a user.
+type AuditEntry struct {
+	ID        int64
+	UserID    string
+	Action    string
+	Audit     Audit
+	Changes   map[string]contract.FieldChange
+	CreatedAt time.Time
+}
+
+// HistoryInput requests a page of a user's audit history; Cursor is the NextCursor of the previous page.
+type HistoryInput struct {
+	ID     string `json:"id"`
+	Limit  int32  `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// HistoryQuery is the repository-level history page request; BeforeID is 0 for the first page.
+type HistoryQuery struct {
+	UserID   uuid.UUID
+	Limit    int32
+	BeforeID int64
+}
+
+// HistoryResult is a page of audit entries; NextCursor is empty on the last page.
+type HistoryResult struct {
+	Entries    []AuditEntry
+	NextCursor string
+}
+
+// unauditedFields change with every write, so listing them in a change set says nothing.
+var unauditedFields = map[string]bool{"userId": true, "updatedAt": true, "version": true}
+
+// diffUsers lists the fields that differ between before and after by their JSON names.
+// A nil before is a new user: every field it was created with is a change from null.
+func diffUsers(before *User, after User) map[string]contract.FieldChange {
+	old := map[string]any{}
+	if before != nil {
+		old = dtoFields(*before)
+	}
+	current := dtoFields(after)
+
+	changes := make(map[string]contract.FieldChange)
+	for field, value := range current {
+		if !unauditedFields[field] && old[field] != value {
+			changes[field] = contract.FieldChange{Old: old[field], New: value}
+		}
+	}
+	for field, value := range old {
+		if _, ok := current[field]; !ok && !unauditedFields[field] {
+			changes[field] = contract.FieldChange{Old: value, New: nil}
+		}
+	}
+	return changes
+}
+
+// dtoFields is the user as its JSON object, so fields compare the way clients see them.
+func dtoFields(u User) map[string]any {
+	payload, _ := json.Marshal(ToDTO(u)) // a UserDTO always marshals
+	fields := map[string]any{}
+	_ = json.Unmarshal(payload, &fields)
+	return fields
+}
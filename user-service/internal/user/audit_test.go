@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+)
+
+func TestDiffUsers(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	phone, age := "+15551234567", int32(30)
+	before := User{UserID: "u-1", FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: &phone, Status: StatusActive, CreatedAt: created, Version: 1}
+	after := before
+	after.LastName, after.Phone, after.Age = "Roe", nil, &age
+	after.UpdatedAt, after.Version = created.Add(time.Hour), 2
+
+	got := diffUsers(&before, after)
+	want := map[string]contract.FieldChange{
+		"lastName": {Old: "Doe", New: "Roe"},
+		"phone":    {Old: phone, New: nil},
+		"age":      {Old: nil, New: float64(30)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if changes := diffUsers(&after, after); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+	if changes := diffUsers(nil, before); changes["email"] != (contract.FieldChange{Old: nil, New: "john@example.com"}) || changes["version"] != (contract.FieldChange{}) {
+		t.Fatalf("unexpected changes of a new user %+v", changes)
+	}
+}
+
+func TestAuditFromContext(t *testing.T) {
+	if got := AuditFromContext(context.Background()); !reflect.DeepEqual(got, Audit{}) {
+		t.Fatalf("expected the zero Audit, got %+v", got)
+	}
+	audit := Audit{Actor: contract.Actor{ID: "alice", Source: contract.SourceREST}, RequestID: "req-1"}
+	if got := AuditFromContext(WithAudit(context.Background(), audit)); !reflect.DeepEqual(got, audit) {
+		t.Fatalf("expected %+v, got %+v", audit, got)
+	}
+}
@@ -0,0 +1,63 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last user of a page. Clients only ever see it as an opaque token.
+// Value holds the sort column of that user, so a cursor is only valid for the sort it was issued for.
+type Cursor struct {
+	Sort   string `json:"sort"`
+	Value  string `json:"value"`
+	UserID string `json:"userId"`
+}
+
+func newCursor(sort ListSort, last User) Cursor {
+	c := Cursor{Sort: sortKey(sort), UserID: last.UserID}
+	switch sort.Field {
+	case SortByFirstName:
+		c.Value = last.FirstName
+	case SortByLastName:
+		c.Value = last.LastName
+	default:
+		c.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+func encodeCursor(c Cursor) string {
+	payload, _ := json.Marshal(c) // marshalling plain strings cannot fail
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeCursor(token string, sort ListSort) (Cursor, error) {
+	var c Cursor
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	if c.Sort != sortKey(sort) {
+		return c, errInvalidCursor
+	}
+	if _, err := ParseUUID(c.UserID); err != nil {
+		return c, errInvalidCursor
+	}
+	if sort.Field == SortByCreatedAt {
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return c, errInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+func sortKey(sort ListSort) string {
+	return sort.Field + ":" + sort.Order
+}
@@ -0,0 +1,66 @@
+package user
+
+import "strings"
+
+// EmailNormalizer derives the key that email uniqueness is enforced on. The key is the
+// lowercased address; with ProviderRules the aliasing rules of well-known providers are
+// applied as well, so j.doe+news@gmail.com and jdoe@googlemail.com are the same account.
+//
+// Keys already stored are not rewritten when ProviderRules is switched on, so enable it
+// before users sign up or re-save the affected users afterwards.
+type EmailNormalizer struct {
+	ProviderRules bool
+}
+
+type emailProvider struct {
+	domain     string // canonical domain of the mailbox
+	ignoreDots bool   // dots in the local part are not significant
+	plusTags   bool   // everything from the first '+' in the local part is a tag
+}
+
+// emailProviders lists the domains with known aliasing rules, keyed by lowercase domain.
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {domain: "gmail.com", ignoreDots: true, plusTags: true},
+	"googlemail.com": {domain: "gmail.com", ignoreDots: true, plusTags: true},
+	"outlook.com":    {domain: "outlook.com", plusTags: true},
+	"hotmail.com":    {domain: "hotmail.com", plusTags: true},
+	"icloud.com":     {domain: "icloud.com", plusTags: true},
+	"fastmail.com":   {domain: "fastmail.com", plusTags: true},
+}
+
+// CleanEmail is the form an email is stored and shown in: surrounding whitespace is
+// trimmed and the domain is lowercased, while the local part keeps the user's casing.
+func CleanEmail(email string) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return email
+	}
+	return email[:at+1] + strings.ToLower(email[at+1:])
+}
+
+// Normalize returns the uniqueness key of email.
+func (n EmailNormalizer) Normalize(email string) string {
+	email = strings.ToLower(CleanEmail(email))
+	at := strings.LastIndexByte(email, '@')
+	if !n.ProviderRules || at < 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	provider, ok := emailProviders[domain]
+	if !ok {
+		return email
+	}
+	if provider.plusTags {
+		if plus := strings.IndexByte(local, '+'); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if provider.ignoreDots {
+		if stripped := strings.ReplaceAll(local, ".", ""); stripped != "" {
+			local = stripped
+		}
+	}
+	return local + "@" + provider.domain
+}
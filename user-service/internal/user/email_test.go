@@ -0,0 +1,39 @@
+package user
+
+import "testing"
+
+func TestCleanEmail(t *testing.T) {
+	cases := map[string]string{
+		" Bob.Smith@Example.COM\t": "Bob.Smith@example.com",
+		"bob@example.com":          "bob@example.com",
+		"no-at-sign ":              "no-at-sign",
+		`"a@b"@Example.Org`:        `"a@b"@example.org`,
+	}
+	for in, want := range cases {
+		if got := CleanEmail(in); got != want {
+			t.Fatalf("CleanEmail(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestEmailNormalizer(t *testing.T) {
+	cases := []struct {
+		email         string
+		providerRules bool
+		want          string
+	}{
+		{email: "Bob@Example.com", want: "bob@example.com"},
+		{email: "J.Doe+news@Gmail.com", want: "j.doe+news@gmail.com"},
+		{email: "J.Doe+news@Gmail.com", providerRules: true, want: "jdoe@gmail.com"},
+		{email: "jdoe@googlemail.com", providerRules: true, want: "jdoe@gmail.com"},
+		{email: "j.doe+work@outlook.com", providerRules: true, want: "j.doe@outlook.com"},
+		{email: "j.doe+work@example.com", providerRules: true, want: "j.doe+work@example.com"},
+		{email: "+tag@gmail.com", providerRules: true, want: "+tag@gmail.com"},
+	}
+	for _, tc := range cases {
+		got := EmailNormalizer{ProviderRules: tc.providerRules}.Normalize(tc.email)
+		if got != tc.want {
+			t.Fatalf("Normalize(%q) with provider rules %v: expected %q, got %q", tc.email, tc.providerRules, tc.want, got)
+		}
+	}
+}
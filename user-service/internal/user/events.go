@@ -0,0 +1,85 @@
+package user
+
+import (
+	"time"
+
+	"user-service/pkg/contract"
+
+	"github.com/google/uuid"
+)
+
+// event types carried in contract.Event.Type.
+const (
+	EventTypeCreated  = "user.created"
+	EventTypeUpdated  = "user.updated"
+	EventTypeDeleted  = "user.deleted"
+	EventTypeRestored = "user.restored"
+)
+
+// UserDTO is the JSON shape of a user in command replies and event payloads.
+type UserDTO struct {
+	UserID    string     `json:"userId"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Email     string     `json:"email"`
+	Phone     *string    `json:"phone,omitempty"`
+	PhoneRaw  *string    `json:"phoneRaw,omitempty"`
+	Age       *int32     `json:"age,omitempty"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	Version   int32      `json:"version"`
+}
+
+func ToDTO(in User) UserDTO {
+	return UserDTO{
+		UserID:    in.UserID,
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+		Email:     in.Email,
+		Phone:     in.Phone,
+		PhoneRaw:  in.PhoneRaw,
+		Age:       in.Age,
+		Status:    in.Status,
+		CreatedAt: in.CreatedAt,
+		UpdatedAt: in.UpdatedAt,
+		DeletedAt: in.DeletedAt,
+		Version:   in.Version,
+	}
+}
+
+// OutboxMessage is an event that was committed together with a user change and
+// is waiting to be published.
+type OutboxMessage struct {
+	ID       int64
+	EventID  string
+	Subject  string
+	Payload  []byte
+	Attempts int32
+}
+
+// outboxEvent is an event before it is written to the outbox table.
+type outboxEvent struct {
+	eventID uuid.UUID
+	subject string
+	payload []byte
+}
+
+// newOutboxEvent builds the event envelope; changes is only set for updates.
+func newOutboxEvent(subject, eventType string, data any, changes map[string]contract.FieldChange) (outboxEvent, error) {
+	eventID := uuid.New()
+	event := contract.Event[any]{
+		EventID:    eventID.String(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+		Data:       data,
+		Changes:    changes,
+	}
+
+	payload, err := contract.ToJSON(event)
+	if err != nil {
+		return outboxEvent{}, err
+	}
+	return outboxEvent{eventID: eventID, subject: subject, payload: payload}, nil
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+)
+
+const userColumns = "user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw"
+
+type sortColumn struct {
+	name string
+	cast string // cast applied to the cursor value, which always travels as text
+}
+
+// sortColumns is the allow-list of sortable fields; nothing else ever reaches ORDER BY.
+var sortColumns = map[string]sortColumn{
+	SortByCreatedAt: {name: "created_at", cast: "::timestamptz"},
+	SortByFirstName: {name: "first_name"},
+	SortByLastName:  {name: "last_name"},
+}
+
+// buildListQuery renders the ListUsers SQL for the given filter, sort and cursor.
+// Every value is passed as a positional argument; only allow-listed column names are interpolated.
+func buildListQuery(q ListQuery) (string, []any, error) {
+	column, ok := sortColumns[q.Sort.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported sort field %q", q.Sort.Field)
+	}
+	direction, comparison := "ASC", ">"
+	if q.Sort.Order == SortOrderDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	var (
+		conditions []string
+		args       []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	f := q.Filter
+	if !f.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = "+arg(f.Status))
+	}
+	if f.EmailDomain != "" {
+		// match the domain itself and any of its subdomains
+		domain := arg(strings.ToLower(f.EmailDomain))
+		conditions = append(conditions, fmt.Sprintf(
+			"(lower(split_part(email, '@', 2)) = %[1]s OR lower(split_part(email, '@', 2)) LIKE '%%.' || %[1]s)", domain))
+	}
+	if f.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+arg(*f.CreatedTo))
+	}
+	if f.MinAge != nil {
+		conditions = append(conditions, "age >= "+arg(*f.MinAge))
+	}
+	if f.MaxAge != nil {
+		conditions = append(conditions, "age <= "+arg(*f.MaxAge))
+	}
+	if q.After != nil {
+		afterID, err := ParseUUID(q.After.UserID)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, user_id) %s (%s%s, %s)",
+			column.name, comparison, arg(q.After.Value), column.cast, arg(afterID)))
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT " + userColumns + "\nFROM users")
+	if len(conditions) > 0 {
+		sql.WriteString("\nWHERE " + strings.Join(conditions, "\n    AND "))
+	}
+	fmt.Fprintf(&sql, "\nORDER BY %s %s, user_id %s\nLIMIT %s", column.name, direction, direction, arg(q.Limit))
+
+	return sql.String(), args, nil
+}
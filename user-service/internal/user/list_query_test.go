@@ -0,0 +1,65 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildListQueryDefaultSort(t *testing.T) {
+	sql, args, err := buildListQuery(ListQuery{Limit: 51, Sort: ListSort{Field: SortByCreatedAt, Order: SortOrderDesc}})
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	if !strings.Contains(sql, "WHERE deleted_at IS NULL\nORDER BY") {
+		t.Fatalf("expected only the soft-delete condition, got %q", sql)
+	}
+	if !strings.Contains(sql, "ORDER BY created_at DESC, user_id DESC") {
+		t.Fatalf("expected created_at DESC ordering, got %q", sql)
+	}
+	if len(args) != 1 || args[0] != int32(51) {
+		t.Fatalf("expected only the limit argument, got %#v", args)
+	}
+}
+
+func TestBuildListQueryFiltersAndCursor(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	minAge := int32(18)
+	query := ListQuery{
+		Limit:  11,
+		Filter: ListFilter{Status: StatusInactive, EmailDomain: "Example.com", CreatedFrom: &from, MinAge: &minAge, IncludeDeleted: true},
+		Sort:   ListSort{Field: SortByLastName, Order: SortOrderAsc},
+		After:  &Cursor{Value: "Doe", UserID: "550e8400-e29b-41d4-a716-446655440000"},
+	}
+
+	sql, args, err := buildListQuery(query)
+	if err != nil {
+		t.Fatalf("build query: %v", err)
+	}
+	for _, want := range []string{
+		"status = $1",
+		"lower(split_part(email, '@', 2)) = $2",
+		"created_at >= $3",
+		"age >= $4",
+		"(last_name, user_id) > ($5, $6)",
+		"ORDER BY last_name ASC, user_id ASC",
+		"LIMIT $7",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("expected %q in query %q", want, sql)
+		}
+	}
+	if strings.Contains(sql, "deleted_at IS NULL") {
+		t.Fatalf("expected soft-deleted users to be included, got %q", sql)
+	}
+	if args[1] != "example.com" {
+		t.Fatalf("expected lowercased domain argument, got %#v", args[1])
+	}
+}
+
+func TestBuildListQueryRejectsUnknownSortField(t *testing.T) {
+	_, _, err := buildListQuery(ListQuery{Limit: 10, Sort: ListSort{Field: "email; DROP TABLE users", Order: SortOrderAsc}})
+	if err == nil {
+		t.Fatalf("expected unknown sort field to be rejected")
+	}
+}
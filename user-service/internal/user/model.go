@@ -11,35 +11,155 @@ const (
 	StatusInactive = "Inactive"
 )
 
+// page size limits for ListUsers; the server clamps anything above MaxListLimit.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// result limits for SearchUsers.
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 50
+)
+
+// sort fields and orders accepted by ListUsers.
+const (
+	SortByCreatedAt = "createdAt"
+	SortByFirstName = "firstName"
+	SortByLastName  = "lastName"
+
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+// bulk create modes: atomic creates every row or none, partial creates the valid rows and reports the rest.
+const (
+	BulkModeAtomic  = "atomic"
+	BulkModePartial = "partial"
+)
+
+// MaxBulkCreateRows caps one bulk create so the request and its report fit in a NATS message.
+const MaxBulkCreateRows = 1000
+
 // domain/internal models for service + repository layer
 type User struct {
 	UserID    string
 	FirstName string
 	LastName  string
 	Email     string
-	Phone     *string
+	Phone     *string // E.164, e.g. +15551234567
+	PhoneRaw  *string // the phone number as the user entered it
 	Age       *int32
 	Status    string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	DeletedAt *time.Time // set while the user is soft-deleted
+	Version   int32      // incremented on every change; used for optimistic concurrency
 }
 
 type CreateInput struct {
 	FirstName string `json:"firstName" validate:"required,min=2,max=50"`
 	LastName  string `json:"lastName" validate:"required,min=2,max=50"`
 	Email     string `json:"email" validate:"required,email"`
-	Phone     string `json:"phone,omitempty" validate:"omitempty,phone"`
+	Phone     string `json:"phone,omitempty" validate:"omitempty,phone_e164"`
 	Age       *int32 `json:"age,omitempty" validate:"omitempty,gt=0"`
 	Status    string `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+	// EmailNormalized is the uniqueness key of Email; the service sets it before storing.
+	EmailNormalized string `json:"-"`
+	// PhoneRaw is the phone as received; the service then rewrites Phone to E.164.
+	PhoneRaw string `json:"-"`
+}
+
+type BulkCreateInput struct {
+	Mode  string        `json:"mode,omitempty" validate:"omitempty,oneof=atomic partial"`
+	Users []CreateInput `json:"users"`
+}
+
+// BulkRowResult is the outcome of one row of a bulk create. Row is the 1-based position in
+// the input; exactly one of User and Err is set.
+type BulkRowResult struct {
+	Row  int
+	User *User
+	Err  error
+}
+
+type BulkCreateResult struct {
+	Mode    string
+	Rows    []BulkRowResult
+	Created int
+	Failed  int
 }
 
 type UpdateInput struct {
 	FirstName *string `json:"firstName,omitempty" validate:"omitempty,min=2,max=50"`
 	LastName  *string `json:"lastName,omitempty" validate:"omitempty,min=2,max=50"`
 	Email     *string `json:"email,omitempty" validate:"omitempty,email"`
-	Phone     *string `json:"phone,omitempty" validate:"omitempty,phone"`
+	Phone     *string `json:"phone,omitempty" validate:"omitempty,phone_e164"`
 	Age       *int32  `json:"age,omitempty" validate:"omitempty,gt=0"`
 	Status    *string `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+	// ExpectedVersion makes the update fail with ErrVersionConflict unless the stored version matches.
+	ExpectedVersion *int32 `json:"expectedVersion,omitempty" validate:"omitempty,gt=0"`
+	// EmailNormalized is the uniqueness key of Email; the service sets it whenever Email is set.
+	EmailNormalized *string `json:"-"`
+	// PhoneRaw is the phone as received; the service then rewrites Phone to E.164.
+	PhoneRaw *string `json:"-"`
+}
+
+// ListFilter narrows a listing; zero values mean "no filter". CreatedTo is exclusive.
+type ListFilter struct {
+	Status      string     `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+	EmailDomain string     `json:"emailDomain,omitempty" validate:"omitempty,fqdn"`
+	CreatedFrom *time.Time `json:"createdFrom,omitempty"`
+	CreatedTo   *time.Time `json:"createdTo,omitempty"`
+	MinAge      *int32     `json:"minAge,omitempty" validate:"omitempty,gt=0"`
+	MaxAge      *int32     `json:"maxAge,omitempty" validate:"omitempty,gt=0"`
+	// IncludeDeleted also returns soft-deleted users; meant for admin tooling.
+	IncludeDeleted bool `json:"includeDeleted,omitempty"`
+}
+
+type ListSort struct {
+	Field string `json:"field,omitempty" validate:"omitempty,oneof=createdAt firstName lastName"`
+	Order string `json:"order,omitempty" validate:"omitempty,oneof=asc desc"`
+}
+
+type ListInput struct {
+	Limit  int32      `json:"limit,omitempty"`
+	Cursor string     `json:"cursor,omitempty"`
+	Filter ListFilter `json:"filter"`
+	Sort   ListSort   `json:"sort"`
+}
+
+// ListQuery is the repository-level page request; After is nil for the first page.
+// Sort is always fully populated by the service.
+type ListQuery struct {
+	Limit  int32
+	Filter ListFilter
+	Sort   ListSort
+	After  *Cursor
+}
+
+type ListResult struct {
+	Users      []User
+	NextCursor string
+}
+
+type SearchInput struct {
+	Query string `json:"query" validate:"required,min=2,max=100"`
+	Limit int32  `json:"limit,omitempty"`
+}
+
+// SearchQuery is the repository-level search; Digits is empty unless the query looks like part of a phone number.
+type SearchQuery struct {
+	Term   string
+	Digits string
+	Limit  int32
+}
+
+// SearchResult is a matched user with its relevance score between 0 and 1.
+type SearchResult struct {
+	User  User
+	Score float32
 }
 
 func ParseUUID(id string) (uuid.UUID, error) {
@@ -2,59 +2,241 @@ package user
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	db "user-service/internal/db/sqlc"
+	"user-service/pkg/contract"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostgresRepository struct {
+	pool    *pgxpool.Pool
 	queries *db.Queries
 }
 
-func NewPostgresRepository(queries *db.Queries) *PostgresRepository {
-	return &PostgresRepository{queries: queries}
+func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{pool: pool, queries: db.New(pool)}
 }
 
 func (r *PostgresRepository) Create(ctx context.Context, input CreateInput) (*User, error) {
-	params := db.CreateUserParams{
-		FirstName: input.FirstName,
-		LastName:  input.LastName,
-		Email:     input.Email,
-		Status:    input.Status,
+	var out User
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		created, err := createUser(ctx, q, input)
+		out = created
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if input.Phone != "" {
-		params.Phone = pgtype.Text{String: input.Phone, Valid: true}
+	return &out, nil
+}
+
+// BulkCreate creates the users in one transaction and returns one result per input, in order.
+// Atomic mode inserts them all with a single statement, or none of them when any email is
+// already taken. Partial mode inserts row by row behind savepoints, so a taken email only
+// fails its own row. The inputs must already be validated and have distinct emails.
+func (r *PostgresRepository) BulkCreate(ctx context.Context, inputs []CreateInput, atomic bool) ([]BulkRowResult, error) {
+	if atomic {
+		return r.bulkCreateAtomic(ctx, inputs)
 	}
-	if input.Age != nil {
-		params.Age = pgtype.Int4{Int32: *input.Age, Valid: true}
+	return r.bulkCreatePartial(ctx, inputs)
+}
+
+func (r *PostgresRepository) bulkCreateAtomic(ctx context.Context, inputs []CreateInput) ([]BulkRowResult, error) {
+	params := db.BulkCreateUsersParams{
+		FirstNames:       make([]string, 0, len(inputs)),
+		LastNames:        make([]string, 0, len(inputs)),
+		Emails:           make([]string, 0, len(inputs)),
+		Phones:           make([]string, 0, len(inputs)),
+		Ages:             make([]int32, 0, len(inputs)),
+		Statuses:         make([]string, 0, len(inputs)),
+		EmailsNormalized: make([]string, 0, len(inputs)),
+		PhoneRaws:        make([]string, 0, len(inputs)),
+	}
+	for _, input := range inputs {
+		var age int32 // zero is stored as NULL
+		if input.Age != nil {
+			age = *input.Age
+		}
+		params.FirstNames = append(params.FirstNames, input.FirstName)
+		params.LastNames = append(params.LastNames, input.LastName)
+		params.Emails = append(params.Emails, input.Email)
+		params.Phones = append(params.Phones, input.Phone)
+		params.Ages = append(params.Ages, age)
+		params.Statuses = append(params.Statuses, input.Status)
+		params.EmailsNormalized = append(params.EmailsNormalized, input.EmailNormalized)
+		params.PhoneRaws = append(params.PhoneRaws, input.PhoneRaw)
 	}
 
-	row, err := r.queries.CreateUser(ctx, params)
+	results := make([]BulkRowResult, len(inputs))
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		taken, err := q.ListLiveNormalizedEmails(ctx, params.EmailsNormalized)
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			takenSet := make(map[string]struct{}, len(taken))
+			for _, email := range taken {
+				takenSet[email] = struct{}{}
+			}
+			for i, input := range inputs {
+				results[i].Err = ErrBulkAborted
+				if _, ok := takenSet[input.EmailNormalized]; ok {
+					results[i].Err = ErrEmailAlreadyExists
+				}
+			}
+			return nil
+		}
+
+		rows, err := q.BulkCreateUsers(ctx, params)
+		if err != nil {
+			if isUniqueViolation(err) { // an email was taken after the check above
+				return ErrEmailAlreadyExists
+			}
+			return err
+		}
+
+		// RETURNING order is not guaranteed, so match rows back to inputs by normalized email
+		byEmail := make(map[string]User, len(rows))
+		for _, row := range rows {
+			created := mapDBUser(row)
+			byEmail[row.EmailNormalized] = created
+			if err := insertAudit(ctx, q, AuditActionCreated, row.UserID, diffUsers(nil, created)); err != nil {
+				return err
+			}
+			if err := insertEvent(ctx, q, contract.SubjectUserEventCreated, EventTypeCreated, ToDTO(created), nil); err != nil {
+				return err
+			}
+		}
+		for i, input := range inputs {
+			created := byEmail[input.EmailNormalized]
+			results[i].User = &created
+		}
+		return nil
+	})
 	if err != nil {
-		if isUniqueViolation(err) {
-			return nil, ErrEmailAlreadyExists
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *PostgresRepository) bulkCreatePartial(ctx context.Context, inputs []CreateInput) ([]BulkRowResult, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+
+	results := make([]BulkRowResult, len(inputs))
+	for i, input := range inputs {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := createUser(ctx, r.queries.WithTx(savepoint), input)
+		if err != nil {
+			_ = savepoint.Rollback(ctx)
+			if errors.Is(err, ErrEmailAlreadyExists) {
+				results[i].Err = err
+				continue
+			}
+			return nil, err
 		}
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, err
+		}
+		results[i].User = &created
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
+	return results, nil
+}
 
-	out := mapDBUser(row)
-	return &out, nil
+// List is built dynamically rather than through sqlc because the filter set and
+// the ORDER BY column depend on the request; see buildListQuery.
+func (r *PostgresRepository) List(ctx context.Context, query ListQuery) ([]User, error) {
+	sql, args, err := buildListQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]User, 0, query.Limit)
+	for rows.Next() {
+		var row db.User
+		if err := rows.Scan(
+			&row.UserID,
+			&row.FirstName,
+			&row.LastName,
+			&row.Email,
+			&row.Phone,
+			&row.Age,
+			&row.Status,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+			&row.DeletedAt,
+			&row.Version,
+			&row.EmailNormalized,
+			&row.PhoneRaw,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, mapDBUser(row))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (r *PostgresRepository) List(ctx context.Context) ([]User, error) {
-	rows, err := r.queries.ListUsers(ctx)
+func (r *PostgresRepository) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	params := db.SearchUsersParams{
+		Term:         query.Term,
+		Digits:       query.Digits,
+		EmailPattern: "%" + escapeLike(query.Term) + "%",
+		PhonePattern: "%" + query.Digits + "%",
+		ResultLimit:  query.Limit,
+	}
+
+	rows, err := r.queries.SearchUsers(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 
-	out := make([]User, 0, len(rows))
+	out := make([]SearchResult, 0, len(rows))
 	for _, row := range rows {
-		out = append(out, mapDBUser(row))
+		out = append(out, SearchResult{
+			User: mapDBUser(db.User{
+				UserID:    row.UserID,
+				FirstName: row.FirstName,
+				LastName:  row.LastName,
+				Email:     row.Email,
+				Phone:     row.Phone,
+				Age:       row.Age,
+				Status:    row.Status,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Version:   row.Version,
+				PhoneRaw:  row.PhoneRaw,
+			}),
+			Score: row.Score,
+		})
 	}
 	return out, nil
 }
@@ -72,6 +254,19 @@ func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*User,
 	return &out, nil
 }
 
+func (r *PostgresRepository) GetByEmail(ctx context.Context, emailNormalized string) (*User, error) {
+	row, err := r.queries.GetUserByEmail(ctx, emailNormalized)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	out := mapDBUser(row)
+	return &out, nil
+}
+
 func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, input UpdateInput) (*User, error) {
 	params := db.UpdateUserParams{UserID: pgtype.UUID{Bytes: id, Valid: true}}
 	if input.FirstName != nil {
@@ -83,40 +278,312 @@ func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, input Upd
 	if input.Email != nil {
 		params.Email = pgtype.Text{String: *input.Email, Valid: true}
 	}
+	if input.EmailNormalized != nil {
+		params.EmailNormalized = pgtype.Text{String: *input.EmailNormalized, Valid: true}
+	}
 	if input.Phone != nil {
 		params.Phone = pgtype.Text{String: *input.Phone, Valid: true}
 	}
+	if input.PhoneRaw != nil {
+		params.PhoneRaw = pgtype.Text{String: *input.PhoneRaw, Valid: true}
+	}
 	if input.Age != nil {
 		params.Age = pgtype.Int4{Int32: *input.Age, Valid: true}
 	}
 	if input.Status != nil {
 		params.Status = pgtype.Text{String: *input.Status, Valid: true}
 	}
+	if input.ExpectedVersion != nil {
+		params.ExpectedVersion = pgtype.Int4{Int32: *input.ExpectedVersion, Valid: true}
+	}
 
-	row, err := r.queries.UpdateUser(ctx, params)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
+	var out User
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		before, err := lockUser(ctx, q, params.UserID)
+		if err != nil {
+			return err
 		}
-		if isUniqueViolation(err) {
-			return nil, ErrEmailAlreadyExists
+		row, err := q.UpdateUser(ctx, params)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return missingOrStale(ctx, q, id, input.ExpectedVersion)
+			}
+			if isUniqueViolation(err) {
+				return ErrEmailAlreadyExists
+			}
+			return err
+		}
+
+		out = mapDBUser(row)
+		changes := diffUsers(&before, out)
+		if err := insertAudit(ctx, q, AuditActionUpdated, row.UserID, changes); err != nil {
+			return err
 		}
+		return insertEvent(ctx, q, contract.SubjectUserEventUpdated, EventTypeUpdated, ToDTO(out), changes)
+	})
+	if err != nil {
 		return nil, err
 	}
+	return &out, nil
+}
 
-	out := mapDBUser(row)
+// Delete soft-deletes the user; the row is removed later by Purge.
+func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID, expectedVersion *int32) error {
+	params := db.DeleteUserParams{UserID: pgtype.UUID{Bytes: id, Valid: true}}
+	if expectedVersion != nil {
+		params.ExpectedVersion = pgtype.Int4{Int32: *expectedVersion, Valid: true}
+	}
+
+	return r.withTx(ctx, func(q *db.Queries) error {
+		before, err := lockUser(ctx, q, params.UserID)
+		if err != nil {
+			return err
+		}
+		row, err := q.DeleteUser(ctx, params)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return missingOrStale(ctx, q, id, expectedVersion)
+			}
+			return err
+		}
+
+		if err := insertAudit(ctx, q, AuditActionDeleted, row.UserID, diffUsers(&before, mapDBUser(row))); err != nil {
+			return err
+		}
+		return insertEvent(ctx, q, contract.SubjectUserEventDeleted, EventTypeDeleted, map[string]string{"userId": id.String()}, nil)
+	})
+}
+
+func (r *PostgresRepository) Restore(ctx context.Context, id uuid.UUID) (*User, error) {
+	var out User
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		before, err := lockUser(ctx, q, pgtype.UUID{Bytes: id, Valid: true})
+		if err != nil {
+			return err
+		}
+		row, err := q.RestoreUser(ctx, pgtype.UUID{Bytes: id, Valid: true})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			if isUniqueViolation(err) { // a live user took the email in the meantime
+				return ErrEmailAlreadyExists
+			}
+			return err
+		}
+
+		out = mapDBUser(row)
+		if err := insertAudit(ctx, q, AuditActionRestored, row.UserID, diffUsers(&before, out)); err != nil {
+			return err
+		}
+		return insertEvent(ctx, q, contract.SubjectUserEventRestored, EventTypeRestored, ToDTO(out), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &out, nil
 }
 
-func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	affected, err := r.queries.DeleteUser(ctx, pgtype.UUID{Bytes: id, Valid: true})
+// History returns a page of the user's audit entries, newest first.
+func (r *PostgresRepository) History(ctx context.Context, query HistoryQuery) ([]AuditEntry, error) {
+	params := db.ListUserAuditParams{
+		UserID:   pgtype.UUID{Bytes: query.UserID, Valid: true},
+		PageSize: query.Limit,
+	}
+	if query.BeforeID > 0 {
+		params.BeforeID = pgtype.Int8{Int64: query.BeforeID, Valid: true}
+	}
+
+	rows, err := r.queries.ListUserAudit(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := AuditEntry{
+			ID:     row.ID,
+			UserID: uuid.UUID(row.UserID.Bytes).String(),
+			Action: row.Action,
+			Audit: Audit{
+				Actor:     contract.Actor{ID: row.ActorID, Source: row.Source},
+				RequestID: row.RequestID,
+			},
+			CreatedAt: row.CreatedAt.Time,
+		}
+		if err := json.Unmarshal(row.Changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// Purge hard-deletes users that were soft-deleted before the given time.
+func (r *PostgresRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return r.queries.PurgeDeletedUsers(ctx, pgtype.Timestamptz{Time: deletedBefore, Valid: true})
+}
+
+// RelayOutbox claims up to limit pending outbox events, hands each one to publish and
+// records the outcome. Rows are locked with SKIP LOCKED, so several relays can run at once.
+// Failed events are retried later with exponential backoff. It returns how many were sent.
+func (r *PostgresRepository) RelayOutbox(ctx context.Context, limit int32, publish func(OutboxMessage) error) (int, error) {
+	sent := 0
+	err := r.withTx(ctx, func(q *db.Queries) error {
+		rows, err := q.ClaimPendingOutboxEvents(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			msg := OutboxMessage{
+				ID:       row.ID,
+				EventID:  uuid.UUID(row.EventID.Bytes).String(),
+				Subject:  row.Subject,
+				Payload:  row.Payload,
+				Attempts: row.Attempts,
+			}
+
+			if pubErr := publish(msg); pubErr != nil {
+				if err := q.MarkOutboxEventFailed(ctx, db.MarkOutboxEventFailedParams{
+					LastError:     pgtype.Text{String: pubErr.Error(), Valid: true},
+					NextAttemptAt: pgtype.Timestamptz{Time: time.Now().Add(outboxBackoff(row.Attempts + 1)), Valid: true},
+					ID:            row.ID,
+				}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := q.MarkOutboxEventSent(ctx, row.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// PruneOutbox deletes events that were published before the given time.
+func (r *PostgresRepository) PruneOutbox(ctx context.Context, sentBefore time.Time) (int64, error) {
+	return r.queries.DeleteSentOutboxEvents(ctx, pgtype.Timestamptz{Time: sentBefore, Valid: true})
+}
+
+// withTx runs fn in a transaction and commits only if fn returns nil.
+func (r *PostgresRepository) withTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	if affected == 0 {
+	defer func() { _ = tx.Rollback(ctx) }() // no-op after a successful commit
+
+	if err := fn(r.queries.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// createUser inserts the user and its created event with the given queries.
+func createUser(ctx context.Context, q *db.Queries, input CreateInput) (User, error) {
+	params := db.CreateUserParams{
+		FirstName:       input.FirstName,
+		LastName:        input.LastName,
+		Email:           input.Email,
+		Status:          input.Status,
+		EmailNormalized: input.EmailNormalized,
+	}
+	if input.Phone != "" {
+		params.Phone = pgtype.Text{String: input.Phone, Valid: true}
+		params.PhoneRaw = pgtype.Text{String: input.PhoneRaw, Valid: true}
+	}
+	if input.Age != nil {
+		params.Age = pgtype.Int4{Int32: *input.Age, Valid: true}
+	}
+
+	row, err := q.CreateUser(ctx, params)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return User{}, ErrEmailAlreadyExists
+		}
+		return User{}, err
+	}
+
+	created := mapDBUser(row)
+	if err := insertAudit(ctx, q, AuditActionCreated, row.UserID, diffUsers(nil, created)); err != nil {
+		return User{}, err
+	}
+	return created, insertEvent(ctx, q, contract.SubjectUserEventCreated, EventTypeCreated, ToDTO(created), nil)
+}
+
+// lockUser reads the user, deleted or not, and locks it for the rest of the transaction,
+// so the audit entry diffs against the state the change was applied to.
+func lockUser(ctx context.Context, q *db.Queries, id pgtype.UUID) (User, error) {
+	row, err := q.LockUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	return mapDBUser(row), nil
+}
+
+// insertAudit records changes in the user's audit history inside the caller's transaction,
+// attributed to the Audit on ctx.
+func insertAudit(ctx context.Context, q *db.Queries, action string, userID pgtype.UUID, changes map[string]contract.FieldChange) error {
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	audit := AuditFromContext(ctx)
+	return q.InsertUserAudit(ctx, db.InsertUserAuditParams{
+		UserID:    userID,
+		Action:    action,
+		ActorID:   audit.Actor.ID,
+		Source:    audit.Actor.Source,
+		RequestID: audit.RequestID,
+		Changes:   payload,
+	})
+}
+
+// insertEvent writes an event to the outbox inside the caller's transaction.
+func insertEvent(ctx context.Context, q *db.Queries, subject, eventType string, data any, changes map[string]contract.FieldChange) error {
+	event, err := newOutboxEvent(subject, eventType, data, changes)
+	if err != nil {
+		return err
+	}
+	return q.InsertOutboxEvent(ctx, db.InsertOutboxEventParams{
+		EventID: pgtype.UUID{Bytes: event.eventID, Valid: true},
+		Subject: event.subject,
+		Payload: event.payload,
+	})
+}
+
+// missingOrStale explains why a version-guarded write matched no row:
+// the user is gone, or it exists with a different version.
+func missingOrStale(ctx context.Context, q *db.Queries, id uuid.UUID, expectedVersion *int32) error {
+	if expectedVersion == nil {
 		return ErrUserNotFound
 	}
-	return nil
+	if _, err := q.GetUserByID(ctx, pgtype.UUID{Bytes: id, Valid: true}); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return ErrVersionConflict
+}
+
+const maxOutboxBackoff = 5 * time.Minute
+
+// outboxBackoff is the delay before retry number attempts: 2s, 4s, 8s, ... capped at five minutes.
+func outboxBackoff(attempts int32) time.Duration {
+	if attempts >= 9 { // 2^9s already exceeds the cap
+		return maxOutboxBackoff
+	}
+	return min(time.Duration(1<<attempts)*time.Second, maxOutboxBackoff)
 }
 
 func mapDBUser(row db.User) User {
@@ -128,20 +595,34 @@ func mapDBUser(row db.User) User {
 		Status:    row.Status,
 		CreatedAt: row.CreatedAt.Time,
 		UpdatedAt: row.UpdatedAt.Time,
+		Version:   row.Version,
 	}
 
 	if row.Phone.Valid {
 		phone := row.Phone.String
 		result.Phone = &phone
 	}
+	if row.PhoneRaw.Valid {
+		phoneRaw := row.PhoneRaw.String
+		result.PhoneRaw = &phoneRaw
+	}
 	if row.Age.Valid {
 		age := row.Age.Int32
 		result.Age = &age
 	}
+	if row.DeletedAt.Valid {
+		deletedAt := row.DeletedAt.Time
+		result.DeletedAt = &deletedAt
+	}
 
 	return result
 }
 
+// escapeLike escapes the LIKE wildcards so user input is matched literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
 func isUniqueViolation(err error) bool {
 	var pgErr *pgconn.PgError
 	return errors.As(err, &pgErr) && pgErr.Code == "23505"
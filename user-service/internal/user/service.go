@@ -4,7 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"user-service/pkg/contract"
 	"user-service/pkg/validation"
 
 	"github.com/go-playground/validator/v10"
@@ -15,44 +20,265 @@ var (
 	ErrInvalidInput       = errors.New("invalid input")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrEmailAlreadyExists = errors.New("email already exists")
+	ErrVersionConflict    = errors.New("user was modified by another request")
+	// ErrBulkAborted marks valid rows of an atomic bulk create that were skipped because another row failed.
+	ErrBulkAborted = errors.New("not created because another row failed")
 )
 
+// ValidationError is an ErrInvalidInput caused by struct validation; Violations lists the failed fields.
+type ValidationError struct {
+	Message    string
+	Violations []contract.FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	return ErrInvalidInput.Error() + ": " + e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidInput
+}
+
+// invalid wraps a validator error into a ValidationError with the given message.
+func invalid(message string, err error) error {
+	return &ValidationError{Message: message, Violations: validation.Violations(err)}
+}
+
 type Repository interface {
 	Create(ctx context.Context, input CreateInput) (*User, error)
-	List(ctx context.Context) ([]User, error)
+	BulkCreate(ctx context.Context, inputs []CreateInput, atomic bool) ([]BulkRowResult, error)
+	List(ctx context.Context, query ListQuery) ([]User, error)
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, emailNormalized string) (*User, error)
 	Update(ctx context.Context, id uuid.UUID, input UpdateInput) (*User, error)
-	Delete(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID, expectedVersion *int32) error
+	Restore(ctx context.Context, id uuid.UUID) (*User, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	History(ctx context.Context, query HistoryQuery) ([]AuditEntry, error)
 }
 
-type Service struct {
-	repo     Repository
-	validate *validator.Validate
+// Config holds the settings that decide how user data is normalized.
+type Config struct {
+	Emails EmailNormalizer
+	// PhoneRegion is the ISO 3166-1 region national phone numbers are read in, e.g. "US".
+	// Without it only numbers with a country code are accepted.
+	PhoneRegion string
 }
 
-func NewService(repo Repository) *Service {
-	v := validator.New()
-	_ = validation.RegisterPhone(v)
+type Service struct {
+	repo        Repository
+	validate    *validator.Validate
+	emails      EmailNormalizer
+	phoneRegion string
+}
 
+func NewService(repo Repository, config Config) *Service {
 	return &Service{
-		repo:     repo,
-		validate: v,
+		repo:        repo,
+		validate:    validation.New(validation.WithPhoneRegion(config.PhoneRegion)),
+		emails:      config.Emails,
+		phoneRegion: config.PhoneRegion,
 	}
 }
 
 func (s *Service) CreateUser(ctx context.Context, input CreateInput) (*User, error) {
+	input.Email = CleanEmail(input.Email)
 	if err := s.validate.Struct(input); err != nil {
-		return nil, fmt.Errorf("%w: invalid create payload", ErrInvalidInput)
+		return nil, invalid("invalid create payload", err)
 	}
 
+	input.EmailNormalized = s.emails.Normalize(input.Email)
+	input.Phone, input.PhoneRaw = s.normalizePhone(input.Phone)
 	if input.Status == "" {
 		input.Status = StatusActive
 	}
 	return s.repo.Create(ctx, input)
 }
 
-func (s *Service) ListUsers(ctx context.Context) ([]User, error) {
-	return s.repo.List(ctx)
+// BulkCreateUsers validates every row with the CreateUser rules and creates the valid ones.
+// In atomic mode (the default) a single failing row means no user is created; in partial
+// mode the remaining rows are still created. The report has one entry per input row.
+func (s *Service) BulkCreateUsers(ctx context.Context, input BulkCreateInput) (*BulkCreateResult, error) {
+	if input.Mode == "" {
+		input.Mode = BulkModeAtomic
+	}
+	if err := s.validate.Struct(input); err != nil {
+		return nil, invalid("mode must be atomic or partial", err)
+	}
+	switch {
+	case len(input.Users) == 0:
+		return nil, fmt.Errorf("%w: at least one user is required", ErrInvalidInput)
+	case len(input.Users) > MaxBulkCreateRows:
+		return nil, fmt.Errorf("%w: at most %d users per request", ErrInvalidInput, MaxBulkCreateRows)
+	}
+
+	result := &BulkCreateResult{Mode: input.Mode, Rows: make([]BulkRowResult, len(input.Users))}
+	valid := make([]CreateInput, 0, len(input.Users))
+	validRows := make([]int, 0, len(input.Users)) // index into result.Rows of each valid input
+	seenEmails := make(map[string]int, len(input.Users))
+	for i, row := range input.Users {
+		result.Rows[i].Row = i + 1
+		row.Email = CleanEmail(row.Email)
+		if err := s.validate.Struct(row); err != nil {
+			violations := validation.Violations(err)
+			fields := make([]string, 0, len(violations))
+			for _, violation := range violations {
+				fields = append(fields, violation.Field)
+			}
+			result.Rows[i].Err = &ValidationError{Message: "bad value for " + strings.Join(fields, ", "), Violations: violations}
+			continue
+		}
+		row.EmailNormalized = s.emails.Normalize(row.Email)
+		row.Phone, row.PhoneRaw = s.normalizePhone(row.Phone)
+		if first, ok := seenEmails[row.EmailNormalized]; ok {
+			result.Rows[i].Err = fmt.Errorf("%w: same email as row %d", ErrEmailAlreadyExists, first)
+			continue
+		}
+		seenEmails[row.EmailNormalized] = i + 1
+
+		if row.Status == "" {
+			row.Status = StatusActive
+		}
+		valid = append(valid, row)
+		validRows = append(validRows, i)
+	}
+
+	atomic := input.Mode == BulkModeAtomic
+	switch {
+	case atomic && len(valid) < len(input.Users):
+		for _, i := range validRows {
+			result.Rows[i].Err = ErrBulkAborted
+		}
+	case len(valid) > 0:
+		outcomes, err := s.repo.BulkCreate(ctx, valid, atomic)
+		if err != nil {
+			return nil, err
+		}
+		for j, outcome := range outcomes {
+			result.Rows[validRows[j]].User = outcome.User
+			result.Rows[validRows[j]].Err = outcome.Err
+		}
+	}
+
+	for _, row := range result.Rows {
+		if row.Err != nil {
+			result.Failed++
+		} else {
+			result.Created++
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) ListUsers(ctx context.Context, input ListInput) (*ListResult, error) {
+	limit := input.Limit
+	switch {
+	case limit < 0:
+		return nil, fmt.Errorf("%w: limit must be positive", ErrInvalidInput)
+	case limit == 0:
+		limit = DefaultListLimit
+	case limit > MaxListLimit:
+		limit = MaxListLimit
+	}
+
+	if err := s.validate.Struct(input); err != nil {
+		return nil, invalid("invalid list filter or sort", err)
+	}
+	filter := input.Filter
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, fmt.Errorf("%w: createdFrom must be before createdTo", ErrInvalidInput)
+	}
+	if filter.MinAge != nil && filter.MaxAge != nil && *filter.MinAge > *filter.MaxAge {
+		return nil, fmt.Errorf("%w: minAge must not exceed maxAge", ErrInvalidInput)
+	}
+
+	sort := input.Sort
+	if sort.Field == "" {
+		sort.Field = SortByCreatedAt
+	}
+	if sort.Order == "" {
+		// newest first for dates, alphabetical for names
+		sort.Order = SortOrderAsc
+		if sort.Field == SortByCreatedAt {
+			sort.Order = SortOrderDesc
+		}
+	}
+
+	// fetch one extra row to know whether another page exists
+	query := ListQuery{Limit: limit + 1, Filter: filter, Sort: sort}
+	if input.Cursor != "" {
+		cursor, err := decodeCursor(input.Cursor, sort)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidInput)
+		}
+		query.After = &cursor
+	}
+
+	users, err := s.repo.List(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListResult{Users: users}
+	if len(users) > int(limit) {
+		result.Users = users[:limit]
+		result.NextCursor = encodeCursor(newCursor(sort, result.Users[limit-1]))
+	}
+	return result, nil
+}
+
+func (s *Service) SearchUsers(ctx context.Context, input SearchInput) ([]SearchResult, error) {
+	input.Query = strings.TrimSpace(input.Query)
+	if err := s.validate.Struct(input); err != nil {
+		return nil, invalid("query must be between 2 and 100 characters", err)
+	}
+
+	limit := input.Limit
+	switch {
+	case limit < 0:
+		return nil, fmt.Errorf("%w: limit must be positive", ErrInvalidInput)
+	case limit == 0:
+		limit = DefaultSearchLimit
+	case limit > MaxSearchLimit:
+		limit = MaxSearchLimit
+	}
+
+	return s.repo.Search(ctx, SearchQuery{
+		Term:   strings.ToLower(input.Query),
+		Digits: phoneDigits(input.Query),
+		Limit:  limit,
+	})
+}
+
+// normalizePhone returns the E.164 form and the trimmed raw form of an already validated phone.
+// An empty phone stays empty.
+func (s *Service) normalizePhone(phone string) (e164, raw string) {
+	raw = strings.TrimSpace(phone)
+	if raw == "" {
+		return "", ""
+	}
+	e164, _ = validation.NormalizePhone(raw, s.phoneRegion) // cannot fail after phone_e164 passed
+	return e164, raw
+}
+
+// phoneDigits returns the digits of query when it looks like a phone fragment
+// (at least three digits and nothing but digits and phone punctuation), otherwise "".
+func phoneDigits(query string) string {
+	var digits strings.Builder
+	for _, r := range query {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case strings.ContainsRune("+-() .", r):
+		default:
+			return ""
+		}
+	}
+	if digits.Len() < 3 {
+		return ""
+	}
+	return digits.String()
 }
 
 func (s *Service) GetUserByID(ctx context.Context, id string) (*User, error) {
@@ -64,6 +290,17 @@ func (s *Service) GetUserByID(ctx context.Context, id string) (*User, error) {
 	return s.repo.GetByID(ctx, parsedID)
 }
 
+// GetUserByEmail finds the live user whose email normalizes to the same key as email,
+// so the lookup ignores case and, with provider rules, aliases of the same mailbox.
+func (s *Service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	email = CleanEmail(email)
+	if err := s.validate.Var(email, "required,email"); err != nil {
+		return nil, fmt.Errorf("%w: email must be a valid email address", ErrInvalidInput)
+	}
+
+	return s.repo.GetByEmail(ctx, s.emails.Normalize(email))
+}
+
 func (s *Service) UpdateUser(ctx context.Context, id string, input UpdateInput) (*User, error) {
 	parsedID, err := ParseUUID(id)
 	if err != nil {
@@ -75,18 +312,90 @@ func (s *Service) UpdateUser(ctx context.Context, id string, input UpdateInput)
 		return nil, fmt.Errorf("%w: at least one field is required", ErrInvalidInput)
 	}
 
+	if input.Email != nil {
+		email := CleanEmail(*input.Email)
+		normalized := s.emails.Normalize(email)
+		input.Email, input.EmailNormalized = &email, &normalized
+	}
 	if err := s.validate.Struct(input); err != nil {
-		return nil, fmt.Errorf("%w: invalid update payload", ErrInvalidInput)
+		return nil, invalid("invalid update payload", err)
+	}
+	if input.Phone != nil {
+		phone, raw := s.normalizePhone(*input.Phone)
+		input.Phone, input.PhoneRaw = &phone, &raw
 	}
 
 	return s.repo.Update(ctx, parsedID, input)
 }
 
-func (s *Service) DeleteUser(ctx context.Context, id string) error {
+// DeleteUser soft-deletes the user. A non-nil expectedVersion guards against deleting a newer version.
+func (s *Service) DeleteUser(ctx context.Context, id string, expectedVersion *int32) error {
 	parsedID, err := ParseUUID(id)
 	if err != nil {
 		return fmt.Errorf("%w: id must be valid uuid", ErrInvalidInput)
 	}
+	if expectedVersion != nil && *expectedVersion <= 0 {
+		return fmt.Errorf("%w: expectedVersion must be positive", ErrInvalidInput)
+	}
+
+	return s.repo.Delete(ctx, parsedID, expectedVersion)
+}
+
+func (s *Service) RestoreUser(ctx context.Context, id string) (*User, error) {
+	parsedID, err := ParseUUID(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be valid uuid", ErrInvalidInput)
+	}
+
+	return s.repo.Restore(ctx, parsedID)
+}
+
+// UserHistory returns the audit entries of the user, newest first. Deleted users keep their
+// history, so it is available for them too.
+func (s *Service) UserHistory(ctx context.Context, input HistoryInput) (*HistoryResult, error) {
+	parsedID, err := ParseUUID(input.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id must be valid uuid", ErrInvalidInput)
+	}
+
+	limit := input.Limit
+	switch {
+	case limit < 0:
+		return nil, fmt.Errorf("%w: limit must be positive", ErrInvalidInput)
+	case limit == 0:
+		limit = DefaultListLimit
+	case limit > MaxListLimit:
+		limit = MaxListLimit
+	}
+
+	// fetch one extra entry to know whether another page exists
+	query := HistoryQuery{UserID: parsedID, Limit: limit + 1}
+	if input.Cursor != "" {
+		beforeID, err := strconv.ParseInt(input.Cursor, 10, 64)
+		if err != nil || beforeID <= 0 {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidInput)
+		}
+		query.BeforeID = beforeID
+	}
+
+	entries, err := s.repo.History(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &HistoryResult{Entries: entries}
+	if len(entries) > int(limit) {
+		result.Entries = entries[:limit]
+		result.NextCursor = strconv.FormatInt(result.Entries[limit-1].ID, 10)
+	}
+	return result, nil
+}
+
+// PurgeDeletedUsers hard-deletes users that have been soft-deleted for longer than retention.
+func (s *Service) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, fmt.Errorf("%w: retention must be positive", ErrInvalidInput)
+	}
 
-	return s.repo.Delete(ctx, parsedID)
+	return s.repo.Purge(ctx, time.Now().Add(-retention))
 }
@@ -0,0 +1,231 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+
+	"github.com/google/uuid"
+)
+
+// bulkRepository records BulkCreate calls; the other Repository methods are not used by these tests.
+type bulkRepository struct {
+	Repository
+	inputs []CreateInput
+	atomic bool
+	taken  string // email reported as already taken
+}
+
+func (r *bulkRepository) BulkCreate(ctx context.Context, inputs []CreateInput, atomic bool) ([]BulkRowResult, error) {
+	r.inputs, r.atomic = inputs, atomic
+	results := make([]BulkRowResult, len(inputs))
+	for i, input := range inputs {
+		if input.Email == r.taken {
+			results[i].Err = ErrEmailAlreadyExists
+			continue
+		}
+		results[i].User = &User{UserID: uuid.NewString(), Email: input.Email, Status: input.Status, CreatedAt: time.Now()}
+	}
+	return results, nil
+}
+
+func bulkRows() []CreateInput {
+	return []CreateInput{
+		{FirstName: "John", LastName: "Doe", Email: "john@example.com"},
+		{FirstName: "J", LastName: "Doe", Email: "not-an-email"},
+		{FirstName: "Jane", LastName: "Doe", Email: "john@example.com"},
+		{FirstName: "Jim", LastName: "Doe", Email: "jim@example.com", Status: StatusInactive},
+	}
+}
+
+func TestBulkCreateUsersAtomicCreatesNothingOnInvalidRow(t *testing.T) {
+	repo := &bulkRepository{}
+	result, err := NewService(repo, Config{}).BulkCreateUsers(context.Background(), BulkCreateInput{Users: bulkRows()})
+	if err != nil {
+		t.Fatalf("bulk create: %v", err)
+	}
+
+	if repo.inputs != nil {
+		t.Fatalf("expected no repository call, got %d rows", len(repo.inputs))
+	}
+	if result.Mode != BulkModeAtomic || result.Created != 0 || result.Failed != 4 {
+		t.Fatalf("unexpected summary %+v", result)
+	}
+	for i, want := range []error{ErrBulkAborted, ErrInvalidInput, ErrEmailAlreadyExists, ErrBulkAborted} {
+		if row := result.Rows[i]; row.Row != i+1 || !errors.Is(row.Err, want) {
+			t.Fatalf("row %d: expected %v, got %+v", i+1, want, row)
+		}
+	}
+	if msg := result.Rows[1].Err.Error(); msg != "invalid input: bad value for firstName, email" {
+		t.Fatalf("unexpected validation message %q", msg)
+	}
+	var validationErr *ValidationError
+	if !errors.As(result.Rows[1].Err, &validationErr) || len(validationErr.Violations) != 2 || validationErr.Violations[0].Rule != "min" {
+		t.Fatalf("expected min and email violations, got %+v", result.Rows[1].Err)
+	}
+}
+
+func TestBulkCreateUsersPartialCreatesValidRows(t *testing.T) {
+	repo := &bulkRepository{taken: "jim@example.com"}
+	result, err := NewService(repo, Config{}).BulkCreateUsers(context.Background(), BulkCreateInput{Mode: BulkModePartial, Users: bulkRows()})
+	if err != nil {
+		t.Fatalf("bulk create: %v", err)
+	}
+
+	if repo.atomic || len(repo.inputs) != 2 || repo.inputs[0].Status != StatusActive {
+		t.Fatalf("unexpected repository call atomic=%v inputs=%+v", repo.atomic, repo.inputs)
+	}
+	if result.Created != 1 || result.Failed != 3 {
+		t.Fatalf("unexpected summary %+v", result)
+	}
+	if result.Rows[0].User == nil || result.Rows[0].User.Email != "john@example.com" {
+		t.Fatalf("expected row 1 created, got %+v", result.Rows[0])
+	}
+	if !errors.Is(result.Rows[3].Err, ErrEmailAlreadyExists) {
+		t.Fatalf("expected row 4 to report the taken email, got %+v", result.Rows[3])
+	}
+}
+
+func TestBulkCreateUsersDetectsEmailsDifferingInCase(t *testing.T) {
+	repo := &bulkRepository{}
+	rows := []CreateInput{
+		{FirstName: "John", LastName: "Doe", Email: " John@Example.COM "},
+		{FirstName: "Jane", LastName: "Doe", Email: "john@example.com"},
+	}
+	result, err := NewService(repo, Config{}).BulkCreateUsers(context.Background(), BulkCreateInput{Mode: BulkModePartial, Users: rows})
+	if err != nil {
+		t.Fatalf("bulk create: %v", err)
+	}
+
+	if len(repo.inputs) != 1 || repo.inputs[0].Email != "John@example.com" || repo.inputs[0].EmailNormalized != "john@example.com" {
+		t.Fatalf("unexpected repository inputs %+v", repo.inputs)
+	}
+	if !errors.Is(result.Rows[1].Err, ErrEmailAlreadyExists) {
+		t.Fatalf("expected row 2 to duplicate row 1, got %+v", result.Rows[1])
+	}
+}
+
+func TestBulkCreateUsersNormalizesPhones(t *testing.T) {
+	repo := &bulkRepository{}
+	rows := []CreateInput{
+		{FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: " 020 7946 0958"},
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Phone: "555-1234"},
+	}
+	result, err := NewService(repo, Config{PhoneRegion: "GB"}).BulkCreateUsers(context.Background(), BulkCreateInput{Mode: BulkModePartial, Users: rows})
+	if err != nil {
+		t.Fatalf("bulk create: %v", err)
+	}
+
+	if len(repo.inputs) != 1 || repo.inputs[0].Phone != "+442079460958" || repo.inputs[0].PhoneRaw != "020 7946 0958" {
+		t.Fatalf("expected the GB number stored as E.164 with its raw form, got %+v", repo.inputs)
+	}
+	var validationErr *ValidationError
+	if !errors.As(result.Rows[1].Err, &validationErr) || validationErr.Violations[0].Rule != "phone_e164" {
+		t.Fatalf("expected a seven-digit number to fail in region GB, got %+v", result.Rows[1])
+	}
+}
+
+func TestBulkCreateUsersRejectsRequest(t *testing.T) {
+	service := NewService(&bulkRepository{}, Config{})
+	for _, input := range []BulkCreateInput{
+		{},
+		{Mode: "best-effort", Users: bulkRows()},
+		{Users: make([]CreateInput, MaxBulkCreateRows+1)},
+	} {
+		if _, err := service.BulkCreateUsers(context.Background(), input); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("mode %q with %d rows: expected ErrInvalidInput, got %v", input.Mode, len(input.Users), err)
+		}
+	}
+}
+
+// emailRepository answers GetByEmail for a single stored user.
+type emailRepository struct {
+	Repository
+	user *User
+	key  string // the normalized email of user
+}
+
+func (r *emailRepository) GetByEmail(ctx context.Context, emailNormalized string) (*User, error) {
+	if emailNormalized != r.key {
+		return nil, ErrUserNotFound
+	}
+	return r.user, nil
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	repo := &emailRepository{user: &User{Email: "J.Doe@gmail.com"}, key: "jdoe@gmail.com"}
+	service := NewService(repo, Config{Emails: EmailNormalizer{ProviderRules: true}})
+
+	if got, err := service.GetUserByEmail(context.Background(), " JDoe+shop@GoogleMail.com"); err != nil || got != repo.user {
+		t.Fatalf("expected the stored user, got %+v, %v", got, err)
+	}
+	if _, err := service.GetUserByEmail(context.Background(), "someone@gmail.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := service.GetUserByEmail(context.Background(), "not-an-email"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestCreateUserReportsViolations(t *testing.T) {
+	_, err := NewService(&bulkRepository{}, Config{}).CreateUser(context.Background(), CreateInput{FirstName: "John", LastName: "Doe", Email: "john@example", Status: "Gone"})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	want := []contract.FieldViolation{{Field: "email", Rule: "email"}, {Field: "status", Rule: "oneof", Param: "Active Inactive"}}
+	if !reflect.DeepEqual(validationErr.Violations, want) {
+		t.Fatalf("expected %+v, got %+v", want, validationErr.Violations)
+	}
+}
+
+// historyRepository serves a fixed history, newest first, honouring the page size and BeforeID.
+type historyRepository struct {
+	Repository
+	entries []AuditEntry
+	queries []HistoryQuery
+}
+
+func (r *historyRepository) History(ctx context.Context, query HistoryQuery) ([]AuditEntry, error) {
+	r.queries = append(r.queries, query)
+	var out []AuditEntry
+	for _, entry := range r.entries {
+		if (query.BeforeID == 0 || entry.ID < query.BeforeID) && len(out) < int(query.Limit) {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+func TestUserHistoryPages(t *testing.T) {
+	repo := &historyRepository{entries: []AuditEntry{{ID: 9}, {ID: 7}, {ID: 4}}}
+	service := NewService(repo, Config{})
+	id := uuid.NewString()
+
+	first, err := service.UserHistory(context.Background(), HistoryInput{ID: id, Limit: 2})
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(first.Entries) != 2 || first.NextCursor != "7" || repo.queries[0].Limit != 3 {
+		t.Fatalf("unexpected first page %+v (query %+v)", first, repo.queries[0])
+	}
+
+	second, err := service.UserHistory(context.Background(), HistoryInput{ID: id, Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(second.Entries) != 1 || second.Entries[0].ID != 4 || second.NextCursor != "" {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+
+	for _, input := range []HistoryInput{{ID: "nope"}, {ID: id, Limit: -1}, {ID: id, Cursor: "abc"}, {ID: id, Cursor: "-3"}} {
+		if _, err := service.UserHistory(context.Background(), input); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%+v: expected ErrInvalidInput, got %v", input, err)
+		}
+	}
+}
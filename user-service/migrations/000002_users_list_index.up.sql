@@ -0,0 +1,2 @@
+-- supports keyset pagination over (created_at, user_id) for ListUsers
+CREATE INDEX IF NOT EXISTS users_created_at_user_id_idx ON users (created_at DESC, user_id DESC);
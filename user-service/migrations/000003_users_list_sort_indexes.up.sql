@@ -0,0 +1,3 @@
+-- keyset pagination for the name sorts offered by ListUsers
+CREATE INDEX IF NOT EXISTS users_first_name_user_id_idx ON users (first_name, user_id);
+CREATE INDEX IF NOT EXISTS users_last_name_user_id_idx ON users (last_name, user_id);
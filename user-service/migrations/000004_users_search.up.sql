@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm; -- trigram similarity and gin_trgm_ops for fuzzy user search
+
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx ON users USING gin ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING gin (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_phone_digits_trgm_idx ON users USING gin ((regexp_replace(phone, '[^0-9]', '', 'g')) gin_trgm_ops);
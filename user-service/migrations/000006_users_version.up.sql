@@ -0,0 +1,2 @@
+-- row version for optimistic concurrency; bumped by every UPDATE of the row
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+-- responses to mutating commands, keyed by the caller's idempotency key, so a retried
+-- command gets the original response instead of running twice. response is NULL while
+-- the first request is still being processed.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    request_hash TEXT NOT NULL,
+    response JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
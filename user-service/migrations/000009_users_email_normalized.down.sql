@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_email_normalized_live_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_live_key ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS email_normalized;
@@ -0,0 +1,32 @@
+-- case-insensitive uniqueness: the service writes the normalized form of every email here
+-- (see user.NormalizeEmail); existing rows get the plain lowercase form
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_normalized VARCHAR(255);
+UPDATE users SET email_normalized = lower(btrim(email)) WHERE email_normalized IS NULL;
+ALTER TABLE users ALTER COLUMN email_normalized SET NOT NULL;
+
+-- live users whose emails only differ in case cannot be indexed; name them instead of
+-- letting CREATE UNIQUE INDEX fail with a bare duplicate key error
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(format('%s: %s', email_normalized, user_ids), E'\n' ORDER BY email_normalized)
+    INTO collisions
+    FROM (
+        SELECT email_normalized, string_agg(user_id::text, ', ' ORDER BY created_at) AS user_ids
+        FROM users
+        WHERE deleted_at IS NULL
+        GROUP BY email_normalized
+        HAVING count(*) > 1
+    ) AS duplicates;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'live users share an email once it is lowercased'
+            USING DETAIL = collisions,
+                HINT = 'merge or soft-delete all but one user of each email, then run the migration again';
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS users_email_live_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_normalized_live_key ON users (email_normalized) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+-- phone is VARCHAR(20), so longer raw input keeps its E.164 form
+UPDATE users SET phone = phone_raw WHERE phone_raw IS NOT NULL AND length(phone_raw) <= 20;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_raw;
@@ -0,0 +1,12 @@
+-- phone holds the E.164 form the service normalizes to; phone_raw keeps what the user entered
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_raw VARCHAR(50);
+UPDATE users SET phone_raw = phone WHERE phone IS NOT NULL AND phone_raw IS NULL;
+
+-- numbers entered with a country code normalize without knowing a region. National numbers
+-- keep their old form until the user is next updated, as do ones with a trunk digit in
+-- parentheses, e.g. +44 (0)20, which E.164 drops rather than keeps
+UPDATE users
+SET phone = '+' || regexp_replace(phone, '[^0-9]', '', 'g')
+WHERE phone ~ '^\s*\+[0-9 ().-]+$'
+    AND phone !~ '\(\s*0\s*\)'
+    AND length(regexp_replace(phone, '[^0-9]', '', 'g')) BETWEEN 8 AND 15;
@@ -0,0 +1,14 @@
+-- one row per user mutation, written in the same transaction as the change.
+-- user_id has no foreign key so the history outlives the purge of the user.
+CREATE TABLE IF NOT EXISTS user_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor_id VARCHAR(255) NOT NULL DEFAULT '',
+    source VARCHAR(20) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    changes JSONB NOT NULL, -- field -> {"old": ..., "new": ...}
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_audit (user_id, id);
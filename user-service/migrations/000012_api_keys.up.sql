@@ -0,0 +1,16 @@
+-- credentials of machine clients. Only a SHA-256 of the key's secret is stored; the full key
+-- is shown once, when issued. A rotated key points at the key it replaced.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id UUID PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    secret_hash BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    rotated_from UUID REFERENCES api_keys (key_id)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_created_at_idx ON api_keys (created_at DESC);
@@ -0,0 +1,18 @@
+-- failed logins, counted per account and per source address. scope is user (subject is the
+-- user id), email (an address no user has, so unknown emails lock like real ones) or ip (an
+-- IPv4 address or IPv6 /64). user_id is set for user rows, which announce their locks as events;
+-- unlock_pending marks a lock whose end has not been announced yet.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    scope TEXT NOT NULL CHECK (scope IN ('user', 'email', 'ip')),
+    subject TEXT NOT NULL,
+    user_id UUID REFERENCES users (user_id) ON DELETE CASCADE,
+    failures INTEGER NOT NULL DEFAULT 0,
+    lockouts INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    unlock_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (scope, subject)
+);
+
+CREATE INDEX IF NOT EXISTS login_throttles_unlock_pending_idx ON login_throttles (locked_until) WHERE unlock_pending;
+CREATE INDEX IF NOT EXISTS login_throttles_last_failure_at_idx ON login_throttles (last_failure_at);
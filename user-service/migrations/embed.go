@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations so the binary does not depend on its working directory.
+package migrations
+
+import "embed"
+
+// FS holds every NNNNNN_name.up.sql / NNNNNN_name.down.sql pair.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,61 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAuthorizeVerifiesSignedActor(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	authorizer, err := NewAuthorizer(DefaultPolicy(), testKey)
+	if err != nil {
+		t.Fatalf("new authorizer: %v", err)
+	}
+	authorizer.now = func() time.Time { return now }
+
+	signed := SignActor(testKey, contract.Actor{ID: "u1", Source: contract.SourceREST, Roles: []string{"user"}}, "req-1", now)
+	if err := authorizer.Authorize(&signed, "req-1", PermUsersWrite, "u1"); err != nil {
+		t.Fatalf("expected own update to be allowed, got %v", err)
+	}
+
+	escalated := signed
+	escalated.Roles = []string{"admin"}
+	scoped := SignActor(testKey, contract.Actor{ID: "u1", Source: contract.SourceREST, Scopes: []string{"users:delete"}}, "req-1", now)
+	posing := scoped
+	posing.APIKey = true // the flag is signed, so scopes cannot be turned into grants
+	forged := SignActor([]byte("another-key-another-key-another-k"), signed, "req-1", now)
+	stale := SignActor(testKey, signed, "req-1", now.Add(-10*time.Minute))
+	denied := []struct {
+		name       string
+		actor      *contract.Actor
+		requestID  string
+		permission Permission
+		userID     string
+	}{
+		{"missing actor", nil, "req-1", PermUsersRead, "u1"},
+		{"unsigned actor", &contract.Actor{ID: "u1", Roles: []string{"admin"}}, "req-1", PermUsersRead, "u1"},
+		{"other user's record", &signed, "req-1", PermUsersWrite, "u2"},
+		{"escalated roles", &escalated, "req-1", PermUsersDelete, "u1"},
+		{"token scopes", &scoped, "req-1", PermUsersDelete, "u2"},
+		{"posing as an API key", &posing, "req-1", PermUsersDelete, "u2"},
+		{"replayed on another request", &signed, "req-2", PermUsersWrite, "u1"},
+		{"wrong key", &forged, "req-1", PermUsersWrite, "u1"},
+		{"expired signature", &stale, "req-1", PermUsersWrite, "u1"},
+	}
+	for _, tc := range denied {
+		if err := authorizer.Authorize(tc.actor, tc.requestID, tc.permission, tc.userID); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("%s: expected ErrForbidden, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestNewAuthorizerRejectsShortKey(t *testing.T) {
+	if _, err := NewAuthorizer(DefaultPolicy(), []byte("short")); err == nil {
+		t.Fatalf("expected a short signing key to be rejected")
+	}
+}
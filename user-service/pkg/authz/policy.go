@@ -0,0 +1,161 @@
+// Package authz decides which user operations a caller may perform. The gateway checks each
+// request against the policy and signs the caller into the command it sends; the user-service
+// verifies that signature and checks the policy again, so NATS callers cannot skip the gateway.
+package authz
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"user-service/pkg/contract"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Permission string
+
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersWrite  Permission = "users:write"
+	PermUsersDelete Permission = "users:delete"
+	PermSelfRead    Permission = "self:read"
+	PermSelfWrite   Permission = "self:write"
+	PermAPIKeys     Permission = "apikeys:manage"
+	PermUsersRoles  Permission = "users:roles"
+)
+
+// selfPermissions grant a permission on the caller's own user only.
+var selfPermissions = map[Permission]Permission{
+	PermUsersRead:  PermSelfRead,
+	PermUsersWrite: PermSelfWrite,
+}
+
+var knownPermissions = []Permission{PermUsersRead, PermUsersWrite, PermUsersDelete, PermSelfRead, PermSelfWrite, PermAPIKeys, PermUsersRoles}
+
+// IsPermission reports whether name is a permission the policy knows.
+func IsPermission(name string) bool {
+	return slices.Contains(knownPermissions, Permission(name))
+}
+
+var ErrForbidden = errors.New("forbidden")
+
+//go:embed default_policy.yaml
+var defaultPolicy []byte
+
+// Policy maps roles to the permissions they grant.
+type Policy struct {
+	roles map[string][]Permission
+}
+
+// DefaultPolicy is the built-in policy: admin, support (read only) and user (own record only).
+func DefaultPolicy() *Policy {
+	policy, err := ParsePolicy(defaultPolicy)
+	if err != nil {
+		panic(fmt.Sprintf("authz: invalid default policy: %v", err))
+	}
+	return policy
+}
+
+// LoadPolicy reads a policy file in the format of default_policy.yaml.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a YAML policy. Unknown permissions are an error, so a typo cannot
+// silently take a permission away.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var file struct {
+		Roles map[string][]Permission `yaml:"roles"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if len(file.Roles) == 0 {
+		return nil, errors.New("policy defines no roles")
+	}
+	for role, permissions := range file.Roles {
+		for _, permission := range permissions {
+			if !slices.Contains(knownPermissions, permission) {
+				return nil, fmt.Errorf("role %s: unknown permission %q", role, permission)
+			}
+		}
+	}
+	return &Policy{roles: file.Roles}, nil
+}
+
+// HasRole reports whether the policy defines role.
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// CanGrant reports whether the actor holds every permission role grants, so that assigning
+// roles cannot hand out more than the actor has. Holding a permission on all users covers its
+// self permission. Unknown roles grant nothing and cannot be granted.
+func (p *Policy) CanGrant(actor contract.Actor, role string) bool {
+	permissions, ok := p.roles[role]
+	if !ok {
+		return false
+	}
+	for _, permission := range permissions {
+		if !p.Holds(actor, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// Holds reports whether the actor holds permission itself, so may pass it on, e.g. as a scope
+// of an API key it issues. Holding a permission on all users covers its self permission.
+func (p *Policy) Holds(actor contract.Actor, permission Permission) bool {
+	return p.Allows(actor, permission, "") || p.Allows(actor, allUsersPermission(permission), "")
+}
+
+// allUsersPermission returns the permission on all users that self permission narrows, or
+// permission itself when it is not a self permission.
+func allUsersPermission(permission Permission) Permission {
+	for all, self := range selfPermissions {
+		if self == permission {
+			return all
+		}
+	}
+	return permission
+}
+
+// Allows reports whether the actor may use permission on the user userID. An API key's scopes
+// are the permissions it holds. Anyone else holds what their roles grant, narrowed to their
+// scopes when these name any permission; other scopes, such as openid, are ignored. An empty
+// userID means an operation on no particular user, such as a listing, which self permissions
+// never cover.
+func (p *Policy) Allows(actor contract.Actor, permission Permission, userID string) bool {
+	self, hasSelf := selfPermissions[permission]
+	own := hasSelf && userID != "" && userID == actor.ID
+	grants := func(granted []Permission) bool {
+		return slices.Contains(granted, permission) || (own && slices.Contains(granted, self))
+	}
+	var scopes []Permission
+	for _, scope := range actor.Scopes {
+		if IsPermission(scope) {
+			scopes = append(scopes, Permission(scope))
+		}
+	}
+	if actor.APIKey {
+		return grants(scopes)
+	}
+	if len(scopes) > 0 && !grants(scopes) {
+		return false
+	}
+	for _, role := range actor.Roles {
+		if grants(p.roles[role]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package authz
+
+import (
+	"strings"
+	"testing"
+
+	"user-service/pkg/contract"
+)
+
+func TestDefaultPolicyRoles(t *testing.T) {
+	policy := DefaultPolicy()
+	cases := []struct {
+		name       string
+		roles      []string
+		permission Permission
+		userID     string
+		want       bool
+	}{
+		{"admin deletes", []string{"admin"}, PermUsersDelete, "u2", true},
+		{"support reads", []string{"support"}, PermUsersRead, "u2", true},
+		{"support cannot delete", []string{"support"}, PermUsersDelete, "u2", false},
+		{"support cannot write", []string{"support"}, PermUsersWrite, "u2", false},
+		{"user edits own record", []string{"user"}, PermUsersWrite, "u1", true},
+		{"user reads own record", []string{"user"}, PermUsersRead, "u1", true},
+		{"user cannot edit others", []string{"user"}, PermUsersWrite, "u2", false},
+		{"user cannot list", []string{"user"}, PermUsersRead, "", false},
+		{"user cannot delete self", []string{"user"}, PermUsersDelete, "u1", false},
+		{"roles combine", []string{"user", "support"}, PermUsersRead, "u2", true},
+		{"unknown role", []string{"root"}, PermUsersRead, "u2", false},
+		{"no roles", nil, PermUsersRead, "u1", false},
+	}
+	for _, tc := range cases {
+		if got := policy.Allows(contract.Actor{ID: "u1", Roles: tc.roles}, tc.permission, tc.userID); got != tc.want {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestScopesGrantPermissions(t *testing.T) {
+	policy := DefaultPolicy()
+	batch := contract.Actor{ID: "apikey:1", Scopes: []string{"users:read"}, APIKey: true}
+
+	if !policy.Allows(batch, PermUsersRead, "") {
+		t.Fatalf("expected the users:read scope to allow listing")
+	}
+	if policy.Allows(batch, PermUsersWrite, "") {
+		t.Fatalf("expected a read-only scope to deny writes")
+	}
+}
+
+func TestTokenScopesOnlyNarrowRoles(t *testing.T) {
+	policy := DefaultPolicy()
+	// an identity provider's token cannot grant itself permissions through its scope claim
+	user := contract.Actor{ID: "u1", Roles: []string{"user"}, Scopes: []string{"users:delete", "apikeys:manage"}}
+	if policy.Allows(user, PermUsersDelete, "u2") || policy.Allows(user, PermAPIKeys, "") {
+		t.Fatalf("expected token scopes not to grant permissions the roles do not")
+	}
+
+	readOnly := contract.Actor{ID: "admin-1", Roles: []string{"admin"}, Scopes: []string{"openid", "users:read"}}
+	if !policy.Allows(readOnly, PermUsersRead, "u2") {
+		t.Fatalf("expected a scope the roles grant to be allowed")
+	}
+	if policy.Allows(readOnly, PermUsersDelete, "u2") {
+		t.Fatalf("expected scopes to narrow what the roles grant")
+	}
+	oidc := contract.Actor{ID: "admin-1", Roles: []string{"admin"}, Scopes: []string{"openid", "email"}}
+	if !policy.Allows(oidc, PermUsersDelete, "u2") {
+		t.Fatalf("expected scopes naming no permission to leave the roles alone")
+	}
+}
+
+func TestCanGrantOnlyRolesWithinTheActorsPermissions(t *testing.T) {
+	policy := DefaultPolicy()
+	admin := contract.Actor{ID: "admin-1", Roles: []string{"admin"}}
+	manager := contract.Actor{ID: "apikey:1", Scopes: []string{"users:read", "users:write", "users:roles"}, APIKey: true}
+
+	for _, role := range []string{"admin", "support", "user"} {
+		if !policy.CanGrant(admin, role) {
+			t.Fatalf("expected an admin to grant %s", role)
+		}
+	}
+	// users:read and users:write cover the user role's self permissions
+	if !policy.CanGrant(manager, "user") || !policy.CanGrant(manager, "support") {
+		t.Fatalf("expected roles within the actor's permissions to be grantable")
+	}
+	if policy.CanGrant(manager, "admin") {
+		t.Fatalf("expected admin, which grants users:delete, not to be grantable without it")
+	}
+	if policy.CanGrant(admin, "root") {
+		t.Fatalf("expected an unknown role not to be grantable")
+	}
+}
+
+func TestParsePolicyRejectsUnknownPermission(t *testing.T) {
+	_, err := ParsePolicy([]byte("roles:\n  support: [users:raed]\n"))
+	if err == nil || !strings.Contains(err.Error(), "users:raed") {
+		t.Fatalf("expected an unknown permission error, got %v", err)
+	}
+	if _, err := ParsePolicy([]byte("roles: {}\n")); err == nil {
+		t.Fatalf("expected an error for a policy without roles")
+	}
+}
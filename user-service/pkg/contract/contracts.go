@@ -3,25 +3,111 @@ package contract
 import "encoding/json"
 
 const (
-	SubjectUserCommandCreate = "user.command.create"
-	SubjectUserCommandList   = "user.command.list"
-	SubjectUserCommandGet    = "user.command.get"
-	SubjectUserCommandUpdate = "user.command.update"
-	SubjectUserCommandDelete = "user.command.delete"
-
-	SubjectUserEventCreated = "user.event.created"
-	SubjectUserEventUpdated = "user.event.updated"
-	SubjectUserEventDeleted = "user.event.deleted"
+	SubjectUserCommandCreate     = "user.command.create"
+	SubjectUserCommandBulkCreate = "user.command.bulk_create"
+	SubjectUserCommandList       = "user.command.list"
+	SubjectUserCommandGet        = "user.command.get"
+	SubjectUserCommandGetByEmail = "user.command.get_by_email"
+	SubjectUserCommandUpdate     = "user.command.update"
+	SubjectUserCommandDelete     = "user.command.delete"
+	SubjectUserCommandSearch     = "user.command.search"
+	SubjectUserCommandRestore    = "user.command.restore"
+	SubjectUserCommandHistory    = "user.command.history"
+
+	SubjectAPIKeyCommandIssue   = "user.command.issue_api_key"
+	SubjectAPIKeyCommandList    = "user.command.list_api_keys"
+	SubjectAPIKeyCommandRotate  = "user.command.rotate_api_key"
+	SubjectAPIKeyCommandRevoke  = "user.command.revoke_api_key"
+	SubjectAPIKeyCommandResolve = "user.command.resolve_api_key"
+	// SubjectAPIKeyCommandTouch reports key uses; it is published without expecting a reply.
+	SubjectAPIKeyCommandTouch = "user.command.touch_api_keys"
+
+	SubjectCredentialCommandSetPassword  = "user.command.set_password"
+	SubjectCredentialCommandAuthenticate = "user.command.authenticate"
+	SubjectSessionCommandRefresh         = "user.command.refresh_session"
+	SubjectSessionCommandRevoke          = "user.command.revoke_session"
+	SubjectCredentialCommandUnlock       = "user.command.unlock"
+
+	SubjectUserEventCreated  = "user.event.created"
+	SubjectUserEventUpdated  = "user.event.updated"
+	SubjectUserEventDeleted  = "user.event.deleted"
+	SubjectUserEventRestored = "user.event.restored"
+	// SubjectUserEventLocked and SubjectUserEventUnlocked announce that too many failed logins
+	// locked an account, and that the lock ended or an admin lifted it.
+	SubjectUserEventLocked   = "user.event.locked"
+	SubjectUserEventUnlocked = "user.event.unlocked"
 )
 
 type CommandRequest[T any] struct { // T is a generic type parameter that allows CommandRequest to be used with any data type
 	RequestID string `json:"requestId"`
-	Data      T      `json:"data"`
+	// IdempotencyKey is optional on mutating commands; a repeated key gets the original response.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// Actor is who issued the command. It is recorded in the user's audit history and,
+	// being signed by the gateway, checked against the access policy.
+	Actor *Actor `json:"actor,omitempty"`
+	Data  T      `json:"data"`
+}
+
+// sources a command can come from.
+const (
+	SourceREST = "rest"
+	SourceWS   = "ws"
+	SourceCLI  = "cli"
+	// SourceGateway marks the gateway acting for itself, e.g. resolving an API key.
+	SourceGateway = "gateway"
+)
+
+// Actor identifies who issued a command, through which front end and with which roles, or
+// for an API key, with which scopes. IssuedAt and Signature are set by authz.SignActor.
+type Actor struct {
+	ID     string   `json:"id,omitempty"`
+	Source string   `json:"source,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	// APIKey marks an API key, whose scopes grant permissions; a token's scopes only narrow
+	// what its roles grant.
+	APIKey    bool   `json:"apiKey,omitempty"`
+	IssuedAt  int64  `json:"issuedAt,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// FieldChange is the value of one field before and after a change; Old is null for a
+// field that was unset, New for one that was cleared.
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
 }
 
+// reasons carried by a CONFLICT CommandError.
+const (
+	ConflictReasonEmailTaken      = "email_taken"
+	ConflictReasonVersionMismatch = "version_mismatch"
+)
+
+// reasons carried by a LOCKED CommandError: whether the account or the address logins come
+// from has too many failed logins.
+const (
+	LockedReasonAccount = "account_locked"
+	LockedReasonSource  = "source_locked"
+)
+
 type CommandError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Reason is a machine-readable refinement of Code, e.g. email_taken for a CONFLICT.
+	Reason string `json:"reason,omitempty"`
+	// Violations lists the fields that failed validation; only set on BAD_REQUEST.
+	Violations []FieldViolation `json:"violations,omitempty"`
+	// RetryAfter is how many seconds until a LOCKED login may be tried again.
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+// FieldViolation is one failed validation rule, e.g. {Field: "age", Rule: "gt", Param: "0"}.
+// Field is the JSON path of the field, with dots for nested objects.
+type FieldViolation struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
 }
 
 type CommandResponse[T any] struct { // T is a generic type parameter that allows CommandResponse to be used with any data type
@@ -35,6 +121,9 @@ type Event[T any] struct { // T is a generic type parameter that allows Event to
 	Type       string `json:"type"`
 	OccurredAt string `json:"occurredAt"`
 	Data       T      `json:"data"`
+	// Changes lists the fields a user.updated event changed, by their JSON name in Data,
+	// with the values before and after; other event types leave it out.
+	Changes map[string]FieldChange `json:"changes,omitempty"`
 }
 
 // marshal JSON payloads for NATS messages
@@ -0,0 +1,71 @@
+// Package eventstream describes the JetStream stream that stores user events,
+// so publishers and consumers agree on its name and subjects.
+package eventstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	StreamName = "USER_EVENTS"
+	// Subjects captures every user.event.* subject.
+	Subjects = "user.event.>"
+
+	DefaultMaxAge          = 7 * 24 * time.Hour
+	DefaultDuplicateWindow = 2 * time.Minute
+)
+
+// Config holds the retention settings of the stream; zero values fall back to the defaults.
+type Config struct {
+	MaxAge          time.Duration // events older than this are discarded
+	DuplicateWindow time.Duration // messages with a repeated ID inside this window are dropped
+}
+
+func (c Config) streamConfig() jetstream.StreamConfig {
+	if c.MaxAge <= 0 {
+		c.MaxAge = DefaultMaxAge
+	}
+	if c.DuplicateWindow <= 0 {
+		c.DuplicateWindow = DefaultDuplicateWindow
+	}
+
+	return jetstream.StreamConfig{
+		Name:       StreamName,
+		Subjects:   []string{Subjects},
+		Storage:    jetstream.FileStorage,
+		Retention:  jetstream.LimitsPolicy,
+		MaxAge:     c.MaxAge,
+		Duplicates: c.DuplicateWindow,
+	}
+}
+
+// Ensure creates the stream or updates it to match cfg. The user-service owns
+// the stream configuration and calls this on startup.
+func Ensure(ctx context.Context, js jetstream.JetStream, cfg Config) (jetstream.Stream, error) {
+	stream, err := js.CreateOrUpdateStream(ctx, cfg.streamConfig())
+	if err != nil {
+		return nil, fmt.Errorf("ensure stream %s: %w", StreamName, err)
+	}
+	return stream, nil
+}
+
+// Open returns the stream, creating it with default settings if the publisher has not yet done so.
+// Consumers use this so they can start before the user-service.
+func Open(ctx context.Context, js jetstream.JetStream) (jetstream.Stream, error) {
+	stream, err := js.Stream(ctx, StreamName)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		stream, err = js.CreateStream(ctx, Config{}.streamConfig())
+		if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) { // created concurrently by another process
+			stream, err = js.Stream(ctx, StreamName)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open stream %s: %w", StreamName, err)
+	}
+	return stream, nil
+}
@@ -0,0 +1,25 @@
+package usersclient
+
+import (
+	"context"
+
+	"user-service/pkg/contract"
+)
+
+type actorCtx struct{}
+
+// WithActor attaches the actor issuing the request to ctx. Every call sends it along: the
+// user-service checks its roles against the access policy and records it in the audit
+// history of the changed users.
+func WithActor(ctx context.Context, actor contract.Actor) context.Context {
+	return context.WithValue(ctx, actorCtx{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or nil.
+func ActorFromContext(ctx context.Context) *contract.Actor {
+	actor, ok := ctx.Value(actorCtx{}).(contract.Actor)
+	if !ok {
+		return nil
+	}
+	return &actor
+}
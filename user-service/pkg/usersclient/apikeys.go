@@ -0,0 +1,152 @@
+package usersclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"user-service/pkg/contract"
+)
+
+// APIKey describes an API key; its secret is only returned once, in IssuedAPIKey.
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Scopes      []string   `json:"scopes"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	RotatedFrom string     `json:"rotatedFrom,omitempty"`
+}
+
+// IssueAPIKeyInput describes a new key. Scopes are permissions such as users:read.
+type IssueAPIKeyInput struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// IssuedAPIKey is a new key with its full value, which cannot be retrieved again.
+type IssuedAPIKey struct {
+	APIKey APIKey `json:"apiKey"`
+	Key    string `json:"key"`
+}
+
+type APIKeyList struct {
+	APIKeys []APIKey `json:"apiKeys"`
+}
+
+type RotateAPIKeyRequest struct {
+	ID           string `json:"id"`
+	GraceSeconds *int64 `json:"graceSeconds,omitempty"`
+}
+
+type ResolveAPIKeyRequest struct {
+	Key string `json:"key"`
+}
+
+type TouchAPIKeysRequest struct {
+	IDs    []string  `json:"ids"`
+	UsedAt time.Time `json:"usedAt"`
+}
+
+// APIKeyClient manages the API keys machine clients authenticate with.
+type APIKeyClient interface {
+	IssueAPIKey(ctx context.Context, input IssueAPIKeyInput) (*IssuedAPIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RotateAPIKey issues a successor of the key; a nil grace keeps the old key working for
+	// the service's default grace period.
+	RotateAPIKey(ctx context.Context, keyID string, grace *time.Duration) (*IssuedAPIKey, error)
+	RevokeAPIKey(ctx context.Context, keyID string) (*APIKey, error)
+	// ResolveAPIKey returns the active key a presented key value belongs to, or ErrNotFound.
+	ResolveAPIKey(ctx context.Context, key string) (*APIKey, error)
+	// TouchAPIKeys reports that the keys were used at usedAt, without waiting for the service.
+	TouchAPIKeys(ctx context.Context, keyIDs []string, usedAt time.Time) error
+}
+
+func (c *NATSClient) IssueAPIKey(ctx context.Context, input IssueAPIKeyInput) (*IssuedAPIKey, error) {
+	req := contract.CommandRequest[IssueAPIKeyInput]{RequestID: newRequestID(), Data: input}
+
+	resp, err := request[IssuedAPIKey](ctx, c, contract.SubjectAPIKeyCommandIssue, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty issue api key response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	req := contract.CommandRequest[struct{}]{RequestID: newRequestID()}
+
+	resp, err := request[APIKeyList](ctx, c, contract.SubjectAPIKeyCommandList, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty list api keys response")
+	}
+	return resp.Data.APIKeys, nil
+}
+
+func (c *NATSClient) RotateAPIKey(ctx context.Context, keyID string, grace *time.Duration) (*IssuedAPIKey, error) {
+	req := contract.CommandRequest[RotateAPIKeyRequest]{RequestID: newRequestID(), Data: RotateAPIKeyRequest{ID: keyID}}
+	if grace != nil {
+		seconds := int64(grace.Seconds())
+		req.Data.GraceSeconds = &seconds
+	}
+
+	resp, err := request[IssuedAPIKey](ctx, c, contract.SubjectAPIKeyCommandRotate, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty rotate api key response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) RevokeAPIKey(ctx context.Context, keyID string) (*APIKey, error) {
+	req := contract.CommandRequest[IDRequest]{RequestID: newRequestID(), Data: IDRequest{ID: keyID}}
+
+	resp, err := request[APIKey](ctx, c, contract.SubjectAPIKeyCommandRevoke, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty revoke api key response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) ResolveAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	req := contract.CommandRequest[ResolveAPIKeyRequest]{RequestID: newRequestID(), Data: ResolveAPIKeyRequest{Key: key}}
+
+	resp, err := request[APIKey](ctx, c, contract.SubjectAPIKeyCommandResolve, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty resolve api key response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) TouchAPIKeys(ctx context.Context, keyIDs []string, usedAt time.Time) error {
+	req := contract.CommandRequest[TouchAPIKeysRequest]{RequestID: newRequestID(), Data: TouchAPIKeysRequest{IDs: keyIDs, UsedAt: usedAt}}
+	attachActor(ctx, c, &req, time.Now())
+
+	data, err := contract.ToJSON(req)
+	if err != nil {
+		return err
+	}
+	if err := c.nc.Publish(contract.SubjectAPIKeyCommandTouch, data); err != nil {
+		slog.Error("rpc publish failed", "subject", contract.SubjectAPIKeyCommandTouch, "request_id", req.RequestID, "error", err)
+		return err
+	}
+	return nil
+}
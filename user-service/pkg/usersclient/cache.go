@@ -1,15 +1,19 @@
 package usersclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"user-service/pkg/contract"
+	"user-service/pkg/eventstream"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 type UserCache struct {
@@ -17,10 +21,44 @@ type UserCache struct {
 	users     sync.Map
 	subsMu    sync.Mutex
 	eventSubs []*nats.Subscription
+
+	// set by UseJetStream; events are then consumed from the stream instead of core subjects.
+	js       jetstream.JetStream
+	durable  string
+	consumer jetstream.ConsumeContext
+
+	handlersMu    sync.RWMutex
+	fieldHandlers map[string][]FieldChangeHandler // by field name, e.g. "status"
 }
 
+// FieldChangeHandler is called with the updated user and the old and new value of the field
+// it was registered for.
+type FieldChangeHandler func(user User, change contract.FieldChange)
+
 func NewUserCache(nc *nats.Conn) *UserCache {
-	return &UserCache{nc: nc}
+	return &UserCache{nc: nc, fieldHandlers: make(map[string][]FieldChangeHandler)}
+}
+
+// OnFieldChange registers handler for user.updated events that change field, named as in
+// the User JSON ("status", "phone", ...). Handlers run on the event delivery goroutine after
+// the cache is updated, in registration order, so they should return quickly.
+func (c *UserCache) OnFieldChange(field string, handler FieldChangeHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.fieldHandlers[field] = append(c.fieldHandlers[field], handler)
+}
+
+// notifyFieldChanges calls the handlers registered for the fields in changes.
+func (c *UserCache) notifyFieldChanges(user User, changes map[string]contract.FieldChange) {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+
+	for field, change := range changes {
+		for _, handler := range c.fieldHandlers[field] {
+			handler(user, change)
+		}
+	}
 }
 
 func (c *UserCache) getCachedUser(userID string) (*User, bool) {
@@ -69,18 +107,37 @@ func (c *UserCache) cacheUsers(users []User, source string) {
 	}
 }
 
+// cacheConsumerInactiveThreshold is how long the server keeps a cache consumer nobody reads.
+// Durable names are per instance, so without it every retired host would leave a consumer
+// behind; an instance back within this time still resumes where it stopped.
+const cacheConsumerInactiveThreshold = 24 * time.Hour
+
+// UseJetStream switches the cache to a durable JetStream consumer. The durable name must be
+// unique per gateway instance, otherwise instances split the events between them.
+func (c *UserCache) UseJetStream(js jetstream.JetStream, durable string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	c.js = js
+	c.durable = durable
+}
+
 func (c *UserCache) SubscribeUserEvents() error {
 	c.subsMu.Lock()
 	defer c.subsMu.Unlock()
 
-	if len(c.eventSubs) > 0 { // already subscribed
+	if len(c.eventSubs) > 0 || c.consumer != nil { // already subscribed
 		return nil
 	}
+	if c.js != nil {
+		return c.consumeUserEventStream()
+	}
 
 	subjects := []string{
 		contract.SubjectUserEventCreated,
 		contract.SubjectUserEventUpdated,
 		contract.SubjectUserEventDeleted,
+		contract.SubjectUserEventRestored,
 	}
 
 	subs := make([]*nats.Subscription, 0, len(subjects)) // create a slice to hold the created subscriptions
@@ -105,10 +162,56 @@ func (c *UserCache) SubscribeUserEvents() error {
 	return nil
 }
 
+// consumeUserEventStream attaches to the durable consumer; the server remembers the last
+// acknowledged sequence, so after a restart delivery resumes where the cache stopped.
+func (c *UserCache) consumeUserEventStream() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := eventstream.Open(ctx, c.js); err != nil {
+		return err
+	}
+
+	consumer, err := c.js.CreateOrUpdateConsumer(ctx, eventstream.StreamName, jetstream.ConsumerConfig{
+		Durable:           c.durable,
+		FilterSubject:     eventstream.Subjects,
+		DeliverPolicy:     jetstream.DeliverNewPolicy, // only applies when the durable is first created
+		AckPolicy:         jetstream.AckExplicitPolicy,
+		InactiveThreshold: cacheConsumerInactiveThreshold,
+	})
+	if err != nil {
+		return fmt.Errorf("create consumer %s: %w", c.durable, err)
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		if err := c.applyCacheEvent(msg.Subject(), msg.Data()); err != nil {
+			slog.Error("cache_event_apply_failed", "subject", msg.Subject(), "error", err)
+			_ = msg.Term() // a malformed event will not parse on redelivery either
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			slog.Error("cache_event_ack_failed", "subject", msg.Subject(), "error", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("consume %s: %w", eventstream.StreamName, err)
+	}
+
+	c.consumer = consumeCtx
+	slog.Info("cache_event_consumer_created", "stream", eventstream.StreamName, "durable", c.durable)
+	return nil
+}
+
 func (c *UserCache) UnsubscribeUserEvents() error {
 	c.subsMu.Lock()
 	defer c.subsMu.Unlock()
 
+	if c.consumer != nil {
+		c.consumer.Stop()
+		c.consumer = nil
+		slog.Info("cache_event_consumer_stopped", "durable", c.durable)
+	}
+
 	var unsubscribeErr error
 	for _, sub := range c.eventSubs {
 		if err := sub.Unsubscribe(); err != nil {
@@ -126,13 +229,16 @@ func (c *UserCache) UnsubscribeUserEvents() error {
 // applies the user event to the local cache based on the event subject and payload.
 func (c *UserCache) applyCacheEvent(subject string, payload []byte) error {
 	switch subject {
-	case contract.SubjectUserEventCreated, contract.SubjectUserEventUpdated:
+	case contract.SubjectUserEventCreated, contract.SubjectUserEventUpdated, contract.SubjectUserEventRestored:
 		event, err := contract.FromJSON[contract.Event[User]](payload)
 		if err != nil {
 			return err
 		}
 		c.setCachedUser(event.Data, "event_"+subject)
 		slog.Info("cache_event_applied", "subject", subject, "event_id", event.EventID, "event_type", event.Type, "user_id", event.Data.UserID)
+		if len(event.Changes) > 0 {
+			c.notifyFieldChanges(event.Data, event.Changes)
+		}
 		return nil
 
 	case contract.SubjectUserEventDeleted:
@@ -48,3 +48,63 @@ func TestDeleteEventRemovesFromCache(t *testing.T) {
 		t.Fatalf("expected cache to be cleared for u-2")
 	}
 }
+
+func TestRestoredEventStoresUser(t *testing.T) {
+	cache := NewUserCache(nil)
+
+	restoredEvent := contract.Event[User]{
+		EventID: "e-2",
+		Type:    "user.restored",
+		Data:    User{UserID: "u-3", FirstName: "Sam"},
+	}
+
+	payload, err := contract.ToJSON(restoredEvent)
+	if err != nil {
+		t.Fatalf("marshal restored event: %v", err)
+	}
+
+	if err := cache.applyCacheEvent(contract.SubjectUserEventRestored, payload); err != nil {
+		t.Fatalf("apply restored event: %v", err)
+	}
+
+	got, ok := cache.getCachedUser("u-3")
+	if !ok || got.FirstName != "Sam" {
+		t.Fatalf("expected restored user u-3 in cache, got %#v", got)
+	}
+}
+
+func TestUpdatedEventCallsFieldHandlers(t *testing.T) {
+	cache := NewUserCache(nil)
+	var statusChanges []contract.FieldChange
+	cache.OnFieldChange("status", func(user User, change contract.FieldChange) {
+		if user.UserID != "u-4" {
+			t.Errorf("unexpected user %+v", user)
+		}
+		statusChanges = append(statusChanges, change)
+	})
+	cache.OnFieldChange("phone", func(user User, change contract.FieldChange) {
+		t.Errorf("unexpected phone change %+v", change)
+	})
+
+	updatedEvent := contract.Event[User]{
+		EventID: "e-3",
+		Type:    "user.updated",
+		Data:    User{UserID: "u-4", Status: "Inactive"},
+		Changes: map[string]contract.FieldChange{"status": {Old: "Active", New: "Inactive"}, "lastName": {Old: "Doe", New: "Roe"}},
+	}
+	payload, err := contract.ToJSON(updatedEvent)
+	if err != nil {
+		t.Fatalf("marshal updated event: %v", err)
+	}
+
+	if err := cache.applyCacheEvent(contract.SubjectUserEventUpdated, payload); err != nil {
+		t.Fatalf("apply updated event: %v", err)
+	}
+
+	if len(statusChanges) != 1 || statusChanges[0] != (contract.FieldChange{Old: "Active", New: "Inactive"}) {
+		t.Fatalf("expected one status change, got %+v", statusChanges)
+	}
+	if got, ok := cache.getCachedUser("u-4"); !ok || got.Status != "Inactive" {
+		t.Fatalf("expected updated user in cache, got %#v", got)
+	}
+}
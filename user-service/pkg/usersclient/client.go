@@ -7,30 +7,48 @@ import (
 	"log/slog"
 	"time"
 
+	"user-service/pkg/authz"
 	"user-service/pkg/contract"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 const defaultTimeout = 5 * time.Second
 
+// bulkTimeoutFactor stretches the request timeout for bulk creates, which insert up to
+// MaxBulkCreateRows users in one transaction.
+const bulkTimeoutFactor = 6
+
 var ErrBadRequest = errors.New("users client bad request")
 var ErrNotFound = errors.New("users client not found")
 var ErrService = errors.New("users client service error")
+var ErrVersionConflict = errors.New("users client version conflict")
+var ErrConflict = errors.New("users client conflict")
+var ErrInProgress = errors.New("users client request in progress")
+var ErrForbidden = errors.New("users client forbidden")
+var ErrUnauthenticated = errors.New("users client unauthenticated")
+var ErrLocked = errors.New("users client locked")
 
 // Client defines the interface for interacting with the user service.
 type Client interface {
 	Create(ctx context.Context, input CreateUserInput) (*User, error)
-	List(ctx context.Context) ([]User, error)
+	BulkCreate(ctx context.Context, input BulkCreateUsersInput) (*BulkCreateReport, error)
+	List(ctx context.Context, input ListUsersInput) (*UserPage, error)
+	Search(ctx context.Context, input SearchUsersInput) ([]SearchResult, error)
 	Get(ctx context.Context, userID string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, userID string, input UpdateUserInput) (*User, error)
-	Delete(ctx context.Context, userID string) error
+	Delete(ctx context.Context, userID string, expectedVersion *int32) error
+	Restore(ctx context.Context, userID string) (*User, error)
+	History(ctx context.Context, userID string, input HistoryInput) (*HistoryPage, error)
 }
 
 type NATSClient struct {
-	nc      *nats.Conn
-	timeout time.Duration
-	cache   *UserCache
+	nc       *nats.Conn
+	timeout  time.Duration
+	cache    *UserCache
+	actorKey []byte // signs the actor of each request when set
 }
 
 func New(nc *nats.Conn, timeout time.Duration) *NATSClient {
@@ -47,8 +65,9 @@ func New(nc *nats.Conn, timeout time.Duration) *NATSClient {
 
 func (c *NATSClient) Create(ctx context.Context, input CreateUserInput) (*User, error) {
 	req := contract.CommandRequest[CreateUserInput]{
-		RequestID: newRequestID(),
-		Data:      input,
+		RequestID:      newRequestID(),
+		IdempotencyKey: IdempotencyKeyFromContext(ctx),
+		Data:           input,
 	}
 
 	resp, err := request[User](ctx, c, contract.SubjectUserCommandCreate, req)
@@ -63,22 +82,72 @@ func (c *NATSClient) Create(ctx context.Context, input CreateUserInput) (*User,
 	return resp.Data, nil
 }
 
-func (c *NATSClient) List(ctx context.Context) ([]User, error) {
-	req := contract.CommandRequest[map[string]any]{
+// BulkCreate creates many users in one command; per-row failures are reported in the
+// result rather than returned as an error.
+func (c *NATSClient) BulkCreate(ctx context.Context, input BulkCreateUsersInput) (*BulkCreateReport, error) {
+	req := contract.CommandRequest[BulkCreateUsersInput]{
+		RequestID:      newRequestID(),
+		IdempotencyKey: IdempotencyKeyFromContext(ctx),
+		Data:           input,
+	}
+
+	resp, err := requestWithTimeout[BulkCreateReport](ctx, c, contract.SubjectUserCommandBulkCreate, req, c.timeout*bulkTimeoutFactor)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty bulk create response")
+	}
+
+	for _, row := range resp.Data.Rows {
+		if row.User != nil {
+			c.cache.setCachedUser(*row.User, "rpc_bulk_create")
+		}
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) List(ctx context.Context, input ListUsersInput) (*UserPage, error) {
+	req := contract.CommandRequest[ListUsersInput]{
 		RequestID: newRequestID(),
-		Data:      map[string]any{},
+		Data:      input,
 	}
 
-	resp, err := request[[]User](ctx, c, contract.SubjectUserCommandList, req)
+	resp, err := request[UserPage](ctx, c, contract.SubjectUserCommandList, req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.Data == nil {
-		return []User{}, nil
+		return &UserPage{Users: []User{}}, nil
+	}
+	if resp.Data.Users == nil {
+		resp.Data.Users = []User{}
 	}
 
-	c.cache.cacheUsers(*resp.Data, "rpc_list")
-	return *resp.Data, nil
+	if !cacheSkipped(ctx) {
+		c.cache.cacheUsers(resp.Data.Users, "rpc_list")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) Search(ctx context.Context, input SearchUsersInput) ([]SearchResult, error) {
+	req := contract.CommandRequest[SearchUsersInput]{
+		RequestID: newRequestID(),
+		Data:      input,
+	}
+
+	resp, err := request[SearchResults](ctx, c, contract.SubjectUserCommandSearch, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil || resp.Data.Results == nil {
+		return []SearchResult{}, nil
+	}
+
+	for _, result := range resp.Data.Results {
+		c.cache.setCachedUser(result.User, "rpc_search")
+	}
+	return resp.Data.Results, nil
 }
 
 func (c *NATSClient) Get(ctx context.Context, userID string) (*User, error) {
@@ -105,9 +174,29 @@ func (c *NATSClient) Get(ctx context.Context, userID string) (*User, error) {
 	return resp.Data, nil
 }
 
+// GetByEmail finds the live user with the given email, ignoring case; ErrNotFound when there is none.
+func (c *NATSClient) GetByEmail(ctx context.Context, email string) (*User, error) {
+	req := contract.CommandRequest[EmailRequest]{
+		RequestID: newRequestID(),
+		Data:      EmailRequest{Email: email},
+	}
+
+	resp, err := request[User](ctx, c, contract.SubjectUserCommandGetByEmail, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty get by email response")
+	}
+
+	c.cache.setCachedUser(*resp.Data, "rpc_get_by_email")
+	return resp.Data, nil
+}
+
 func (c *NATSClient) Update(ctx context.Context, userID string, input UpdateUserInput) (*User, error) {
 	req := contract.CommandRequest[UpdateUserRequest]{
-		RequestID: newRequestID(),
+		RequestID:      newRequestID(),
+		IdempotencyKey: IdempotencyKeyFromContext(ctx),
 		Data: UpdateUserRequest{
 			ID:              userID,
 			UpdateUserInput: input,
@@ -126,10 +215,12 @@ func (c *NATSClient) Update(ctx context.Context, userID string, input UpdateUser
 	return resp.Data, nil
 }
 
-func (c *NATSClient) Delete(ctx context.Context, userID string) error {
-	req := contract.CommandRequest[IDRequest]{
-		RequestID: newRequestID(),
-		Data:      IDRequest{ID: userID},
+// Delete soft-deletes the user; a non-nil expectedVersion fails with ErrVersionConflict on a stale version.
+func (c *NATSClient) Delete(ctx context.Context, userID string, expectedVersion *int32) error {
+	req := contract.CommandRequest[DeleteUserRequest]{
+		RequestID:      newRequestID(),
+		IdempotencyKey: IdempotencyKeyFromContext(ctx),
+		Data:           DeleteUserRequest{ID: userID, ExpectedVersion: expectedVersion},
 	}
 
 	_, err := request[map[string]any](ctx, c, contract.SubjectUserCommandDelete, req)
@@ -139,6 +230,62 @@ func (c *NATSClient) Delete(ctx context.Context, userID string) error {
 	return err
 }
 
+func (c *NATSClient) Restore(ctx context.Context, userID string) (*User, error) {
+	req := contract.CommandRequest[IDRequest]{
+		RequestID: newRequestID(),
+		Data:      IDRequest{ID: userID},
+	}
+
+	resp, err := request[User](ctx, c, contract.SubjectUserCommandRestore, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty restore response")
+	}
+
+	c.cache.setCachedUser(*resp.Data, "rpc_restore")
+	return resp.Data, nil
+}
+
+// History returns a page of the user's audit history, newest first.
+func (c *NATSClient) History(ctx context.Context, userID string, input HistoryInput) (*HistoryPage, error) {
+	req := contract.CommandRequest[HistoryRequest]{
+		RequestID: newRequestID(),
+		Data:      HistoryRequest{ID: userID, HistoryInput: input},
+	}
+
+	resp, err := request[HistoryPage](ctx, c, contract.SubjectUserCommandHistory, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return &HistoryPage{Entries: []AuditEntry{}}, nil
+	}
+	if resp.Data.Entries == nil {
+		resp.Data.Entries = []AuditEntry{}
+	}
+	return resp.Data, nil
+}
+
+// UseJetStream makes SubscribeUserEvents read from the user event stream through the
+// named durable consumer instead of core NATS subjects. Call it before subscribing.
+func (c *NATSClient) UseJetStream(js jetstream.JetStream, durable string) {
+	c.cache.UseJetStream(js, durable)
+}
+
+// SignActors signs the actor sent with each request with key, the signing key shared with the
+// user-service, which rejects commands whose actor is unsigned.
+func (c *NATSClient) SignActors(key []byte) {
+	c.actorKey = key
+}
+
+// OnFieldChange registers handler for updates that change field; see UserCache.OnFieldChange.
+// Handlers only run while subscribed to user events.
+func (c *NATSClient) OnFieldChange(field string, handler FieldChangeHandler) {
+	c.cache.OnFieldChange(field, handler)
+}
+
 func (c *NATSClient) SubscribeUserEvents() error {
 	return c.cache.SubscribeUserEvents()
 }
@@ -149,18 +296,23 @@ func (c *NATSClient) UnsubscribeUserEvents() error {
 
 // send a request and receive a response from the user service via NATS
 func request[T any, R any](ctx context.Context, c *NATSClient, subject string, req contract.CommandRequest[R]) (*contract.CommandResponse[T], error) {
+	return requestWithTimeout[T](ctx, c, subject, req, c.timeout)
+}
+
+func requestWithTimeout[T any, R any](ctx context.Context, c *NATSClient, subject string, req contract.CommandRequest[R], timeout time.Duration) (*contract.CommandResponse[T], error) {
 	start := time.Now()
+	attachActor(ctx, c, &req, start)
 	data, err := contract.ToJSON(req)
 	if err != nil {
 		slog.Error("rpc request marshal failed", "subject", subject, "request_id", req.RequestID, "error", err)
 		return nil, err
 	}
 
-	timeoutCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel() // cancel the context to release resources if the request completes before the timeout
 
 	// send the request and wait for a response from the user service via NATS
-	slog.Info("rpc request start", "subject", subject, "request_id", req.RequestID, "timeout_ms", c.timeout.Milliseconds())
+	slog.Info("rpc request start", "subject", subject, "request_id", req.RequestID, "timeout_ms", timeout.Milliseconds())
 	msg, err := c.nc.RequestWithContext(timeoutCtx, subject, data)
 	if err != nil {
 		slog.Error("rpc request failed", "subject", subject, "request_id", req.RequestID, "duration_ms", time.Since(start).Milliseconds(), "error", err)
@@ -183,17 +335,99 @@ func request[T any, R any](ctx context.Context, c *NATSClient, subject string, r
 	return &resp, nil
 }
 
+// attachActor sends the actor from ctx with req, signed when the client has a signing key.
+func attachActor[R any](ctx context.Context, c *NATSClient, req *contract.CommandRequest[R], now time.Time) {
+	actor := ActorFromContext(ctx)
+	if actor == nil {
+		return
+	}
+	if c.actorKey != nil {
+		*actor = authz.SignActor(c.actorKey, *actor, req.RequestID, now)
+	}
+	req.Actor = actor
+}
+
+// CommandError is an error reply from the user-service. It unwraps to the sentinel for its
+// code (ErrBadRequest, ErrNotFound, ...), so callers can keep using errors.Is.
+type CommandError struct {
+	Code    string
+	Message string
+	// Reason refines Code, e.g. email_taken or version_mismatch for a CONFLICT.
+	Reason string
+	// Violations lists the fields that failed validation on a BAD_REQUEST.
+	Violations []contract.FieldViolation
+	// RetryAfter is how long until a LOCKED login may be tried again.
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *CommandError) Error() string {
+	if e.kind == ErrService {
+		return fmt.Sprintf("%v (%s): %s", e.kind, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%v: %s", e.kind, e.Message)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.kind
+}
+
+// FieldViolations returns the validation violations carried by err, if any.
+func FieldViolations(err error) []contract.FieldViolation {
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.Violations
+	}
+	return nil
+}
+
+// RetryAfter returns how long until the login refused with err may be tried again; 0 when
+// err is not ErrLocked.
+func RetryAfter(err error) time.Duration {
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) && commandErr.kind == ErrLocked {
+		return commandErr.RetryAfter
+	}
+	return 0
+}
+
 func mapCommandError(errResp *contract.CommandError) error {
 	if errResp == nil {
 		return ErrService
 	}
+	return NewCommandError(*errResp)
+}
 
-	switch errResp.Code {
+// NewCommandError builds the error the client returns for an error reply with this code;
+// it is exported so fakes of Client can return realistic errors.
+func NewCommandError(resp contract.CommandError) *CommandError {
+	err := &CommandError{
+		Code:       resp.Code,
+		Message:    resp.Message,
+		Reason:     resp.Reason,
+		Violations: resp.Violations,
+		RetryAfter: time.Duration(resp.RetryAfter) * time.Second,
+	}
+	switch resp.Code {
 	case "BAD_REQUEST":
-		return fmt.Errorf("%w: %s", ErrBadRequest, errResp.Message)
+		err.kind = ErrBadRequest
 	case "NOT_FOUND":
-		return fmt.Errorf("%w: %s", ErrNotFound, errResp.Message)
+		err.kind = ErrNotFound
+	case "CONFLICT":
+		err.kind = ErrVersionConflict // the only conflict older services report, without a reason
+		if resp.Reason == contract.ConflictReasonEmailTaken {
+			err.kind = ErrConflict
+		}
+	case "IN_PROGRESS":
+		err.kind = ErrInProgress
+	case "FORBIDDEN":
+		err.kind = ErrForbidden
+	case "UNAUTHENTICATED":
+		err.kind = ErrUnauthenticated
+	case "LOCKED":
+		err.kind = ErrLocked
 	default:
-		return fmt.Errorf("%w (%s): %s", ErrService, errResp.Code, errResp.Message)
+		err.kind = ErrService
 	}
+	return err
 }
@@ -0,0 +1,70 @@
+package usersclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"user-service/pkg/contract"
+)
+
+func TestMapCommandErrorKeepsSentinelAndViolations(t *testing.T) {
+	err := mapCommandError(&contract.CommandError{
+		Code:       "BAD_REQUEST",
+		Message:    "invalid create payload",
+		Violations: []contract.FieldViolation{{Field: "email", Rule: "email"}},
+	})
+
+	if !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("expected ErrBadRequest, got %v", err)
+	}
+	if err.Error() != "users client bad request: invalid create payload" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	if violations := FieldViolations(err); len(violations) != 1 || violations[0].Field != "email" {
+		t.Fatalf("expected the email violation, got %+v", violations)
+	}
+
+	unknown := mapCommandError(&contract.CommandError{Code: "TEAPOT", Message: "short and stout"})
+	if !errors.Is(unknown, ErrService) || unknown.Error() != "users client service error (TEAPOT): short and stout" {
+		t.Fatalf("expected a service error, got %v", unknown)
+	}
+	if FieldViolations(unknown) != nil {
+		t.Fatalf("expected no violations")
+	}
+}
+
+func TestMapCommandErrorConflictReasons(t *testing.T) {
+	for _, tc := range []struct {
+		reason string
+		want   error
+	}{
+		{reason: contract.ConflictReasonEmailTaken, want: ErrConflict},
+		{reason: contract.ConflictReasonVersionMismatch, want: ErrVersionConflict},
+		{reason: "", want: ErrVersionConflict},
+	} {
+		err := mapCommandError(&contract.CommandError{Code: "CONFLICT", Reason: tc.reason, Message: "conflict"})
+
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("reason %q: expected %v, got %v", tc.reason, tc.want, err)
+		}
+		var commandErr *CommandError
+		if !errors.As(err, &commandErr) || commandErr.Reason != tc.reason {
+			t.Fatalf("reason %q: expected the reason to be kept, got %+v", tc.reason, err)
+		}
+	}
+}
+
+func TestMapCommandErrorLocked(t *testing.T) {
+	err := mapCommandError(&contract.CommandError{Code: "LOCKED", Reason: contract.LockedReasonAccount, Message: "too many failed logins", RetryAfter: 90})
+
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if got := RetryAfter(err); got != 90*time.Second {
+		t.Fatalf("expected to retry after 90s, got %s", got)
+	}
+	if got := RetryAfter(mapCommandError(&contract.CommandError{Code: "UNAUTHENTICATED", RetryAfter: 90})); got != 0 {
+		t.Fatalf("expected no retry delay for other errors, got %s", got)
+	}
+}
@@ -0,0 +1,130 @@
+package usersclient
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"user-service/pkg/contract"
+)
+
+// SetPasswordInput sets a user's password. Users changing their own password must also give
+// the current one; Roles, when set, replaces the roles the user logs in with.
+type SetPasswordInput struct {
+	Password        string   `json:"password"`
+	CurrentPassword string   `json:"currentPassword,omitempty"`
+	Roles           []string `json:"roles,omitempty"`
+}
+
+type SetPasswordRequest struct {
+	ID string `json:"id"`
+	SetPasswordInput
+}
+
+// Credential describes a user's password entry; the hash never leaves the service.
+type Credential struct {
+	UserID    string    `json:"userId"`
+	Roles     []string  `json:"roles"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AuthenticateRequest is a login. SourceIP is the address of the client logging in: failed
+// logins lock the address as well as the account.
+type AuthenticateRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	SourceIP string `json:"sourceIp,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Session is a login: the user, the roles to put into their access token, and the refresh
+// token that continues the session. Each refresh token works once.
+type Session struct {
+	UserID           string    `json:"userId"`
+	Roles            []string  `json:"roles"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// UnlockResult reports whether UnlockUser lifted a lock.
+type UnlockResult struct {
+	UserID    string `json:"userId"`
+	WasLocked bool   `json:"wasLocked"`
+}
+
+// CredentialClient manages passwords and the login sessions started with them.
+type CredentialClient interface {
+	SetPassword(ctx context.Context, userID string, input SetPasswordInput) (*Credential, error)
+	// Authenticate checks an email and password and starts a session; wrong ones are
+	// ErrUnauthenticated, and logins of a locked account or address ErrLocked (see RetryAfter).
+	Authenticate(ctx context.Context, req AuthenticateRequest) (*Session, error)
+	// RefreshSession exchanges a refresh token for a new one; used, expired and revoked tokens
+	// are ErrUnauthenticated.
+	RefreshSession(ctx context.Context, refreshToken string) (*Session, error)
+	// RevokeSession ends the session of a refresh token.
+	RevokeSession(ctx context.Context, refreshToken string) error
+	// UnlockUser lifts the lock failed logins put on the user's account.
+	UnlockUser(ctx context.Context, userID string) (*UnlockResult, error)
+}
+
+func (c *NATSClient) SetPassword(ctx context.Context, userID string, input SetPasswordInput) (*Credential, error) {
+	req := contract.CommandRequest[SetPasswordRequest]{RequestID: newRequestID(), Data: SetPasswordRequest{ID: userID, SetPasswordInput: input}}
+
+	resp, err := request[Credential](ctx, c, contract.SubjectCredentialCommandSetPassword, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty set password response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) Authenticate(ctx context.Context, login AuthenticateRequest) (*Session, error) {
+	req := contract.CommandRequest[AuthenticateRequest]{RequestID: newRequestID(), Data: login}
+
+	resp, err := request[Session](ctx, c, contract.SubjectCredentialCommandAuthenticate, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty authenticate response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) RefreshSession(ctx context.Context, refreshToken string) (*Session, error) {
+	req := contract.CommandRequest[RefreshTokenRequest]{RequestID: newRequestID(), Data: RefreshTokenRequest{RefreshToken: refreshToken}}
+
+	resp, err := request[Session](ctx, c, contract.SubjectSessionCommandRefresh, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty refresh session response")
+	}
+	return resp.Data, nil
+}
+
+func (c *NATSClient) RevokeSession(ctx context.Context, refreshToken string) error {
+	req := contract.CommandRequest[RefreshTokenRequest]{RequestID: newRequestID(), Data: RefreshTokenRequest{RefreshToken: refreshToken}}
+
+	_, err := request[struct{}](ctx, c, contract.SubjectSessionCommandRevoke, req)
+	return err
+}
+
+func (c *NATSClient) UnlockUser(ctx context.Context, userID string) (*UnlockResult, error) {
+	req := contract.CommandRequest[IDRequest]{RequestID: newRequestID(), Data: IDRequest{ID: userID}}
+
+	resp, err := request[UnlockResult](ctx, c, contract.SubjectCredentialCommandUnlock, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("empty unlock response")
+	}
+	return resp.Data, nil
+}
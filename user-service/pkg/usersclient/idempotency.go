@@ -0,0 +1,20 @@
+package usersclient
+
+import "context"
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey attaches an idempotency key to ctx. Create, Update and Delete send it
+// along, and the user-service answers a repeated key with the original response.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set by WithIdempotencyKey, or "".
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
@@ -1,24 +1,73 @@
 package usersclient
 
-import "time"
+import (
+	"time"
+
+	"user-service/pkg/contract"
+)
 
 // transport/API contract models (shared between gateway and service messaging).
 type CreateUserInput struct {
 	FirstName string `json:"firstName" validate:"required,min=2,max=50"`
 	LastName  string `json:"lastName" validate:"required,min=2,max=50"`
 	Email     string `json:"email" validate:"required,email"`
-	Phone     string `json:"phone,omitempty" validate:"omitempty,phone"`
+	Phone     string `json:"phone,omitempty" validate:"omitempty,phone_e164"`
 	Age       *int32 `json:"age,omitempty" validate:"omitempty,gt=0"`
 	Status    string `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
 }
 
+// bulk create modes: atomic creates every user or none, partial creates the valid ones.
+const (
+	BulkModeAtomic  = "atomic"
+	BulkModePartial = "partial"
+)
+
+// MaxBulkCreateRows is the most users the service accepts in one bulk create.
+const MaxBulkCreateRows = 1000
+
+type BulkCreateUsersInput struct {
+	Mode  string            `json:"mode,omitempty" validate:"omitempty,oneof=atomic partial"`
+	Users []CreateUserInput `json:"users"`
+}
+
 type UpdateUserInput struct {
 	FirstName *string `json:"firstName,omitempty" validate:"omitempty,min=2,max=50"`
 	LastName  *string `json:"lastName,omitempty" validate:"omitempty,min=2,max=50"`
 	Email     *string `json:"email,omitempty" validate:"omitempty,email"`
-	Phone     *string `json:"phone,omitempty" validate:"omitempty,phone"`
+	Phone     *string `json:"phone,omitempty" validate:"omitempty,phone_e164"`
 	Age       *int32  `json:"age,omitempty" validate:"omitempty,gt=0"`
 	Status    *string `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+	// ExpectedVersion makes the update fail with ErrVersionConflict unless the stored version matches.
+	ExpectedVersion *int32 `json:"expectedVersion,omitempty" validate:"omitempty,gt=0"`
+}
+
+// ListUsersFilter narrows a listing; zero values mean "no filter". CreatedTo is exclusive.
+type ListUsersFilter struct {
+	Status      string     `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+	EmailDomain string     `json:"emailDomain,omitempty" validate:"omitempty,fqdn"`
+	CreatedFrom *time.Time `json:"createdFrom,omitempty"`
+	CreatedTo   *time.Time `json:"createdTo,omitempty"`
+	MinAge      *int32     `json:"minAge,omitempty" validate:"omitempty,gt=0"`
+	MaxAge      *int32     `json:"maxAge,omitempty" validate:"omitempty,gt=0"`
+	// IncludeDeleted also returns soft-deleted users; meant for admin tooling.
+	IncludeDeleted bool `json:"includeDeleted,omitempty"`
+}
+
+type ListUsersSort struct {
+	Field string `json:"field,omitempty" validate:"omitempty,oneof=createdAt firstName lastName"`
+	Order string `json:"order,omitempty" validate:"omitempty,oneof=asc desc"`
+}
+
+type ListUsersInput struct {
+	Limit  int32           `json:"limit,omitempty" validate:"omitempty,gt=0"`
+	Cursor string          `json:"cursor,omitempty"`
+	Filter ListUsersFilter `json:"filter"`
+	Sort   ListUsersSort   `json:"sort"`
+}
+
+type SearchUsersInput struct {
+	Query string `json:"query" validate:"required,min=2,max=100"`
+	Limit int32  `json:"limit,omitempty" validate:"omitempty,gt=0"`
 }
 
 type UpdateUserRequest struct {
@@ -30,14 +79,95 @@ type IDRequest struct {
 	ID string `json:"id" validate:"required,uuid"`
 }
 
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// HistoryInput pages through a user's audit history; Cursor is the NextCursor of the previous page.
+type HistoryInput struct {
+	Limit  int32  `json:"limit,omitempty" validate:"omitempty,gt=0"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type HistoryRequest struct {
+	ID string `json:"id" validate:"required,uuid"`
+	HistoryInput
+}
+
+type DeleteUserRequest struct {
+	ID              string `json:"id" validate:"required,uuid"`
+	ExpectedVersion *int32 `json:"expectedVersion,omitempty" validate:"omitempty,gt=0"`
+}
+
 type User struct {
-	UserID    string    `json:"userId"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Phone     *string   `json:"phone,omitempty"`
-	Age       *int32    `json:"age,omitempty"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	UserID    string     `json:"userId"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Email     string     `json:"email"`
+	Phone     *string    `json:"phone,omitempty"` // E.164
+	PhoneRaw  *string    `json:"phoneRaw,omitempty"`
+	Age       *int32     `json:"age,omitempty"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	Version   int32      `json:"version"`
+}
+
+// UserPage is one page of a user listing; NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// AuditEntry is one recorded change of a user. Changes maps each changed field to its old and
+// new value; fields are named as in User.
+type AuditEntry struct {
+	ID         int64                           `json:"id"`
+	UserID     string                          `json:"userId"`
+	Action     string                          `json:"action"`
+	Actor      contract.Actor                  `json:"actor"`
+	RequestID  string                          `json:"requestId,omitempty"`
+	Changes    map[string]contract.FieldChange `json:"changes"`
+	OccurredAt time.Time                       `json:"occurredAt"`
+}
+
+// HistoryPage is one page of a user's audit history, newest first; NextCursor is empty on the last page.
+type HistoryPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// BulkRowError says why a row was not created. Code is BAD_REQUEST for invalid data,
+// CONFLICT (reason email_taken) for a taken email, and ABORTED for a valid row skipped
+// because another row of an atomic import failed.
+type BulkRowError struct {
+	Code       string                    `json:"code"`
+	Reason     string                    `json:"reason,omitempty"`
+	Message    string                    `json:"message"`
+	Violations []contract.FieldViolation `json:"violations,omitempty"`
+}
+
+// BulkCreateRow is the outcome of one input row; Row is its 1-based position in the input.
+type BulkCreateRow struct {
+	Row   int           `json:"row"`
+	User  *User         `json:"user,omitempty"`
+	Error *BulkRowError `json:"error,omitempty"`
+}
+
+type BulkCreateReport struct {
+	Mode    string          `json:"mode"`
+	Created int             `json:"created"`
+	Failed  int             `json:"failed"`
+	Rows    []BulkCreateRow `json:"rows"`
+}
+
+// SearchResult is a matched user plus its relevance score (0-1, higher is closer).
+type SearchResult struct {
+	User
+	Score float32 `json:"score"`
+}
+
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
 }
@@ -0,0 +1,44 @@
+package usersclient
+
+import "context"
+
+// eachPageSize is the page size EachPage asks for unless the input sets one; it is the
+// largest page the user-service returns.
+const eachPageSize = 200
+
+type skipCacheCtx struct{}
+
+// withoutCache marks ctx so that List results are not stored in the client's cache.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCacheCtx{}, true)
+}
+
+func cacheSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipCacheCtx{}).(bool)
+	return skip
+}
+
+// EachPage walks every user matching input's filter and sort, calling fn once per page, in
+// order, until the last page or until fn returns an error. A cursor in input resumes an
+// earlier walk. The pages bypass the client's cache so that dumping a large table does not
+// fill it.
+func EachPage(ctx context.Context, client Client, input ListUsersInput, fn func(page *UserPage) error) error {
+	if input.Limit == 0 {
+		input.Limit = eachPageSize
+	}
+	ctx = withoutCache(ctx)
+
+	for {
+		page, err := client.List(ctx, input)
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		input.Cursor = page.NextCursor
+	}
+}
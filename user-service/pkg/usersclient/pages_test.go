@@ -0,0 +1,59 @@
+package usersclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// pagedClient serves List from pages keyed by cursor; the other Client methods are unused.
+type pagedClient struct {
+	Client
+	pages   map[string]UserPage
+	inputs  []ListUsersInput
+	skipped []bool
+}
+
+func (c *pagedClient) List(ctx context.Context, input ListUsersInput) (*UserPage, error) {
+	c.inputs = append(c.inputs, input)
+	c.skipped = append(c.skipped, cacheSkipped(ctx))
+	page := c.pages[input.Cursor]
+	return &page, nil
+}
+
+func TestEachPageFollowsCursors(t *testing.T) {
+	client := &pagedClient{pages: map[string]UserPage{
+		"":   {Users: []User{{UserID: "1"}, {UserID: "2"}}, NextCursor: "c2"},
+		"c2": {Users: []User{{UserID: "3"}}},
+	}}
+
+	var ids []string
+	err := EachPage(context.Background(), client, ListUsersInput{Filter: ListUsersFilter{Status: "Active"}}, func(page *UserPage) error {
+		for _, user := range page.Users {
+			ids = append(ids, user.UserID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("each page: %v", err)
+	}
+
+	if len(ids) != 3 || ids[2] != "3" {
+		t.Fatalf("expected all three users, got %v", ids)
+	}
+	for i, input := range client.inputs {
+		if input.Limit != eachPageSize || input.Filter.Status != "Active" || !client.skipped[i] {
+			t.Fatalf("call %d: unexpected input %+v (cache skipped %v)", i, input, client.skipped[i])
+		}
+	}
+}
+
+func TestEachPageStopsOnCallbackError(t *testing.T) {
+	client := &pagedClient{pages: map[string]UserPage{"": {NextCursor: "c2"}}}
+	stop := errors.New("stop")
+
+	err := EachPage(context.Background(), client, ListUsersInput{Limit: 10}, func(*UserPage) error { return stop })
+	if !errors.Is(err, stop) || len(client.inputs) != 1 || client.inputs[0].Limit != 10 {
+		t.Fatalf("expected a single call and the callback error, got %v after %d calls", err, len(client.inputs))
+	}
+}
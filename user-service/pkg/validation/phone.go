@@ -1,13 +1,18 @@
 package validation
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
 var phoneRegex = regexp.MustCompile(`^\+?[0-9][0-9\s\-()]{6,19}$`)
 
+// RegisterPhone registers the loose "phone" rule, which only checks the characters and length.
+// New inputs use "phone_e164", which also checks the number against its numbering plan.
 func RegisterPhone(v *validator.Validate) error {
 	return v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
 		value := fl.Field().String()
@@ -17,3 +22,150 @@ func RegisterPhone(v *validator.Validate) error {
 		return phoneRegex.MatchString(value)
 	})
 }
+
+// RegisterPhoneE164 registers the "phone_e164" rule: the value must normalize with NormalizePhone,
+// where national numbers are read in defaultRegion.
+func RegisterPhoneE164(v *validator.Validate, defaultRegion string) error {
+	return v.RegisterValidation("phone_e164", func(fl validator.FieldLevel) bool {
+		value := fl.Field().String()
+		if value == "" {
+			return true
+		}
+		_, err := NormalizePhone(value, defaultRegion)
+		return err == nil
+	})
+}
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// maxPhoneInput bounds the raw input, punctuation included; E.164 itself is at most 15 digits.
+const maxPhoneInput = 32
+
+type numberingPlan struct {
+	callingCode string
+	regions     []string       // ISO 3166-1 alpha-2 codes sharing the plan, main region first
+	trunkPrefix string         // dialled before national numbers, dropped in E.164
+	national    *regexp.Regexp // valid national significant numbers
+}
+
+func plan(callingCode, trunkPrefix, national string, regions ...string) numberingPlan {
+	return numberingPlan{
+		callingCode: callingCode,
+		regions:     regions,
+		trunkPrefix: trunkPrefix,
+		national:    regexp.MustCompile(`^(?:` + national + `)$`),
+	}
+}
+
+// numberingPlans covers the regions we have users in. The national patterns check the length
+// and leading digits of each plan, not whether a number is actually assigned.
+var numberingPlans = []numberingPlan{
+	plan("1", "1", `[2-9]\d{9}`, "US", "CA"),
+	plan("7", "8", `[3489]\d{9}`, "RU", "KZ"),
+	plan("31", "0", `[1-9]\d{8}`, "NL"),
+	plan("32", "0", `[1-9]\d{7,8}`, "BE"),
+	plan("33", "0", `[1-9]\d{8}`, "FR"),
+	plan("34", "", `[5-9]\d{8}`, "ES"),
+	plan("39", "", `0\d{5,10}|3\d{8,9}`, "IT"),
+	plan("41", "0", `[1-9]\d{8}`, "CH"),
+	plan("43", "0", `[1-9]\d{3,12}`, "AT"),
+	plan("44", "0", `[1-9]\d{8,9}`, "GB"),
+	plan("46", "0", `[1-9]\d{6,9}`, "SE"),
+	plan("48", "", `[1-9]\d{8}`, "PL"),
+	plan("49", "0", `[1-9]\d{6,12}`, "DE"),
+	plan("52", "", `[1-9]\d{9}`, "MX"),
+	plan("55", "0", `[1-9]{2}9?\d{8}`, "BR"),
+	plan("61", "0", `[2-478]\d{8}`, "AU"),
+	plan("64", "0", `[2-9]\d{7,9}`, "NZ"),
+	plan("81", "0", `[1-9]\d{8,9}`, "JP"),
+	plan("86", "0", `1[3-9]\d{9}|[2-9]\d{8,10}`, "CN"),
+	plan("91", "0", `[1-9]\d{9}`, "IN"),
+	plan("353", "0", `[1-9]\d{6,8}`, "IE"),
+	plan("380", "0", `[1-9]\d{8}`, "UA"),
+}
+
+var (
+	plansByRegion      = map[string]*numberingPlan{}
+	plansByCallingCode = map[string]*numberingPlan{}
+)
+
+func init() {
+	for i := range numberingPlans {
+		p := &numberingPlans[i]
+		plansByCallingCode[p.callingCode] = p
+		for _, region := range p.regions {
+			plansByRegion[region] = p
+		}
+	}
+}
+
+// IsPhoneRegion reports whether region (ISO 3166-1 alpha-2, any case) has a numbering plan,
+// i.e. whether it can be used as the default region of NormalizePhone.
+func IsPhoneRegion(region string) bool {
+	_, ok := plansByRegion[strings.ToUpper(region)]
+	return ok
+}
+
+// NormalizePhone returns raw in E.164 form, e.g. "+15551234567". raw may be written
+// internationally ("+44 20 7946 0958", "0044 ...") or nationally ("(555) 123-4567",
+// "020 7946 0958"), in which case it is read in defaultRegion; spaces, dots, dashes and
+// parentheses are ignored. Numbers are checked against the plan of their country; numbers
+// of countries without a plan here only have to fit the E.164 limits.
+func NormalizePhone(raw, defaultRegion string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxPhoneInput {
+		return "", ErrInvalidPhone
+	}
+
+	international := strings.HasPrefix(raw, "+")
+	var digits strings.Builder
+	for i, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case i == 0 && r == '+', strings.ContainsRune(" .-()", r):
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+
+	home := plansByRegion[strings.ToUpper(defaultRegion)]
+	if !international {
+		// international call prefixes: 00 almost everywhere, 011 in North America
+		switch {
+		case strings.HasPrefix(number, "00"):
+			number, international = number[2:], true
+		case home != nil && home.callingCode == "1" && strings.HasPrefix(number, "011"):
+			number, international = number[3:], true
+		}
+	}
+
+	if !international {
+		if home == nil {
+			return "", fmt.Errorf("%w: national number without a default region", ErrInvalidPhone)
+		}
+		return home.normalize(number)
+	}
+	for n := 1; n <= 3 && n < len(number); n++ {
+		if p, ok := plansByCallingCode[number[:n]]; ok {
+			return p.normalize(number[n:])
+		}
+	}
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// normalize checks a national number against the plan, dropping the trunk prefix when it was
+// dialled, as in "020 7946 0958" or "+44 (0)20 7946 0958".
+func (p *numberingPlan) normalize(number string) (string, error) {
+	if p.trunkPrefix != "" && strings.HasPrefix(number, p.trunkPrefix) && !p.national.MatchString(number) {
+		number = number[len(p.trunkPrefix):]
+	}
+	if !p.national.MatchString(number) {
+		return "", fmt.Errorf("%w: not a valid %s number", ErrInvalidPhone, p.regions[0])
+	}
+	return "+" + p.callingCode + number, nil
+}
@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		raw, region, want string
+	}{
+		{raw: "(555) 123-4567", region: "US", want: "+15551234567"},
+		{raw: "+1 555 1234567", region: "US", want: "+15551234567"},
+		{raw: "5551234567", region: "us", want: "+15551234567"},
+		{raw: "1-555-123-4567", region: "US", want: "+15551234567"},
+		{raw: "011 44 20 7946 0958", region: "US", want: "+442079460958"},
+		{raw: "020 7946 0958", region: "GB", want: "+442079460958"},
+		{raw: "+44 (0)20 7946 0958", region: "US", want: "+442079460958"},
+		{raw: "0044 20 7946 0958", region: "DE", want: "+442079460958"},
+		{raw: "06 1234 5678", region: "IT", want: "+390612345678"},
+		{raw: "8 916 123-45-67", region: "RU", want: "+79161234567"},
+		{raw: "+1 604 555 0123", region: "", want: "+16045550123"},
+		{raw: "+254 712 345678", region: "US", want: "+254712345678"}, // no plan for KE, E.164 limits only
+	}
+	for _, tc := range cases {
+		got, err := NormalizePhone(tc.raw, tc.region)
+		if err != nil || got != tc.want {
+			t.Fatalf("NormalizePhone(%q, %q): expected %q, got %q, %v", tc.raw, tc.region, tc.want, got, err)
+		}
+	}
+}
+
+func TestNormalizePhoneRejects(t *testing.T) {
+	cases := []struct {
+		raw, region string
+	}{
+		{raw: "", region: "US"},
+		{raw: "555-CALL-NOW", region: "US"},
+		{raw: "555 1234", region: "US"},           // too short for NANP
+		{raw: "(055) 123-4567", region: "US"},     // area codes never start with 0
+		{raw: "020 7946 0958", region: ""},        // national number, no region to read it in
+		{raw: "020 7946 0958", region: "XX"},      // unknown region
+		{raw: "+44 20 7946 09581234", region: ""}, // too long for GB
+		{raw: "+254 7", region: ""},
+		{raw: "+1 555 123 4567 +1", region: ""},
+	}
+	for _, tc := range cases {
+		if got, err := NormalizePhone(tc.raw, tc.region); !errors.Is(err, ErrInvalidPhone) {
+			t.Fatalf("NormalizePhone(%q, %q): expected ErrInvalidPhone, got %q, %v", tc.raw, tc.region, got, err)
+		}
+	}
+}
+
+func TestPhoneE164Rule(t *testing.T) {
+	type input struct {
+		Phone string `json:"phone,omitempty" validate:"omitempty,phone_e164"`
+	}
+
+	if err := New(WithPhoneRegion("GB")).Struct(input{Phone: "020 7946 0958"}); err != nil {
+		t.Fatalf("expected a GB national number to pass with region GB, got %v", err)
+	}
+	err := New().Struct(input{Phone: "020 7946 0958"})
+	if v := Violations(err); len(v) != 1 || v[0].Rule != "phone_e164" {
+		t.Fatalf("expected a phone_e164 violation without a region, got %v", err)
+	}
+}
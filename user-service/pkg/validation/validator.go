@@ -0,0 +1,71 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"user-service/pkg/contract"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Option configures the validator returned by New.
+type Option func(*options)
+
+type options struct {
+	phoneRegion string
+}
+
+// WithPhoneRegion sets the region that phone_e164 reads national phone numbers in.
+// Without it only international numbers pass.
+func WithPhoneRegion(region string) Option {
+	return func(o *options) { o.phoneRegion = region }
+}
+
+// New returns a validator with the custom rules registered that names fields by their
+// JSON names, so errors and violations match what clients send.
+func New(opts ...Option) *validator.Validate {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	_ = RegisterPhone(v)
+	_ = RegisterPhoneE164(v, o.phoneRegion)
+	return v
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
+
+// Violations lists the failed rules of a validator error, or returns nil for any other error.
+func Violations(err error) []contract.FieldViolation {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return nil
+	}
+
+	violations := make([]contract.FieldViolation, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		// the namespace starts with the struct type name, e.g. "ListUsersInput.filter.status"
+		_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+		violations = append(violations, contract.FieldViolation{
+			Field: field,
+			Rule:  fieldErr.Tag(),
+			Param: fieldErr.Param(),
+		})
+	}
+	return violations
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"user-service/pkg/contract"
+)
+
+type testFilter struct {
+	Status string `json:"status,omitempty" validate:"omitempty,oneof=Active Inactive"`
+}
+
+type testInput struct {
+	Email  string     `json:"email" validate:"required,email"`
+	Age    int32      `json:"age,omitempty" validate:"omitempty,gt=0"`
+	Phone  string     `json:"phone,omitempty" validate:"omitempty,phone"`
+	Filter testFilter `json:"filter"`
+}
+
+func TestViolationsUseJSONPaths(t *testing.T) {
+	err := New().Struct(testInput{Age: -1, Phone: "abc", Filter: testFilter{Status: "Gone"}})
+
+	want := []contract.FieldViolation{
+		{Field: "email", Rule: "required"},
+		{Field: "age", Rule: "gt", Param: "0"},
+		{Field: "phone", Rule: "phone"},
+		{Field: "filter.status", Rule: "oneof", Param: "Active Inactive"},
+	}
+	if got := Violations(err); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestViolationsIgnoresOtherErrors(t *testing.T) {
+	if got := Violations(errors.New("boom")); got != nil {
+		t.Fatalf("expected nil, got %+v", got)
+	}
+	if got := Violations(New().Struct(testInput{Email: "john@example.com"})); got != nil {
+		t.Fatalf("expected nil for a valid struct, got %+v", got)
+	}
+}
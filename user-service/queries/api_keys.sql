@@ -0,0 +1,54 @@
+-- name: InsertAPIKey :one
+INSERT INTO api_keys (
+    key_id,
+    name,
+    secret_hash,
+    scopes,
+    created_by,
+    expires_at,
+    rotated_from
+) VALUES (
+    sqlc.arg(key_id),
+    sqlc.arg(name),
+    sqlc.arg(secret_hash),
+    sqlc.arg(scopes),
+    sqlc.arg(created_by),
+    sqlc.narg(expires_at),
+    sqlc.narg(rotated_from)
+)
+RETURNING key_id, name, secret_hash, scopes, created_by, created_at, expires_at, revoked_at, last_used_at, rotated_from;
+
+-- name: GetAPIKey :one
+SELECT key_id, name, secret_hash, scopes, created_by, created_at, expires_at, revoked_at, last_used_at, rotated_from
+FROM api_keys
+WHERE key_id = $1;
+
+-- name: LockAPIKey :one
+SELECT key_id, name, secret_hash, scopes, created_by, created_at, expires_at, revoked_at, last_used_at, rotated_from
+FROM api_keys
+WHERE key_id = $1
+FOR UPDATE;
+
+-- name: ListAPIKeys :many
+SELECT key_id, name, secret_hash, scopes, created_by, created_at, expires_at, revoked_at, last_used_at, rotated_from
+FROM api_keys
+ORDER BY created_at DESC, key_id;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE key_id = $1 AND revoked_at IS NULL
+RETURNING key_id, name, secret_hash, scopes, created_by, created_at, expires_at, revoked_at, last_used_at, rotated_from;
+
+-- name: ExpireAPIKey :exec
+-- brings the expiry forward to expires_at; a key already expiring sooner keeps its expiry.
+UPDATE api_keys
+SET expires_at = LEAST(COALESCE(expires_at, sqlc.arg(expires_at)), sqlc.arg(expires_at))
+WHERE key_id = sqlc.arg(key_id);
+
+-- name: TouchAPIKeys :execrows
+-- records a use of the keys; reports arriving out of order never move last_used_at back.
+UPDATE api_keys
+SET last_used_at = sqlc.arg(used_at)
+WHERE key_id = ANY(sqlc.arg(key_ids)::uuid[])
+    AND (last_used_at IS NULL OR last_used_at < sqlc.arg(used_at));
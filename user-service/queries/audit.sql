@@ -0,0 +1,25 @@
+-- name: InsertUserAudit :exec
+INSERT INTO user_audit (
+    user_id,
+    action,
+    actor_id,
+    source,
+    request_id,
+    changes
+) VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(action),
+    sqlc.arg(actor_id),
+    sqlc.arg(source),
+    sqlc.arg(request_id),
+    sqlc.arg(changes)
+);
+
+-- name: ListUserAudit :many
+-- newest first; before_id continues after the last entry of the previous page.
+SELECT id, user_id, action, actor_id, source, request_id, changes, created_at
+FROM user_audit
+WHERE user_id = sqlc.arg(user_id)
+    AND (sqlc.narg(before_id)::bigint IS NULL OR id < sqlc.narg(before_id)::bigint)
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
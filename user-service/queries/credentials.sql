@@ -0,0 +1,75 @@
+-- name: UpsertCredential :one
+-- sets the user's password; roles are kept when not given, and default to {user} for a new credential.
+INSERT INTO user_credentials (
+    user_id,
+    password_hash,
+    roles
+) VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(password_hash),
+    COALESCE(sqlc.narg(roles)::text[], '{user}')
+)
+ON CONFLICT (user_id) DO UPDATE
+SET password_hash = EXCLUDED.password_hash,
+    roles = COALESCE(sqlc.narg(roles)::text[], user_credentials.roles),
+    updated_at = NOW()
+RETURNING user_id, password_hash, roles, created_at, updated_at;
+
+-- name: GetActiveCredential :one
+-- reads the credential of a user that may log in: not deleted and Active.
+SELECT c.user_id, c.password_hash, c.roles, c.created_at, c.updated_at
+FROM user_credentials c
+JOIN users u ON u.user_id = c.user_id
+WHERE c.user_id = $1 AND u.deleted_at IS NULL AND u.status = 'Active';
+
+-- name: GetCredentialRoles :one
+-- reads the user's roles whatever the user's status, e.g. to check who may reset the password.
+SELECT roles
+FROM user_credentials
+WHERE user_id = $1;
+
+-- name: UpdatePasswordHash :exec
+UPDATE user_credentials
+SET password_hash = sqlc.arg(password_hash)
+WHERE user_id = sqlc.arg(user_id);
+
+-- name: InsertRefreshToken :one
+INSERT INTO refresh_tokens (
+    token_id,
+    family_id,
+    user_id,
+    secret_hash,
+    expires_at
+) VALUES (
+    sqlc.arg(token_id),
+    sqlc.arg(family_id),
+    sqlc.arg(user_id),
+    sqlc.arg(secret_hash),
+    sqlc.arg(expires_at)
+)
+RETURNING token_id, family_id, user_id, secret_hash, created_at, expires_at, used_at, revoked_at;
+
+-- name: LockRefreshToken :one
+SELECT token_id, family_id, user_id, secret_hash, created_at, expires_at, used_at, revoked_at
+FROM refresh_tokens
+WHERE token_id = $1
+FOR UPDATE;
+
+-- name: MarkRefreshTokenUsed :exec
+UPDATE refresh_tokens
+SET used_at = NOW()
+WHERE token_id = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteExpiredRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at < NOW();
@@ -0,0 +1,40 @@
+-- name: ClaimIdempotencyKey :execrows
+-- claims the key for a new request; an expired key, or one whose request died without
+-- storing a response, is taken over. Zero rows means someone else holds the key.
+INSERT INTO idempotency_keys (
+    key,
+    subject,
+    request_hash,
+    expires_at
+) VALUES (
+    sqlc.arg(key),
+    sqlc.arg(subject),
+    sqlc.arg(request_hash),
+    sqlc.arg(expires_at)
+)
+ON CONFLICT (key, subject) DO UPDATE
+SET
+    request_hash = EXCLUDED.request_hash,
+    response = NULL,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < NOW()
+    OR (idempotency_keys.response IS NULL AND idempotency_keys.created_at < sqlc.arg(stale_before));
+
+-- name: GetIdempotencyKey :one
+SELECT request_hash, response
+FROM idempotency_keys
+WHERE key = $1 AND subject = $2;
+
+-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys
+SET response = $3
+WHERE key = $1 AND subject = $2;
+
+-- name: ReleaseIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1 AND subject = $2 AND response IS NULL;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < NOW();
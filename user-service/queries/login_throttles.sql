@@ -0,0 +1,52 @@
+-- name: GetLoginThrottle :one
+SELECT scope, subject, user_id, failures, lockouts, last_failure_at, locked_until, unlock_pending
+FROM login_throttles
+WHERE scope = $1 AND subject = $2;
+
+-- name: EnsureLoginThrottle :exec
+-- creates the row a failed login is counted in, so it can be locked.
+INSERT INTO login_throttles (
+    scope,
+    subject,
+    user_id
+) VALUES (
+    sqlc.arg(scope),
+    sqlc.arg(subject),
+    sqlc.narg(user_id)
+)
+ON CONFLICT (scope, subject) DO NOTHING;
+
+-- name: LockLoginThrottle :one
+SELECT scope, subject, user_id, failures, lockouts, last_failure_at, locked_until, unlock_pending
+FROM login_throttles
+WHERE scope = $1 AND subject = $2
+FOR UPDATE;
+
+-- name: UpdateLoginThrottle :exec
+UPDATE login_throttles
+SET
+    failures = sqlc.arg(failures),
+    lockouts = sqlc.arg(lockouts),
+    last_failure_at = sqlc.arg(last_failure_at),
+    locked_until = sqlc.narg(locked_until),
+    unlock_pending = sqlc.arg(unlock_pending)
+WHERE scope = sqlc.arg(scope) AND subject = sqlc.arg(subject);
+
+-- name: DeleteLoginThrottle :one
+-- forgets the failures of a successful login or an unlock.
+DELETE FROM login_throttles
+WHERE scope = $1 AND subject = $2
+RETURNING scope, subject, user_id, failures, lockouts, last_failure_at, locked_until, unlock_pending;
+
+-- name: ReleaseExpiredLoginLocks :many
+-- claims the user locks that have ended, so each end is announced once.
+UPDATE login_throttles
+SET unlock_pending = FALSE
+WHERE unlock_pending AND locked_until <= sqlc.arg(now)
+RETURNING scope, subject, user_id, failures, lockouts, last_failure_at, locked_until, unlock_pending;
+
+-- name: DeleteIdleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE NOT unlock_pending
+  AND last_failure_at < sqlc.arg(idle_before)
+  AND (locked_until IS NULL OR locked_until < sqlc.arg(idle_before));
@@ -0,0 +1,38 @@
+-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (
+    event_id,
+    subject,
+    payload
+) VALUES (
+    sqlc.arg(event_id),
+    sqlc.arg(subject),
+    sqlc.arg(payload)
+);
+
+-- name: ClaimPendingOutboxEvents :many
+SELECT id, event_id, subject, payload, attempts
+FROM outbox
+WHERE sent_at IS NULL AND next_attempt_at <= NOW()
+ORDER BY id
+LIMIT sqlc.arg(batch_size)
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxEventSent :exec
+UPDATE outbox
+SET
+    attempts = attempts + 1,
+    last_error = NULL,
+    sent_at = NOW()
+WHERE id = $1;
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox
+SET
+    attempts = attempts + 1,
+    last_error = sqlc.arg(last_error),
+    next_attempt_at = sqlc.arg(next_attempt_at)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteSentOutboxEvents :execrows
+DELETE FROM outbox
+WHERE sent_at < sqlc.arg(sent_before);
@@ -5,26 +5,60 @@ INSERT INTO users (
     email,
     phone,
     age,
-    status
+    status,
+    email_normalized,
+    phone_raw
 ) VALUES (
     sqlc.arg(first_name),
     sqlc.arg(last_name),
     sqlc.arg(email),
     sqlc.narg(phone),
     sqlc.narg(age),
-    sqlc.arg(status)
+    sqlc.arg(status),
+    sqlc.arg(email_normalized),
+    sqlc.narg(phone_raw)
 )
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at;
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw;
 
--- name: ListUsers :many
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+-- name: GetUserByID :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
 FROM users
-ORDER BY created_at DESC;
+WHERE user_id = $1 AND deleted_at IS NULL;
 
--- name: GetUserByID :one
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+-- name: LockUser :one
+-- reads the user, deleted or not, and locks the row until the transaction ends.
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+FROM users
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: GetUserByEmail :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw
+FROM users
+WHERE email_normalized = $1 AND deleted_at IS NULL;
+
+-- name: SearchUsers :many
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, phone_raw,
+    GREATEST(
+        similarity(first_name || ' ' || last_name, sqlc.arg(term)::text),
+        word_similarity(sqlc.arg(term)::text, first_name || ' ' || last_name),
+        word_similarity(sqlc.arg(term)::text, email),
+        CASE WHEN sqlc.arg(digits)::text = '' THEN 0
+            ELSE word_similarity(sqlc.arg(digits)::text, regexp_replace(COALESCE(phone, ''), '[^0-9]', '', 'g'))
+        END
+    )::real AS score
 FROM users
-WHERE user_id = $1;
+WHERE deleted_at IS NULL
+    AND (
+        (first_name || ' ' || last_name) % sqlc.arg(term)::text
+        OR sqlc.arg(term)::text <% (first_name || ' ' || last_name)
+        OR email ILIKE sqlc.arg(email_pattern)::text
+        OR sqlc.arg(term)::text <% email
+        OR (sqlc.arg(digits)::text <> '' AND regexp_replace(phone, '[^0-9]', '', 'g') LIKE sqlc.arg(phone_pattern)::text)
+        OR (sqlc.arg(digits)::text <> '' AND sqlc.arg(digits)::text <% regexp_replace(phone, '[^0-9]', '', 'g'))
+    )
+ORDER BY score DESC, user_id
+LIMIT sqlc.arg(result_limit);
 
 -- name: UpdateUser :one
 UPDATE users
@@ -32,13 +66,66 @@ SET
     first_name = COALESCE(sqlc.narg(first_name), first_name),
     last_name = COALESCE(sqlc.narg(last_name), last_name),
     email = COALESCE(sqlc.narg(email), email),
+    email_normalized = COALESCE(sqlc.narg(email_normalized), email_normalized),
     phone = COALESCE(sqlc.narg(phone), phone),
+    phone_raw = COALESCE(sqlc.narg(phone_raw), phone_raw),
     age = COALESCE(sqlc.narg(age), age),
     status = COALESCE(sqlc.narg(status), status),
-    updated_at = NOW()
-WHERE user_id = sqlc.arg(user_id)
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at;
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = sqlc.arg(user_id) AND deleted_at IS NULL
+    AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)::int)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw;
+
+-- name: DeleteUser :one
+UPDATE users
+SET
+    deleted_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = sqlc.arg(user_id) AND deleted_at IS NULL
+    AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)::int)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw;
+
+-- name: RestoreUser :one
+UPDATE users
+SET
+    deleted_at = NULL,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw;
 
--- name: DeleteUser :execrows
+-- name: PurgeDeletedUsers :execrows
 DELETE FROM users
-WHERE user_id = $1;
+WHERE deleted_at < sqlc.arg(deleted_before);
+
+-- name: BulkCreateUsers :many
+-- inserts one user per array element in a single statement; an empty phone and a zero age are stored as NULL.
+INSERT INTO users (
+    first_name,
+    last_name,
+    email,
+    phone,
+    age,
+    status,
+    email_normalized,
+    phone_raw
+)
+SELECT first_name, last_name, email, NULLIF(phone, ''), NULLIF(age, 0), status, email_normalized, NULLIF(phone_raw, '')
+FROM unnest(
+    sqlc.arg(first_names)::text[],
+    sqlc.arg(last_names)::text[],
+    sqlc.arg(emails)::text[],
+    sqlc.arg(phones)::text[],
+    sqlc.arg(ages)::int[],
+    sqlc.arg(statuses)::text[],
+    sqlc.arg(emails_normalized)::text[],
+    sqlc.arg(phone_raws)::text[]
+) AS input(first_name, last_name, email, phone, age, status, email_normalized, phone_raw)
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, deleted_at, version, email_normalized, phone_raw;
+
+-- name: ListLiveNormalizedEmails :many
+SELECT email_normalized
+FROM users
+WHERE email_normalized = ANY(sqlc.arg(emails_normalized)::text[]) AND deleted_at IS NULL;